@@ -0,0 +1,65 @@
+// Package cache keeps the results of expensive work, like processed images, around between requests.
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Cache is a store of values bounded by their total size. Its tiers, like Memory and Disk, can be stacked with Tiered.
+type Cache interface {
+	// Get returns the value cached under key.
+	Get(key string) (interface{}, bool)
+	// Add caches value under key, size is what it counts for against the size of the cache.
+	Add(key string, value interface{}, size int64)
+	// Remove drops the value cached under key, if any.
+	Remove(key string)
+	// Stats returns the current counters of the cache.
+	Stats() Stats
+}
+
+// Stats are the counters of a cache, as reported by /health.
+type Stats struct {
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	Stale    uint64  `json:"stale,omitempty"` // Stale is how many stale values an Expiring cache looked up.
+	Entries  int     `json:"entries"`
+	Bytes    int64   `json:"bytes"`
+	MaxBytes int64   `json:"max_bytes"`
+	Tiers    []Stats `json:"tiers,omitempty"` // Tiers are the stats of each tier of a Tiered cache.
+}
+
+// Codec turns cached values into bytes and back, for the tiers that keep values out of memory.
+type Codec interface {
+	Encode(value interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// gobCodec is a Codec encoding values with encoding/gob.
+type gobCodec struct {
+	newValue func() interface{}
+}
+
+// Gob returns a Codec encoding values with encoding/gob. Values are decoded into what newValue returns,
+// which should be a pointer to the type of value cached.
+func Gob(newValue func() interface{}) Codec {
+	return &gobCodec{newValue: newValue}
+}
+
+func (c *gobCodec) Encode(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c *gobCodec) Decode(data []byte) (interface{}, error) {
+	value := c.newValue()
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
@@ -0,0 +1,299 @@
+package cache
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy is how a Disk cache picks the values it evicts.
+type Policy string
+
+const (
+	LRU Policy = "lru" // LRU evicts the least recently used values first.
+	LFU Policy = "lfu" // LFU evicts the least frequently used values first, the least recently used among equals.
+)
+
+const (
+	// diskLowWatermark is the share of its size a Disk cache evicts down to once it's full,
+	// so it doesn't sort its entries again for every value added after.
+	diskLowWatermark = 0.9
+	// diskTempPrefix starts the names of files being written, they're left behind by crashes only.
+	diskTempPrefix = ".tmp-"
+)
+
+var errChecksum = errors.New("checksum mismatch")
+
+// Disk is a cache of values stored as files under a directory, bounded by the total size of the files.
+// It survives restarts: the files already in the directory are cached values. Files are written to a temporary
+// file renamed into place, and checked against their checksum when read, so a crash never serves a partial value.
+// It's safe for concurrent use.
+type Disk struct {
+	dir      string
+	policy   Policy
+	codec    Codec
+	mu       sync.Mutex
+	entries  map[string]*diskEntry
+	bytes    int64
+	maxBytes int64
+	hits     uint64
+	misses   uint64
+}
+
+// diskEntry is a file of a Disk cache.
+type diskEntry struct {
+	name     string // name is the file's path relative to the cache's directory.
+	size     int64
+	lastUsed time.Time
+	uses     uint64
+}
+
+// NewDisk returns a Disk cache holding up to maxBytes of files in dir, which is created if needed.
+// Values are stored encoded with codec.
+func NewDisk(dir string, maxBytes int64, policy Policy, codec Codec) (*Disk, error) {
+	if policy != LRU && policy != LFU {
+		return nil, fmt.Errorf("Invalid disk cache policy [%s].", policy)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &Disk{
+		dir:      dir,
+		policy:   policy,
+		codec:    codec,
+		entries:  map[string]*diskEntry{},
+		maxBytes: maxBytes,
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// load indexes the files already in the cache's directory, they're used in the order they were last used in.
+func (c *Disk) load() error {
+	return filepath.Walk(c.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		if strings.HasPrefix(info.Name(), diskTempPrefix) {
+			return os.Remove(path)
+		}
+
+		name, err := filepath.Rel(c.dir, path)
+		if err != nil {
+			return err
+		}
+
+		c.entries[name] = &diskEntry{name: name, size: info.Size(), lastUsed: info.ModTime()}
+		c.bytes += info.Size()
+		return nil
+	})
+}
+
+// fileName is where the value of key is stored, relative to the cache's directory.
+func fileName(key string) string {
+	sum := fmt.Sprintf("%x", sha1.Sum([]byte(key)))
+	return filepath.Join(sum[:2], sum)
+}
+
+// Get returns the value cached under key. Files failing their checksum, or failing to decode, are removed.
+func (c *Disk) Get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	name := fileName(key)
+
+	c.mu.Lock()
+	e, ok := c.entries[name]
+	if ok {
+		e.lastUsed = time.Now()
+		e.uses++
+	}
+	c.mu.Unlock()
+
+	if ok {
+		value, err := c.read(name)
+		if err == nil {
+			c.mu.Lock()
+			c.hits++
+			c.mu.Unlock()
+
+			// the modification time is the last use of a file after a restart.
+			os.Chtimes(filepath.Join(c.dir, name), time.Now(), time.Now())
+			return value, true
+		}
+
+		c.Remove(key)
+	}
+
+	c.mu.Lock()
+	c.misses++
+	c.mu.Unlock()
+	return nil, false
+}
+
+// read decodes the value stored in file name, after checking its checksum.
+func (c *Disk) read(name string) (interface{}, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 4 || binary.BigEndian.Uint32(data) != crc32.ChecksumIEEE(data[4:]) {
+		return nil, errChecksum
+	}
+
+	return c.codec.Decode(data[4:])
+}
+
+// Add stores value under key, replacing what was there, and evicts values until the cache fits in its size again.
+// size is ignored: values count for the size of their file. Values larger than the whole cache aren't cached.
+func (c *Disk) Add(key string, value interface{}, size int64) {
+	if c == nil {
+		return
+	}
+
+	data, err := c.codec.Encode(value)
+	if err != nil || int64(len(data))+4 > c.maxBytes {
+		return
+	}
+
+	name := fileName(key)
+	if err := c.write(name, data); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[name]; ok {
+		c.bytes -= e.size
+	}
+	c.entries[name] = &diskEntry{name: name, size: int64(len(data)) + 4, lastUsed: time.Now()}
+	c.bytes += int64(len(data)) + 4
+
+	if c.bytes > c.maxBytes {
+		c.evict()
+	}
+}
+
+// write stores data in file name, prefixed with its checksum. It's written to a temporary file first,
+// renamed over name once complete.
+func (c *Disk) write(name string, data []byte) error {
+	path := filepath.Join(c.dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), diskTempPrefix)
+	if err != nil {
+		return err
+	}
+
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(data))
+
+	_, err = tmp.Write(checksum)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+// evict removes files, in the order of the cache's policy, until the cache fits in diskLowWatermark of its size.
+// c.mu must be held.
+func (c *Disk) evict() {
+	if c.bytes <= c.maxBytes {
+		return
+	}
+
+	entries := make([]*diskEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if c.policy == LFU && entries[i].uses != entries[j].uses {
+			return entries[i].uses < entries[j].uses
+		}
+
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+
+	target := int64(float64(c.maxBytes) * diskLowWatermark)
+	for _, e := range entries {
+		if c.bytes <= target {
+			break
+		}
+
+		c.removeEntry(e)
+	}
+}
+
+// removeEntry deletes the file of e. c.mu must be held.
+func (c *Disk) removeEntry(e *diskEntry) {
+	os.Remove(filepath.Join(c.dir, e.name))
+	delete(c.entries, e.name)
+	c.bytes -= e.size
+}
+
+// Remove deletes the file of the value cached under key, if any.
+func (c *Disk) Remove(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[fileName(key)]; ok {
+		c.removeEntry(e)
+	}
+}
+
+// Stats returns the current counters of the cache.
+func (c *Disk) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Entries:  len(c.entries),
+		Bytes:    c.bytes,
+		MaxBytes: c.maxBytes,
+	}
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type diskValue struct {
+	Data []byte
+	Name string
+}
+
+func newTestDisk(t *testing.T, dir string, maxBytes int64, policy Policy) *Disk {
+	c, err := NewDisk(dir, maxBytes, policy, Gob(func() interface{} { return &diskValue{} }))
+	assert.Nil(t, err)
+	return c
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "hips-disk-cache")
+	assert.Nil(t, err)
+	return dir
+}
+
+//go test ./cache -run Test_Disk_GetAdd -v
+func Test_Disk_GetAdd(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	c := newTestDisk(t, dir, 10000, LRU)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	c.Add("a", &diskValue{Data: []byte("image a"), Name: "a"}, 7)
+	value, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, &diskValue{Data: []byte("image a"), Name: "a"}, value)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Entries)
+
+	c.Remove("a")
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), c.Stats().Bytes)
+}
+
+//go test ./cache -run Test_Disk_Restart -v
+func Test_Disk_Restart(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	c := newTestDisk(t, dir, 10000, LRU)
+	c.Add("a", &diskValue{Name: "a"}, 0)
+	bytes := c.Stats().Bytes
+
+	// files left by a crash while writing are cleaned up.
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, diskTempPrefix+"1"), []byte("partial"), 0644))
+
+	c = newTestDisk(t, dir, 10000, LRU)
+	value, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "a", value.(*diskValue).Name)
+	assert.Equal(t, bytes, c.Stats().Bytes)
+
+	_, err := os.Stat(filepath.Join(dir, diskTempPrefix+"1"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+//go test ./cache -run Test_Disk_Checksum -v
+func Test_Disk_Checksum(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	c := newTestDisk(t, dir, 10000, LRU)
+
+	c.Add("a", &diskValue{Data: []byte("image a")}, 0)
+
+	path := filepath.Join(dir, fileName("a"))
+	data, _ := ioutil.ReadFile(path)
+	data[len(data)-1]++
+	assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+
+	// corrupted files are misses, and removed.
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Stats().Entries)
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+//go test ./cache -run Test_Disk_EvictLRU -v
+func Test_Disk_EvictLRU(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	size := entrySize(t, dir)
+	c := newTestDisk(t, dir, 3*size, LRU)
+
+	c.Add("a", &diskValue{Name: "a"}, 0)
+	c.Add("b", &diskValue{Name: "b"}, 0)
+	c.Add("c", &diskValue{Name: "c"}, 0)
+	// a is used more recently than b.
+	c.Get("a")
+	c.Add("d", &diskValue{Name: "d"}, 0)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	assert.True(t, c.Stats().Bytes <= 3*size)
+}
+
+//go test ./cache -run Test_Disk_EvictLFU -v
+func Test_Disk_EvictLFU(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	size := entrySize(t, dir)
+	c := newTestDisk(t, dir, 3*size, LFU)
+
+	c.Add("a", &diskValue{Name: "a"}, 0)
+	c.Add("b", &diskValue{Name: "b"}, 0)
+	c.Add("c", &diskValue{Name: "c"}, 0)
+	// a is used the most, but the least recently.
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+	c.Get("c")
+	c.Add("d", &diskValue{Name: "d"}, 0)
+
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+}
+
+// entrySize is the size of the file of a diskValue with a one letter name.
+func entrySize(t *testing.T, dir string) int64 {
+	c := newTestDisk(t, filepath.Join(dir, "size"), 10000, LRU)
+	c.Add("a", &diskValue{Name: "a"}, 0)
+	defer os.RemoveAll(filepath.Join(dir, "size"))
+
+	return c.Stats().Bytes
+}
+
+//go test ./cache -run Test_Disk_BadPolicy -v
+func Test_Disk_BadPolicy(t *testing.T) {
+	_, err := NewDisk(os.TempDir(), 100, Policy("fifo"), nil)
+	assert.Equal(t, "Invalid disk cache policy [fifo].", err.Error())
+}
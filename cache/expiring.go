@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Freshness is how a value looked up in an Expiring cache can be served.
+type Freshness int
+
+const (
+	Missing Freshness = iota // Missing means there's no value, or it's past its grace window.
+	Fresh                    // Fresh values are served as they are.
+	Stale                    // Stale values are past their ttl, but still within their grace window.
+)
+
+// Expiring is a Cache whose values are fresh for a ttl after they were added, then stale for a grace window,
+// and dropped after that. Get only returns fresh values, Lookup returns stale ones too, so callers can serve
+// them while refreshing them, or when refreshing them fails. A ttl of 0 never expires values.
+type Expiring struct {
+	Cache
+	ttl   time.Duration
+	grace time.Duration
+	added func(value interface{}) time.Time
+	stale uint64
+}
+
+// NewExpiring returns c with expiring values. added tells when a value was added, so the age of values
+// survives the tiers that keep them out of memory.
+func NewExpiring(c Cache, ttl, grace time.Duration, added func(value interface{}) time.Time) *Expiring {
+	return &Expiring{Cache: c, ttl: ttl, grace: grace, added: added}
+}
+
+// Get returns the value cached under key, if it's fresh.
+func (c *Expiring) Get(key string) (interface{}, bool) {
+	value, freshness := c.Lookup(key)
+	if freshness != Fresh {
+		return nil, false
+	}
+
+	return value, true
+}
+
+// Lookup returns the value cached under key, and its freshness. Values past their grace window are dropped.
+func (c *Expiring) Lookup(key string) (interface{}, Freshness) {
+	value, ok := c.Cache.Get(key)
+	if !ok {
+		return nil, Missing
+	}
+	if c.ttl <= 0 {
+		return value, Fresh
+	}
+
+	age := time.Since(c.added(value))
+	switch {
+	case age < c.ttl:
+		return value, Fresh
+	case age < c.ttl+c.grace:
+		atomic.AddUint64(&c.stale, 1)
+		return value, Stale
+	}
+
+	c.Cache.Remove(key)
+	return nil, Missing
+}
+
+// Stats returns the stats of the cache, with the stale values looked up.
+func (c *Expiring) Stats() Stats {
+	stats := c.Cache.Stats()
+	stats.Stale = atomic.LoadUint64(&c.stale)
+
+	return stats
+}
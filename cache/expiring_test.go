@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// timedValue is a value of an Expiring cache, added at a time.
+type timedValue struct {
+	added time.Time
+}
+
+func timedValueAdded(value interface{}) time.Time {
+	return value.(*timedValue).added
+}
+
+//go test ./cache -run Test_Expiring_Lookup -v
+func Test_Expiring_Lookup(t *testing.T) {
+	memory, _ := NewMemory(1000)
+	c := NewExpiring(memory, time.Minute, time.Hour, timedValueAdded)
+
+	c.Add("fresh", &timedValue{added: time.Now()}, 1)
+	c.Add("stale", &timedValue{added: time.Now().Add(-10 * time.Minute)}, 1)
+	c.Add("expired", &timedValue{added: time.Now().Add(-2 * time.Hour)}, 1)
+
+	_, freshness := c.Lookup("fresh")
+	assert.Equal(t, Fresh, freshness)
+	_, freshness = c.Lookup("stale")
+	assert.Equal(t, Stale, freshness)
+	_, freshness = c.Lookup("expired")
+	assert.Equal(t, Missing, freshness)
+	_, freshness = c.Lookup("none")
+	assert.Equal(t, Missing, freshness)
+
+	// Get only returns fresh values, and values past their grace are dropped.
+	_, ok := c.Get("fresh")
+	assert.True(t, ok)
+	_, ok = c.Get("stale")
+	assert.False(t, ok)
+
+	stats := c.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, uint64(2), stats.Stale)
+}
+
+//go test ./cache -run Test_Expiring_NoTTL -v
+func Test_Expiring_NoTTL(t *testing.T) {
+	memory, _ := NewMemory(1000)
+	c := NewExpiring(memory, 0, 0, timedValueAdded)
+
+	c.Add("a", &timedValue{added: time.Now().Add(-24 * time.Hour)}, 1)
+	_, freshness := c.Lookup("a")
+	assert.Equal(t, Fresh, freshness)
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// Group runs work once per key at a time: callers asking for a key that's already being worked on
+// wait for that call and share its result, instead of doing the same work again.
+// The zero Group is ready to use.
+type Group struct {
+	// Panicked, if set, is called once for each call whose fn panicked, e.g. to log it.
+	Panicked func(key string, err *PanicError)
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// call is a call of Group.Do in flight, or done.
+type call struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+// PanicError is the error of a call whose fn panicked, so the panic doesn't take down the goroutine
+// it ran in, and its waiters get an error instead of a nil value.
+type PanicError struct {
+	Value interface{} // Value is what fn panicked with.
+	Stack []byte      // Stack is the stack of fn when it panicked.
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Do runs fn and returns its result, unless a call for key is already in flight, in which case it waits for it
+// and returns its result instead. shared reports whether the result went to more than one caller.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (value interface{}, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.value, true, c.err
+	}
+
+	c := &call{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	g.run(key, c, fn)
+	return c.value, false, c.err
+}
+
+// Go runs fn in the background as the call for key, unless one is already in flight. Callers of Do for key
+// share its result meanwhile. It reports whether fn was started.
+func (g *Group) Go(key string, fn func() (interface{}, error)) bool {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+	if _, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		return false
+	}
+
+	c := &call{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	go g.run(key, c, fn)
+	return true
+}
+
+// run calls fn for the call c of key, and releases its waiters. A panic of fn is recovered as c's error.
+func (g *Group) run(key string, c *call, fn func() (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			err := &PanicError{Value: r, Stack: debug.Stack()}
+			c.value, c.err = nil, err
+			if g.Panicked != nil {
+				g.Panicked(key, err)
+			}
+		}
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+
+	c.value, c.err = fn()
+}
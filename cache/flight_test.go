@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go test ./cache -run Test_Group_Coalesces -v
+func Test_Group_Coalesces(t *testing.T) {
+	var g Group
+	var calls, shared int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		close(started)
+		<-release
+		return "value a", nil
+	}
+
+	var wg sync.WaitGroup
+	values := make([]interface{}, 10)
+	do := func(i int) {
+		defer wg.Done()
+		var s bool
+		values[i], s, _ = g.Do("a", fn)
+		if s {
+			atomic.AddInt32(&shared, 1)
+		}
+	}
+
+	// the first call is in flight before the others ask for the same key.
+	wg.Add(len(values))
+	go do(0)
+	<-started
+	for i := 1; i < len(values); i++ {
+		go do(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls)
+	assert.Equal(t, int32(9), shared)
+	for _, value := range values {
+		assert.Equal(t, "value a", value)
+	}
+}
+
+//go test ./cache -run Test_Group_Sequential -v
+func Test_Group_Sequential(t *testing.T) {
+	var g Group
+	calls := 0
+	fn := func() (interface{}, error) {
+		calls++
+		return nil, errors.New("failed")
+	}
+
+	// calls that don't overlap all run, errors included.
+	_, shared, err := g.Do("a", fn)
+	assert.False(t, shared)
+	assert.Equal(t, "failed", err.Error())
+	g.Do("a", fn)
+	g.Do("b", fn)
+	assert.Equal(t, 3, calls)
+}
+
+//go test ./cache -run Test_Group_Go -v
+func Test_Group_Go(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		return "value a", nil
+	}
+
+	// a single call runs in the background at a time, and callers of Do share its result.
+	assert.True(t, g.Go("a", fn))
+	assert.False(t, g.Go("a", fn))
+
+	done := make(chan interface{})
+	go func() {
+		value, _, _ := g.Do("a", func() (interface{}, error) { return "value b", nil })
+		done <- value
+	}()
+
+	close(release)
+	assert.Equal(t, "value a", <-done)
+
+	// once it's done, the next call runs.
+	assert.True(t, g.Go("a", func() (interface{}, error) { return nil, nil }))
+}
+
+//go test ./cache -run Test_Group_Panic -v
+func Test_Group_Panic(t *testing.T) {
+	var panicked []string
+	g := Group{Panicked: func(key string, err *PanicError) {
+		panicked = append(panicked, key)
+	}}
+	fn := func() (interface{}, error) {
+		panic("boom")
+	}
+
+	// a panic of fn is the error of the call, for its caller and anyone waiting on it.
+	value, _, err := g.Do("a", fn)
+	assert.Nil(t, value)
+	if assert.IsType(t, &PanicError{}, err) {
+		assert.Equal(t, "boom", err.(*PanicError).Value)
+		assert.NotEmpty(t, err.(*PanicError).Stack)
+	}
+
+	// in the background it doesn't take the process down.
+	release := make(chan struct{})
+	assert.True(t, g.Go("b", func() (interface{}, error) {
+		<-release
+		panic("boom")
+	}))
+
+	done := make(chan error)
+	go func() {
+		value, _, err := g.Do("b", func() (interface{}, error) { return "value b", nil })
+		assert.Nil(t, value)
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	assert.IsType(t, &PanicError{}, <-done)
+	assert.Equal(t, []string{"a", "b"}, panicked)
+
+	// the key is released for the next call.
+	value, _, err = g.Do("a", func() (interface{}, error) { return "value a", nil })
+	assert.Nil(t, err)
+	assert.Equal(t, "value a", value)
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"math"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// Memory is an in-memory LRU cache bounded by the total size of its values, rather than by their number.
+// It's safe for concurrent use. A nil *Memory caches nothing.
+type Memory struct {
+	mu       sync.Mutex
+	lru      *simplelru.LRU
+	bytes    int64
+	maxBytes int64
+	hits     uint64
+	misses   uint64
+}
+
+// memoryEntry is a cached value along with the size it was added with.
+type memoryEntry struct {
+	value interface{}
+	size  int64
+}
+
+// NewMemory returns a Memory cache holding up to maxBytes worth of values.
+func NewMemory(maxBytes int64) (*Memory, error) {
+	c := &Memory{maxBytes: maxBytes}
+
+	lru, err := simplelru.NewLRU(math.MaxInt32, func(key, value interface{}) {
+		c.bytes -= value.(*memoryEntry).size
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.lru = lru
+	return c, nil
+}
+
+// Get returns the value cached under key, marking it as recently used.
+func (c *Memory) Get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.lru.Get(key)
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	return e.(*memoryEntry).value, true
+}
+
+// Add caches value under key, replacing what was there, and evicts the least recently used values
+// until the cache fits in its size again. Values larger than the whole cache aren't cached.
+func (c *Memory) Add(key string, value interface{}, size int64) {
+	if c == nil || size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Remove(key)
+	c.lru.Add(key, &memoryEntry{value: value, size: size})
+	c.bytes += size
+
+	for c.bytes > c.maxBytes {
+		c.lru.RemoveOldest()
+	}
+}
+
+// Remove drops the value cached under key, if any.
+func (c *Memory) Remove(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Remove(key)
+}
+
+// Stats returns the current counters of the cache.
+func (c *Memory) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Entries:  c.lru.Len(),
+		Bytes:    c.bytes,
+		MaxBytes: c.maxBytes,
+	}
+}
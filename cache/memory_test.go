@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go test ./cache -run Test_Memory_GetAdd -v
+func Test_Memory_GetAdd(t *testing.T) {
+	c, err := NewMemory(100)
+	assert.Nil(t, err)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	c.Add("a", "value a", 10)
+	value, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "value a", value)
+
+	assert.Equal(t, Stats{Hits: 1, Misses: 1, Entries: 1, Bytes: 10, MaxBytes: 100}, c.Stats())
+}
+
+//go test ./cache -run Test_Memory_EvictsBytes -v
+func Test_Memory_EvictsBytes(t *testing.T) {
+	c, _ := NewMemory(100)
+
+	c.Add("a", "a", 40)
+	c.Add("b", "b", 40)
+	// a is used more recently than b.
+	c.Get("a")
+	c.Add("c", "c", 40)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	_, ok = c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, int64(80), c.Stats().Bytes)
+
+	// one large value can take several small ones out.
+	c.Add("d", "d", 90)
+	assert.Equal(t, 1, c.Stats().Entries)
+	assert.Equal(t, int64(90), c.Stats().Bytes)
+}
+
+//go test ./cache -run Test_Memory_Replace -v
+func Test_Memory_Replace(t *testing.T) {
+	c, _ := NewMemory(100)
+
+	c.Add("a", "small", 10)
+	c.Add("a", "large", 50)
+
+	value, _ := c.Get("a")
+	assert.Equal(t, "large", value)
+	assert.Equal(t, 1, c.Stats().Entries)
+	assert.Equal(t, int64(50), c.Stats().Bytes)
+
+	c.Remove("a")
+	assert.Equal(t, Stats{Hits: 1, MaxBytes: 100}, c.Stats())
+}
+
+//go test ./cache -run Test_Memory_TooLarge -v
+func Test_Memory_TooLarge(t *testing.T) {
+	c, _ := NewMemory(100)
+
+	c.Add("a", "a", 10)
+	c.Add("b", "b", 101)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+}
+
+//go test ./cache -run Test_Memory_Nil -v
+func Test_Memory_Nil(t *testing.T) {
+	var c *Memory
+
+	c.Add("a", "a", 10)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	c.Remove("a")
+	assert.Equal(t, Stats{}, c.Stats())
+}
@@ -0,0 +1,71 @@
+package cache
+
+import "sync/atomic"
+
+// Tiered stacks caches, the fastest first. Values are looked up tier by tier, and copied into the tiers above
+// the one they were found in. Values are added to, and removed from, every tier.
+// A Tiered without tiers caches nothing.
+type Tiered struct {
+	tiers  []Cache
+	sizeOf func(value interface{}) int64
+	hits   uint64
+	misses uint64
+}
+
+// NewTiered returns a cache made of tiers. sizeOf gives the size values found in a lower tier are copied up with.
+func NewTiered(sizeOf func(value interface{}) int64, tiers ...Cache) *Tiered {
+	return &Tiered{tiers: tiers, sizeOf: sizeOf}
+}
+
+// Get returns the value cached under key in the first tier that has it.
+func (c *Tiered) Get(key string) (interface{}, bool) {
+	for i, tier := range c.tiers {
+		value, ok := tier.Get(key)
+		if !ok {
+			continue
+		}
+
+		for _, upper := range c.tiers[:i] {
+			upper.Add(key, value, c.sizeOf(value))
+		}
+
+		atomic.AddUint64(&c.hits, 1)
+		return value, true
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	return nil, false
+}
+
+// Add caches value under key in every tier.
+func (c *Tiered) Add(key string, value interface{}, size int64) {
+	for _, tier := range c.tiers {
+		tier.Add(key, value, size)
+	}
+}
+
+// Remove drops the value cached under key from every tier.
+func (c *Tiered) Remove(key string) {
+	for _, tier := range c.tiers {
+		tier.Remove(key)
+	}
+}
+
+// Stats returns the hits and misses of the whole stack, the entries and bytes summed over its tiers,
+// and the stats of each tier.
+func (c *Tiered) Stats() Stats {
+	stats := Stats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
+
+	for _, tier := range c.tiers {
+		s := tier.Stats()
+		stats.Entries += s.Entries
+		stats.Bytes += s.Bytes
+		stats.MaxBytes += s.MaxBytes
+		stats.Tiers = append(stats.Tiers, s)
+	}
+
+	return stats
+}
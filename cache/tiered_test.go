@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go test ./cache -run Test_Tiered_Promotes -v
+func Test_Tiered_Promotes(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	memory, _ := NewMemory(1000)
+	disk := newTestDisk(t, dir, 10000, LRU)
+	c := NewTiered(func(value interface{}) int64 { return int64(len(value.(*diskValue).Data)) }, memory, disk)
+
+	c.Add("a", &diskValue{Data: []byte("image a")}, 7)
+	assert.Equal(t, 1, memory.Stats().Entries)
+	assert.Equal(t, 1, disk.Stats().Entries)
+
+	// values only on disk, like after a restart, are copied into memory.
+	memory.Remove("a")
+	value, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("image a"), value.(*diskValue).Data)
+	assert.Equal(t, int64(7), memory.Stats().Bytes)
+
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), disk.Stats().Hits)
+
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, 2, len(stats.Tiers))
+
+	c.Remove("a")
+	assert.Equal(t, 0, c.Stats().Entries)
+}
+
+//go test ./cache -run Test_Tiered_Empty -v
+func Test_Tiered_Empty(t *testing.T) {
+	c := NewTiered(nil)
+
+	c.Add("a", "a", 1)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, Stats{Misses: 1}, c.Stats())
+}
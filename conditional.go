@@ -0,0 +1,111 @@
+package main
+
+// conditional.go answers conditional requests, so browsers and Fastly can revalidate images cheaply.
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bvchevez/imageprocess/image"
+
+	cnf "github.com/bvchevez/imageprocess/config"
+)
+
+// ImageETag returns the strong ETag of the image pipelineID outputs from source. When the origin sent an ETag,
+// it's derived from the pipeline and that ETag, so it's known before processing. Otherwise it hashes data, the output.
+func ImageETag(pipelineID string, source *Source, data []byte) string {
+	if source != nil && source.ETag != "" {
+		return fmt.Sprintf(`"%x"`, sha1.Sum([]byte(pipelineID+" "+source.ETag)))
+	}
+
+	return fmt.Sprintf(`"%x"`, sha1.Sum(data))
+}
+
+// CachedValidators returns an image carrying only the validators of the image site, path and params output,
+// when they're known without processing it: from the output cache, or from the origin validators of a fresh source.
+func CachedValidators(site, path, params string) (*image.Image, bool) {
+	// analyze and debug requests don't respond with the image.
+	if image.IsAnalyze(params) || image.IsDebug(params) {
+		return nil, false
+	}
+
+	site = cnf.NormalizeSite(site)
+	if !IsSupportedSite(site) {
+		return nil, false
+	}
+
+	pipelineID := PolicyForSite(site).PipelineID(site, path, params)
+	if cached, ok := outputCache.Get(pipelineID); ok {
+		img := cached.(*image.Image)
+		return &image.Image{ETag: img.ETag, LastModified: img.LastModified}, img.ETag != "" || img.LastModified != ""
+	}
+
+	o, err := SiteOrigin(site)
+	if err != nil {
+		return nil, false
+	}
+
+	source, ok := FreshSource(o, path)
+	if !ok || (source.ETag == "" && source.LastModified == "") {
+		return nil, false
+	}
+
+	img := &image.Image{LastModified: source.LastModified}
+	if source.ETag != "" {
+		img.ETag = ImageETag(pipelineID, source, nil)
+	}
+
+	return img, true
+}
+
+// isConditional reports whether req asks for the image only if it changed.
+func isConditional(req *http.Request) bool {
+	return req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+}
+
+// isNotModified reports whether img didn't change since the version req has.
+// If-None-Match takes precedence over If-Modified-Since, as in RFC 7232.
+func isNotModified(req *http.Request, img *image.Image) bool {
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		if img.ETag == "" {
+			return false
+		}
+
+		// If-None-Match compares weakly, Fastly weakens the ETags of the responses it compresses.
+		for _, etag := range strings.Split(match, ",") {
+			etag = strings.TrimSpace(etag)
+			if etag == "*" || strings.TrimPrefix(etag, "W/") == img.ETag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if since := req.Header.Get("If-Modified-Since"); since != "" && img.LastModified != "" {
+		sinceTime, err := http.ParseTime(since)
+		if err != nil {
+			return false
+		}
+
+		modified, err := http.ParseTime(img.LastModified)
+		if err != nil {
+			return false
+		}
+
+		return !modified.After(sinceTime)
+	}
+
+	return false
+}
+
+// notModifiedResponse is the response to a conditional request for img, when it didn't change.
+func notModifiedResponse(img *image.Image, policy *Policy) *Response {
+	return &Response{
+		Code:   http.StatusNotModified,
+		Data:   nil,
+		Image:  img,
+		Policy: policy,
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bvchevez/imageprocess/cache"
+	"github.com/bvchevez/imageprocess/image"
+	"github.com/bvchevez/imageprocess/origin"
+	"github.com/stretchr/testify/assert"
+)
+
+// go test -run Test_ImageETag -v
+func Test_ImageETag(t *testing.T) {
+	// outputs of sources without an ETag are hashed.
+	assert.Equal(t, ImageETag("id", &Source{}, []byte("a")), ImageETag("id", nil, []byte("a")))
+	assert.NotEqual(t, ImageETag("id", nil, []byte("a")), ImageETag("id", nil, []byte("b")))
+
+	// with an origin ETag, the output doesn't matter.
+	source := &Source{ETag: `"v1"`}
+	assert.Equal(t, ImageETag("id", source, nil), ImageETag("id", source, []byte("a")))
+	assert.NotEqual(t, ImageETag("id", source, nil), ImageETag("other id", source, nil))
+	assert.NotEqual(t, ImageETag("id", source, nil), ImageETag("id", &Source{ETag: `"v2"`}, nil))
+	assert.Regexp(t, `^"[0-9a-f]{40}"$`, ImageETag("id", source, nil))
+}
+
+// go test -run Test_isNotModified -v
+func Test_isNotModified(t *testing.T) {
+	img := &image.Image{ETag: `"abc"`, LastModified: "Wed, 21 Oct 2015 07:28:00 GMT"}
+
+	for _, c := range []struct {
+		header, value string
+		notModified   bool
+	}{
+		{"If-None-Match", `"abc"`, true},
+		{"If-None-Match", `"xyz", W/"abc"`, true},
+		{"If-None-Match", `*`, true},
+		{"If-None-Match", `"xyz"`, false},
+		{"If-Modified-Since", "Wed, 21 Oct 2015 07:28:00 GMT", true},
+		{"If-Modified-Since", "Thu, 22 Oct 2015 07:28:00 GMT", true},
+		{"If-Modified-Since", "Tue, 20 Oct 2015 07:28:00 GMT", false},
+		{"If-Modified-Since", "yesterday", false},
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set(c.header, c.value)
+		assert.Equal(t, c.notModified, isNotModified(r, img), c.header+": "+c.value)
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since.
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("If-None-Match", `"xyz"`)
+	r.Header.Set("If-Modified-Since", "Thu, 22 Oct 2015 07:28:00 GMT")
+	assert.False(t, isNotModified(r, img))
+
+	// without validators, images are always modified.
+	r.Header.Del("If-None-Match")
+	assert.False(t, isNotModified(r, &image.Image{}))
+}
+
+// go test -run Test_Controllers_conditionalOutputCache -v
+func Test_Controllers_conditionalOutputCache(t *testing.T) {
+	resetConfig()
+	if config.port == nil {
+		config.Init()
+	}
+	memory, _ := cache.NewMemory(1024)
+	outputCache = cache.NewExpiring(memory, 0, 0, imageRendered)
+	defer func() { outputCache = cache.NewExpiring(cache.NewTiered(nil), 0, 0, imageRendered) }()
+
+	cached := &image.Image{Data: []byte("cached"), Type: image.JPEG, Size: 6, ETag: `"abc"`, LastModified: "Wed, 21 Oct 2015 07:28:00 GMT"}
+	outputCache.Add(PolicyForSite("caranddriver").PipelineID("caranddriver", "/a.jpg", "resize=100:*"), cached, 6)
+
+	for _, controller := range []struct {
+		handle func(http.ResponseWriter, *http.Request)
+		path   string
+	}{
+		{indexController, "/caranddriver/a.jpg?resize=100:*"},
+		{hipsController, "/hips/caranddriver/a.jpg?resize=100:*"},
+	} {
+		for _, method := range []string{"GET", "HEAD"} {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(method, controller.path, nil)
+			r.Header.Set("If-None-Match", `"abc"`)
+			controller.handle(w, r)
+			assert.Equal(t, http.StatusNotModified, w.Code)
+			assert.Equal(t, `"abc"`, w.Header().Get("ETag"))
+			assert.Equal(t, "Wed, 21 Oct 2015 07:28:00 GMT", w.Header().Get("Last-Modified"))
+			assert.Equal(t, "", w.Body.String())
+
+			// other versions get the image, with its validators.
+			w = httptest.NewRecorder()
+			r.Header.Set("If-None-Match", `"xyz"`)
+			controller.handle(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, `"abc"`, w.Header().Get("ETag"))
+			assert.Equal(t, "Wed, 21 Oct 2015 07:28:00 GMT", w.Header().Get("Last-Modified"))
+		}
+	}
+}
+
+// go test -run Test_Controllers_conditionalStale -v
+func Test_Controllers_conditionalStale(t *testing.T) {
+	resetConfig()
+	if config.port == nil {
+		config.Init()
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	f, _ := ioutil.TempFile("", "origins")
+	defer os.Remove(f.Name())
+	ioutil.WriteFile(f.Name(), []byte(`{"test-origin": {"type": "http", "url": "`+server.URL+`"}}`), 0644)
+	assert.Nil(t, origin.Load(f.Name()))
+
+	memory, _ := cache.NewMemory(1024)
+	outputCache = cache.NewExpiring(memory, time.Minute, time.Hour, imageRendered)
+	defer func() {
+		outputCache = cache.NewExpiring(cache.NewTiered(nil), 0, 0, imageRendered)
+		ioutil.WriteFile(f.Name(), []byte(`{}`), 0644)
+		origin.Load(f.Name())
+	}()
+
+	pipelineID := PolicyForSite("test-origin").PipelineID("test-origin", "/a.jpg", "resize=100:*")
+	stale := &image.Image{Data: []byte("stale"), Type: image.JPEG, Size: 5, ETag: `"abc"`, Rendered: time.Now().Add(-time.Hour)}
+	outputCache.Add(pipelineID, stale, 5)
+
+	// revalidating a stale image keeps it from being cached for long.
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/test-origin/a.jpg?resize=100:*", nil)
+	r.Header.Set("If-None-Match", `"abc"`)
+	indexController(w, r)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	assert.Equal(t, `110 - "Response is Stale"`, w.Header().Get("Warning"))
+	assert.Equal(t, errorCacheControl, w.Header().Get("Cache-Control"))
+	assert.Equal(t, errorCacheControl, w.Header().Get("Surrogate-Control"))
+
+	// wait for the refresh in the background.
+	pipelines.Do(pipelineID, func() (interface{}, error) { return nil, nil })
+}
+
+// go test -run Test_CachedValidators_source -v
+func Test_CachedValidators_source(t *testing.T) {
+	resetConfig()
+	sourceCache, _ = cache.NewMemory(1024)
+	sourceCacheTTL = time.Hour
+	defer func() { sourceCache = cache.NewTiered(nil) }()
+
+	_, ok := CachedValidators("caranddriver", "/a.jpg", "resize=100:*")
+	assert.False(t, ok)
+
+	source := &Source{Data: []byte("source"), ETag: `"v1"`, LastModified: "Wed, 21 Oct 2015 07:28:00 GMT", Fetched: time.Now()}
+	sourceCache.Add(config.GetSite("caranddriver")+"/a.jpg", source, 6)
+
+	// sizes of a fresh source get their ETag before they're processed.
+	img, ok := CachedValidators("caranddriver", "/a.jpg", "resize=100:*")
+	assert.True(t, ok)
+	assert.Equal(t, ImageETag(PolicyForSite("caranddriver").PipelineID("caranddriver", "/a.jpg", "resize=100:*"), source, nil), img.ETag)
+	assert.Equal(t, source.LastModified, img.LastModified)
+
+	_, ok = CachedValidators("caranddriver", "/a.jpg", "resize=100:*&analyze=smartcrop")
+	assert.False(t, ok)
+
+	// expired sources are revalidated first.
+	sourceCacheTTL = 0
+	_, ok = CachedValidators("caranddriver", "/a.jpg", "resize=100:*")
+	assert.False(t, ok)
+}
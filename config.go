@@ -4,19 +4,33 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
+	"github.com/bvchevez/imageprocess/cache"
 	cnf "github.com/bvchevez/imageprocess/config"
+	"github.com/bvchevez/imageprocess/helper"
+	"github.com/bvchevez/imageprocess/image"
+	"github.com/bvchevez/imageprocess/origin"
 	log "github.com/Sirupsen/logrus"
 	"github.com/rakyll/globalconf"
 )
 
 var (
 	healthcheckToken string
+	debugToken       string
+	outputCache      = cache.NewExpiring(cache.NewTiered(nil), 0, 0, imageRendered) // outputCache holds processed images by pipeline id.
+	pipelines        = cache.Group{Panicked: logPanic}                              // pipelines coalesces identical image requests in flight, by pipeline id.
 	useSSL           bool
 	useCDN           bool
 	config           *Config
 
+	// errorCacheControl is the cache control of error responses, from error-cache-control.
+	errorCacheControl = "max-age=60"
+
 	// New Relic variables.
 	newRelicKey     string
 	newRelicAppName string
@@ -41,10 +55,30 @@ func InitConfigurations(configFile string) error {
 	newRelicKey = os.Getenv("NEW_RELIC_LICENSE_KEY")
 	newRelicAppName = os.Getenv("NEW_RELIC_APP_NAME")
 	healthcheckToken = os.Getenv("HEALTHCHECK_TOKEN")
+	debugToken = os.Getenv("DEBUG_TOKEN")
+	errorCacheControl = *config.errorCache
 	useSSL = (os.Getenv("USE_SSL") == "1")
 	useCDN = (os.Getenv("USE_CDN") == "1")
 
-	cnf.Init(useCDN)
+	if err := checkGifDefaults(); err != nil {
+		return err
+	}
+
+	return loadSites()
+}
+
+// checkGifDefaults returns an error if default-gif-colors isn't 0 or a color count gifsicle accepts,
+// or if default-gif-lossy is negative.
+func checkGifDefaults() error {
+	colors, err := strconv.ParseInt(*config.defaultGifColors, 10, 64)
+	if err != nil || colors < 0 || colors == 1 || colors > 256 {
+		return fmt.Errorf("default-gif-colors must be 0 or between 2 and 256, not [%s]", *config.defaultGifColors)
+	}
+
+	lossy, err := strconv.ParseInt(*config.defaultGifLossy, 10, 64)
+	if err != nil || lossy < 0 {
+		return fmt.Errorf("default-gif-lossy must be 0 or more, not [%s]", *config.defaultGifLossy)
+	}
 
 	return nil
 }
@@ -63,11 +97,37 @@ type Config struct {
 	sentryProjectId  *string
 	surrogateControl *string
 	cacheControl     *string
+	errorCache       *string
 	throttle         *string
 	concurrency      *string
 	burst            *string
 	defaultQuality   *string
+	defaultGifColors *string
+	defaultGifLossy  *string
 	bicubicThreshold *string
+	haarCascadesPath *string
+	cropProfiles     *string
+	sites            *string
+	sitesReload      *string
+	origins          *string
+	fallbacks        *string
+	originConnect    *string
+	originRead       *string
+	originMaxSize    *string
+	originRetries    *string
+	originRetryWait  *string
+	breakerFailures  *string
+	breakerCooldown  *string
+	saliencyCache    *string
+	outputCache      *string
+	sourceCache      *string
+	sourceCacheTTL   *string
+	outputCacheTTL   *string
+	outputGrace      *string
+	outputDiskCache  *string
+	sourceDiskCache  *string
+	diskCacheDir     *string
+	diskCachePolicy  *string
 
 	//server options
 	serverReadTimeout  *string
@@ -78,6 +138,7 @@ func (c *Config) Init() {
 	c.port = flag.String("port", "6116", "Port we're listening off")
 	c.surrogateControl = flag.String("surrogate-control", "max-age=31536000", "Cache control for Fastly")
 	c.cacheControl = flag.String("cache-control", "max-age=31536000", "Cache control for browser")
+	c.errorCache = flag.String("error-cache-control", "max-age=60", "Cache control of error responses, for Fastly and browsers.")
 	c.logLevel = flag.String("log-level", "development", "Log level")
 	c.sentryKey = flag.String("sentry-key", "", "Sentry account key")
 	c.sentrySecret = flag.String("sentry-secret", "", "Sentry account secret")
@@ -88,7 +149,32 @@ func (c *Config) Init() {
 	c.serverReadTimeout = flag.String("server-read-timeout", "60", "Throttle max burst size.")
 	c.serverWriteTimeout = flag.String("server-write-timeout", "60", "Throttle max burst size.")
 	c.defaultQuality = flag.String("default-quality", "95", "Default output-quality for images.")
+	c.defaultGifColors = flag.String("default-gif-colors", "0", "Default number of colors (2-256) for gifs. '0' derives it from default-quality.")
+	c.defaultGifLossy = flag.String("default-gif-lossy", "0", "Default lossy compression level for gifs. '0' means lossless.")
 	c.bicubicThreshold = flag.String("bicubic-threshold", "300", "Minimum pixels in width we want before converting to bicubic.")
+	c.haarCascadesPath = flag.String("haarcascades-path", "data/haarcascades/", "Directory of the haar cascades used for face detection.")
+	c.cropProfiles = flag.String("crop-profiles", "", "JSON file of named smartcrop profiles and the sites using them. Empty uses smartcrop defaults everywhere.")
+	c.origins = flag.String("origins", "", "JSON file of the origins of sites not downloaded from their domain over http(s), like S3 buckets or local directories.")
+	c.sites = flag.String("sites", "config/sites.json", "JSON file of the sites images are served for, and the domains their images are downloaded from.")
+	c.sitesReload = flag.String("sites-reload-interval", "10", "Seconds between checks of the sites file for changes, reloaded when it changed. '0' only reloads it on SIGHUP.")
+	c.fallbacks = flag.String("fallbacks", "", "JSON file of the images sites serve instead of their missing images. Empty serves 404s.")
+	c.originConnect = flag.String("origin-connect-timeout", "5", "Seconds to connect to an origin before giving up.")
+	c.originRead = flag.String("origin-read-timeout", "30", "Seconds to read the response of an origin before giving up.")
+	c.originMaxSize = flag.String("origin-max-size", "50", "Megabytes of the largest source image downloaded. '0' means no limit.")
+	c.originRetries = flag.String("origin-retries", "2", "How many times downloads failing with a 5xx are tried again.")
+	c.originRetryWait = flag.String("origin-retry-wait", "100", "Milliseconds before the first retry of a download, doubled for each retry after.")
+	c.breakerFailures = flag.String("origin-breaker-failures", "5", "Downloads in a row failing with a 5xx, a connection error or a timeout that stop downloads from the site's origin. 0 never stops them.")
+	c.breakerCooldown = flag.String("origin-breaker-cooldown", "30", "Seconds downloads from a failing origin stay stopped, before one is tried again.")
+	c.outputCache = flag.String("output-cache-size", "256", "Megabytes of processed images kept in memory, to serve repeated requests without processing them again. '0' disables the cache.")
+	c.outputCacheTTL = flag.String("output-cache-ttl", "86400", "Seconds processed images are served from the cache before they're processed again. '0' never processes them again.")
+	c.outputGrace = flag.String("output-cache-grace", "86400", "Seconds expired processed images are still served, while they're processed again or when processing them fails.")
+	c.sourceCache = flag.String("source-cache-size", "256", "Megabytes of source images kept in memory, so other sizes of an image aren't downloaded again. '0' disables the cache.")
+	c.sourceCacheTTL = flag.String("source-cache-ttl", "60", "Seconds source images are used before they're revalidated with their origin.")
+	c.diskCacheDir = flag.String("disk-cache-dir", "", "Directory processed and source images are cached in, to keep them across restarts. Empty disables the disk cache.")
+	c.diskCachePolicy = flag.String("disk-cache-policy", "lru", "How the disk cache evicts images once full: 'lru' (least recently used) or 'lfu' (least frequently used).")
+	c.outputDiskCache = flag.String("output-disk-cache-size", "1024", "Megabytes of processed images kept in disk-cache-dir. '0' disables the disk cache of processed images.")
+	c.sourceDiskCache = flag.String("source-disk-cache-size", "1024", "Megabytes of source images kept in disk-cache-dir. '0' disables the disk cache of source images.")
+	c.saliencyCache = flag.String("saliency-cache-size", "32", "Number of images whose smartcrop analysis is kept for auto crops of other sizes. '0' disables the cache.")
 }
 
 // getSite takes a string representing the site to get
@@ -99,10 +185,8 @@ func (c *Config) GetSite(site string) string {
 		scheme = "https"
 	}
 
-	for k, v := range cnf.AllowedSites {
-		if v == site {
-			return fmt.Sprintf("%s://%s", scheme, k)
-		}
+	if domain, ok := cnf.Sites().Domain(site); ok {
+		return fmt.Sprintf("%s://%s", scheme, domain)
 	}
 
 	return fmt.Sprintf("%s://%s", scheme, site)
@@ -120,21 +204,138 @@ func InitLogLevel() {
 	}
 }
 
-// IsSupportedSite makes sure that routeSite is in the whitelist of sites supported.
-func IsSupportedSite(routeSite string) bool {
+// InitFaceDetection points face detection at the configured haar cascades directory, sets up the saliency cache
+// and loads the crop profiles.
+func InitFaceDetection() {
+	image.HaarCascadesPath = *config.haarCascadesPath
+
+	if err := image.InitSaliencyCache(helper.String2Int(*config.saliencyCache)); err != nil {
+		log.WithFields(log.Fields{
+			"saliency_cache_size": *config.saliencyCache,
+			"error":               err.Error(),
+		}).Fatal("Fatal Error! Failed to set up the saliency cache.")
+	}
+
+	if *config.cropProfiles == "" {
+		return
+	}
+
+	if err := image.LoadCropProfiles(*config.cropProfiles); err != nil {
+		log.WithFields(log.Fields{
+			"crop_profiles": *config.cropProfiles,
+			"error":         err.Error(),
+		}).Fatal("Fatal Error! Failed to load crop profiles.")
+	}
+}
+
+// InitOrigins sets the limits of downloads from origins, and loads the origins of the sites that have one.
+func InitOrigins() {
+	origin.Configure(origin.Options{
+		ConnectTimeout: time.Duration(helper.String2Int64(*config.originConnect)) * time.Second,
+		ReadTimeout:    time.Duration(helper.String2Int64(*config.originRead)) * time.Second,
+		MaxBytes:       helper.String2Int64(*config.originMaxSize) * 1024 * 1024,
+		Retries:        helper.String2Int(*config.originRetries),
+		RetryWait:      time.Duration(helper.String2Int64(*config.originRetryWait)) * time.Millisecond,
+		AllowRedirect:  IsAllowedRedirect,
+
+		BreakerFailures: helper.String2Int(*config.breakerFailures),
+		BreakerCooldown: time.Duration(helper.String2Int64(*config.breakerCooldown)) * time.Second,
+	})
+
+	if *config.origins == "" {
+		return
+	}
 
-	for k, v := range cnf.AllowedSites {
-		// if route is a domain, we check if it exists as a map key.
-		if k == routeSite {
-			return true
+	if err := origin.Load(*config.origins); err != nil {
+		log.WithFields(log.Fields{
+			"origins": *config.origins,
+			"error":   err.Error(),
+		}).Fatal("Fatal Error! Failed to load origins.")
+	}
+}
+
+// InitFallbacks loads the images sites serve instead of their missing images.
+func InitFallbacks() {
+	if *config.fallbacks == "" {
+		return
+	}
+
+	if err := LoadFallbacks(*config.fallbacks); err != nil {
+		log.WithFields(log.Fields{
+			"fallbacks": *config.fallbacks,
+			"error":     err.Error(),
+		}).Fatal("Fatal Error! Failed to load fallbacks.")
+	}
+}
+
+// InitCaches sets up the caches of processed images and of their sources.
+func InitCaches() {
+	outputCache = cache.NewExpiring(
+		newCache("output", *config.outputCache, *config.outputDiskCache, imageSize,
+			cache.Gob(func() interface{} { return &image.Image{} })),
+		time.Duration(helper.String2Int64(*config.outputCacheTTL))*time.Second,
+		time.Duration(helper.String2Int64(*config.outputGrace))*time.Second,
+		imageRendered)
+	sourceCache = newCache("source", *config.sourceCache, *config.sourceDiskCache, sourceSize,
+		cache.Gob(func() interface{} { return &Source{} }))
+	sourceCacheTTL = time.Duration(helper.String2Int64(*config.sourceCacheTTL)) * time.Second
+}
+
+// newCache stacks a memory cache of memorySize megabytes on a disk cache of diskSize megabytes,
+// stored under disk-cache-dir/name. Tiers of size 0 are left out, and so is the disk when there's no disk-cache-dir.
+func newCache(name, memorySize, diskSize string, sizeOf func(interface{}) int64, codec cache.Codec) cache.Cache {
+	tiers := []cache.Cache{}
+
+	if megabytes := helper.String2Int64(memorySize); megabytes > 0 {
+		memory, err := cache.NewMemory(megabytes * 1024 * 1024)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"cache": name,
+				"size":  memorySize,
+				"error": err.Error(),
+			}).Fatal("Fatal Error! Failed to set up a memory cache.")
 		}
+		tiers = append(tiers, memory)
+	}
 
-		// if route is a hips path, we check if it exists as a map value.
-		if v == routeSite {
-			return true
+	if megabytes := helper.String2Int64(diskSize); megabytes > 0 && *config.diskCacheDir != "" {
+		dir := filepath.Join(*config.diskCacheDir, name)
+		disk, err := cache.NewDisk(dir, megabytes*1024*1024, cache.Policy(*config.diskCachePolicy), codec)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"cache":  name,
+				"size":   diskSize,
+				"dir":    dir,
+				"policy": *config.diskCachePolicy,
+				"error":  err.Error(),
+			}).Fatal("Fatal Error! Failed to set up a disk cache.")
 		}
+		tiers = append(tiers, disk)
 	}
-	return false
+
+	return cache.NewTiered(sizeOf, tiers...)
+}
+
+// IsAllowedRedirect tells whether origins may redirect downloads to u: only to the domains of the allowed sites.
+func IsAllowedRedirect(u *url.URL) bool {
+	return cnf.Sites().AllowsURL(u)
+}
+
+// CheckSite returns why routeSite isn't supported, if it isn't.
+func CheckSite(routeSite string) error {
+	// sites with an origin of their own are supported.
+	if _, ok := origin.ForSite(routeSite); ok {
+		return nil
+	}
+
+	// route is either a site, one of its domains, or a domain matching one of its patterns.
+	_, err := cnf.Sites().Resolve(routeSite)
+	return err
+}
+
+// IsSupportedSite makes sure that routeSite is in the whitelist of sites supported.
+func IsSupportedSite(routeSite string) bool {
+	return CheckSite(routeSite) == nil
 }
 
 func init() {
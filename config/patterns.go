@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// pattern is a glob of the domains of a site, like *.h-cdn.co or amv-prod-*.s3.amazonaws.com. Globs are
+// matched like path.Match, so * matches any characters but /.
+type pattern struct {
+	glob    string
+	site    *Site
+	literal int // literal is how many characters of glob aren't wildcards, the more the more specific.
+	order   int // order is where glob is in the sites file, the earlier pattern wins between equally specific ones.
+}
+
+// isPattern tells whether domain is a glob, rather than a domain.
+func isPattern(domain string) bool {
+	return strings.ContainsAny(domain, `*?[\`)
+}
+
+// newPattern compiles glob, a pattern of site.
+func newPattern(glob string, site *Site, order int) (*pattern, error) {
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("site [%s] has an invalid pattern [%s]: %s", site.Name, glob, err)
+	}
+
+	p := &pattern{glob: glob, site: site, order: order}
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '*', '?':
+		case '[':
+			// a character class is a wildcard, however narrow.
+			i += strings.IndexByte(glob[i:], ']')
+		case '\\':
+			i++
+			p.literal++
+		default:
+			p.literal++
+		}
+	}
+
+	// patterns matching any domain, like * or *.*, would let images be downloaded from anywhere.
+	if strings.Trim(glob, "*?.") == "" {
+		return nil, fmt.Errorf("site [%s] has a pattern matching any domain [%s]", site.Name, glob)
+	}
+
+	return p, nil
+}
+
+// suffix returns the domain suffix of p, when p is a suffix pattern like *.h-cdn.co.
+func (p *pattern) suffix() (string, bool) {
+	if !strings.HasPrefix(p.glob, "*.") || isPattern(p.glob[1:]) {
+		return "", false
+	}
+
+	return p.glob[1:], true
+}
+
+// beats tells whether p takes precedence over q, when a domain matches both.
+func (p *pattern) beats(q *pattern) bool {
+	if q == nil {
+		return true
+	}
+	if p.literal != q.literal {
+		return p.literal > q.literal
+	}
+
+	return p.order < q.order
+}
+
+// patterns are the compiled patterns of a registry. Suffix patterns, the most common, are looked up by
+// the suffixes of a domain, the other patterns are matched one by one, most specific first.
+type patterns struct {
+	suffixes map[string]*pattern
+	globs    []*pattern
+}
+
+// add adds p, unless another site has the same pattern.
+func (ps *patterns) add(p *pattern) error {
+	if suffix, ok := p.suffix(); ok {
+		if other, ok := ps.suffixes[suffix]; ok {
+			return fmt.Errorf("pattern [%s] is of both sites [%s] and [%s]", p.glob, other.site.Name, p.site.Name)
+		}
+		ps.suffixes[suffix] = p
+		return nil
+	}
+
+	for _, other := range ps.globs {
+		if other.glob == p.glob {
+			return fmt.Errorf("pattern [%s] is of both sites [%s] and [%s]", p.glob, other.site.Name, p.site.Name)
+		}
+	}
+	ps.globs = append(ps.globs, p)
+	sort.Slice(ps.globs, func(i, j int) bool {
+		return ps.globs[i].beats(ps.globs[j])
+	})
+
+	return nil
+}
+
+// match returns the pattern domain matches that takes precedence, or nil if it matches none.
+func (ps *patterns) match(domain string) *pattern {
+	var best *pattern
+
+	// the longest suffix is the most specific. Suffixes are looked up at each dot, up to the first /
+	// since * doesn't match it.
+	for i := 0; i < len(domain) && domain[i] != '/'; i++ {
+		if domain[i] != '.' {
+			continue
+		}
+		if p, ok := ps.suffixes[domain[i:]]; ok {
+			best = p
+			break
+		}
+	}
+
+	for _, p := range ps.globs {
+		if !p.beats(best) {
+			break
+		}
+		if ok, _ := path.Match(p.glob, domain); ok {
+			return p
+		}
+	}
+
+	return best
+}
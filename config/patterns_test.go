@@ -0,0 +1,87 @@
+package config
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go test ./config -run Test_Registry_patterns -v
+func Test_Registry_patterns(t *testing.T) {
+	r, err := NewRegistry([]Site{
+		{Name: "hearst", Domain: "h-cdn.co", Aliases: []string{"*.h-cdn.co"}},
+		{Name: "caranddriver", Domain: "amv-prod-cad.s3.amazonaws.com", CDN: "cad.h-cdn.co", Aliases: []string{"*.cad.h-cdn.co"}},
+		{Name: "amv", Domain: "amv-prod.s3.amazonaws.com", Aliases: []string{"amv-prod-*.s3.amazonaws.com", "s3.amazonaws.com/amv-*"}},
+		{Name: "regional", Domain: "r.s3.amazonaws.com", Aliases: []string{"amv-*.s3.amazonaws.com"}},
+	}, false)
+	assert.Nil(t, err)
+
+	for route, site := range map[string]string{
+		// names and domains come before patterns.
+		"caranddriver": "caranddriver",
+		"cad.h-cdn.co": "caranddriver",
+		// the longest suffix wins.
+		"uk.h-cdn.co":                   "hearst",
+		"a.b.h-cdn.co":                  "hearst",
+		"uk.cad.h-cdn.co":               "caranddriver",
+		"a.b.cad.h-cdn.co":              "caranddriver",
+		"amv-prod-cos.s3.amazonaws.com": "amv",
+		"amv-dev.s3.amazonaws.com":      "regional",
+		"s3.amazonaws.com/amv-prod":     "amv",
+	} {
+		s, err := r.Resolve(route)
+		if assert.Nil(t, err, route) {
+			assert.Equal(t, site, s.Name, route)
+		}
+	}
+
+	// * doesn't match /.
+	for _, route := range []string{"h-cdn.co.evil.com", "a/b.h-cdn.co", "amv-a/b.s3.amazonaws.com", "s3.amazonaws.com/cos"} {
+		assert.False(t, r.IsAllowed(route), route)
+	}
+
+	for u, allowed := range map[string]bool{
+		"https://uk.h-cdn.co/a.jpg":                   true,
+		"https://s3.amazonaws.com/amv-prod/a.jpg":     true,
+		"https://s3.amazonaws.com/amv-prod":           false,
+		"https://s3.amazonaws.com/hmg-prod/a.jpg":     false,
+		"https://amv-prod-cos.s3.amazonaws.com/a.jpg": true,
+	} {
+		parsed, _ := url.Parse(u)
+		assert.Equal(t, allowed, r.AllowsURL(parsed), u)
+	}
+}
+
+//go test ./config -run Test_Registry_patterns_precedence -v
+func Test_Registry_patterns_precedence(t *testing.T) {
+	r, err := NewRegistry([]Site{
+		{Name: "a", Domain: "a.com", Aliases: []string{"img-?.example.com"}},
+		{Name: "b", Domain: "b.com", Aliases: []string{"img-*.example.com"}},
+		{Name: "c", Domain: "c.com", Aliases: []string{"*.example.com"}},
+	}, false)
+	assert.Nil(t, err)
+
+	// equally specific patterns go to the site listed first, more specific ones win.
+	s, _ := r.Resolve("img-1.example.com")
+	assert.Equal(t, "a", s.Name)
+	s, _ = r.Resolve("img-12.example.com")
+	assert.Equal(t, "b", s.Name)
+	s, _ = r.Resolve("cdn.example.com")
+	assert.Equal(t, "c", s.Name)
+}
+
+//go test ./config -run Test_NewRegistry_invalidPattern -v
+func Test_NewRegistry_invalidPattern(t *testing.T) {
+	for name, sites := range map[string][]Site{
+		"domain":    {{Name: "a", Domain: "*.a.com"}},
+		"cdn":       {{Name: "a", Domain: "a.com", CDN: "*.a.com"}},
+		"malformed": {{Name: "a", Domain: "a.com", Aliases: []string{"[a.com"}}},
+		"any":       {{Name: "a", Domain: "a.com", Aliases: []string{"*.*"}}},
+		"duplicate": {{Name: "a", Domain: "a.com", Aliases: []string{"*.c.com"}}, {Name: "b", Domain: "b.com", Aliases: []string{"*.c.com"}}},
+		"glob":      {{Name: "a", Domain: "a.com", Aliases: []string{"c-*.com"}}, {Name: "b", Domain: "b.com", Aliases: []string{"c-*.com"}}},
+	} {
+		_, err := NewRegistry(sites, false)
+		assert.NotNil(t, err, name)
+	}
+}
@@ -0,0 +1,313 @@
+// Package config holds the site registry: the sites images are served for, and the domains their images come from.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// registry is the current *Registry, swapped whole when the sites file is reloaded.
+var registry atomic.Value
+
+// Site is how a site is set up in the sites file, a json list of sites like:
+//  [
+//    {"site": "caranddriver", "domain": "amv-prod-cad.s3.amazonaws.com", "cdn": "cad.h-cdn.co"},
+//    {"site": "hmg-prod", "domain": "hmg-prod.s3.amazonaws.com", "aliases": ["s3.amazonaws.com/hmg-prod"]}
+//  ]
+//
+// Requests name either the site, like /caranddriver/assets/a.jpg, or one of its domains, like
+// /cad.h-cdn.co/assets/a.jpg. Requests naming the site download from its domain, or from its cdn
+// when the registry uses CDNs. Requests naming a domain download from that domain.
+//
+// Aliases may be patterns, like *.h-cdn.co or amv-prod-*.s3.amazonaws.com, for domains that aren't listed
+// one by one. A request names the site it names by name first, then by one of its domains, then by the
+// pattern with the most characters that aren't wildcards, or the one listed first between equal ones.
+type Site struct {
+	Name    string   `json:"site"`
+	Domain  string   `json:"domain"`  // Domain is where images of the site are downloaded from.
+	CDN     string   `json:"cdn"`     // CDN is the site's CDN, images are downloaded from when the registry uses CDNs.
+	Aliases []string `json:"aliases"` // Aliases are other domains or patterns of domains of the site, requests may name.
+	Policy  *Policy  `json:"policy"`  // Policy overrides how images of the site are processed, if set.
+}
+
+// Policy overrides the global defaults of how images of a site are processed and cached, like:
+//  "policy": {"quality": 80, "format": "jpeg", "max_width": 2000, "operations": ["resize", "crop"]}
+// Fields left out keep the global defaults.
+type Policy struct {
+	Quality          int64    `json:"quality"`           // Quality is the default output quality, 1-100.
+	Format           string   `json:"format"`            // Format converts images to "jpeg" or "png".
+	MaxWidth         int64    `json:"max_width"`         // MaxWidth bounds the width of outputs.
+	MaxHeight        int64    `json:"max_height"`        // MaxHeight bounds the height of outputs.
+	Operations       []string `json:"operations"`        // Operations are the operations allowed, all when empty.
+	CacheControl     string   `json:"cache_control"`     // CacheControl of the site's images.
+	SurrogateControl string   `json:"surrogate_control"` // SurrogateControl of the site's images.
+	Gravity          string   `json:"gravity"`           // Gravity positions crops without a position, like "center,top".
+	Upscale          bool     `json:"upscale"`           // Upscale lets resizes enlarge images.
+	GifColors        int64    `json:"gif_colors"`        // GifColors is the default color count of gifs, 2-256.
+	GifLossy         int64    `json:"gif_lossy"`         // GifLossy is the default gifsicle lossy level of gifs.
+}
+
+// formats are the formats policies may convert images to.
+var formats = map[string]bool{"jpeg": true, "png": true}
+
+// check returns what's invalid in p, if anything.
+func (p *Policy) check() error {
+	switch {
+	case p.Quality < 0 || p.Quality > 100:
+		return fmt.Errorf("quality must be between 1 and 100, not %d", p.Quality)
+	case p.Format != "" && !formats[p.Format]:
+		return fmt.Errorf("format must be jpeg or png, not [%s]", p.Format)
+	case p.MaxWidth < 0 || p.MaxHeight < 0:
+		return fmt.Errorf("max dimensions can't be negative")
+	case p.Gravity != "" && len(strings.Split(p.Gravity, ",")) != 2 && !strings.HasPrefix(p.Gravity, "focus,"):
+		return fmt.Errorf("gravity must have two coordinates, like center,top, not [%s]", p.Gravity)
+	case p.GifColors < 0 || p.GifColors == 1 || p.GifColors > 256:
+		return fmt.Errorf("gif colors must be 0 or between 2 and 256, not %d", p.GifColors)
+	case p.GifLossy < 0:
+		return fmt.Errorf("gif lossy can't be negative")
+	}
+
+	return nil
+}
+
+// domains returns every domain of s.
+func (s *Site) domains() []string {
+	domains := []string{s.Domain}
+	if s.CDN != "" {
+		domains = append(domains, s.CDN)
+	}
+
+	return append(domains, s.Aliases...)
+}
+
+// Registry is a set of sites, by name, by domain and by pattern. It's not changed once built, so requests
+// in flight keep using the registry they started with while a new one replaces it.
+type Registry struct {
+	sites    map[string]*Site
+	domains  map[string]*Site
+	patterns patterns
+	cdn      bool
+}
+
+// NewRegistry returns the registry of sites, once they're checked for duplicates and conflicts.
+// cdn downloads images of the sites that have a CDN from it, instead of from their domain.
+func NewRegistry(sites []Site, cdn bool) (*Registry, error) {
+	r := &Registry{
+		sites:    make(map[string]*Site, len(sites)),
+		domains:  map[string]*Site{},
+		patterns: patterns{suffixes: map[string]*pattern{}},
+		cdn:      cdn,
+	}
+
+	for i := range sites {
+		s := &sites[i]
+		if s.Name == "" || strings.Contains(s.Name, "/") {
+			return nil, fmt.Errorf("invalid site name [%s]", s.Name)
+		}
+		if _, ok := r.sites[s.Name]; ok {
+			return nil, fmt.Errorf("site [%s] is listed twice", s.Name)
+		}
+		if s.Domain == "" {
+			return nil, fmt.Errorf("site [%s] has no domain", s.Name)
+		}
+		if isPattern(s.Domain) || isPattern(s.CDN) {
+			return nil, fmt.Errorf("site [%s] has a pattern for a domain, only aliases may be patterns", s.Name)
+		}
+		if s.Policy != nil {
+			if err := s.Policy.check(); err != nil {
+				return nil, fmt.Errorf("site [%s] has an invalid policy: %s", s.Name, err)
+			}
+		}
+		r.sites[s.Name] = s
+
+		for _, domain := range s.domains() {
+			if domain == "" || strings.Contains(domain, "://") {
+				return nil, fmt.Errorf("site [%s] has an invalid domain [%s], domains have no scheme", s.Name, domain)
+			}
+			if isPattern(domain) {
+				p, err := newPattern(domain, s, i)
+				if err != nil {
+					return nil, err
+				}
+				if err := r.patterns.add(p); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if other, ok := r.domains[domain]; ok {
+				return nil, fmt.Errorf("domain [%s] is of both sites [%s] and [%s]", domain, other.Name, s.Name)
+			}
+			r.domains[domain] = s
+		}
+	}
+
+	// a site can't be named like the domain of another, requests naming it would be ambiguous.
+	for name := range r.sites {
+		if other, ok := r.domains[name]; ok && other.Name != name {
+			return nil, fmt.Errorf("site [%s] is named like a domain of site [%s]", name, other.Name)
+		}
+	}
+
+	return r, nil
+}
+
+// LoadSites reads the sites file at path, and returns its registry. See NewRegistry for cdn.
+func LoadSites(path string, cdn bool) (*Registry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sites []Site
+	if err := json.Unmarshal(data, &sites); err != nil {
+		return nil, fmt.Errorf("invalid sites [%s]: %s", path, err)
+	}
+
+	r, err := NewRegistry(sites, cdn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sites [%s]: %s", path, err)
+	}
+
+	return r, nil
+}
+
+// Sites returns the current registry.
+func Sites() *Registry {
+	return registry.Load().(*Registry)
+}
+
+// SetSites makes r the current registry.
+func SetSites(r *Registry) {
+	registry.Store(r)
+}
+
+// Len is how many sites r has.
+func (r *Registry) Len() int {
+	return len(r.sites)
+}
+
+// Domain returns the domain images of site are downloaded from.
+func (r *Registry) Domain(site string) (string, bool) {
+	s, ok := r.sites[site]
+	if !ok {
+		return "", false
+	}
+	if r.cdn && s.CDN != "" {
+		return s.CDN, true
+	}
+
+	return s.Domain, true
+}
+
+// Resolve returns the site route names: by name, by one of its domains, or by a pattern of its domains, in
+// that order. Routes naming no site are rejected with the reason why.
+func (r *Registry) Resolve(route string) (*Site, error) {
+	if s, ok := r.sites[route]; ok {
+		return s, nil
+	}
+	if s, ok := r.domains[route]; ok {
+		return s, nil
+	}
+	if p := r.patterns.match(route); p != nil {
+		return p.site, nil
+	}
+
+	return nil, r.rejection(route)
+}
+
+// rejection returns why route names no site of r.
+func (r *Registry) rejection(route string) error {
+	switch {
+	case route == "":
+		return errors.New("no site is named")
+	case strings.Contains(route, "://"):
+		return errors.New("it has a scheme, sites and domains are named without one")
+	case route != strings.ToLower(route) && r.IsAllowed(strings.ToLower(route)):
+		return fmt.Errorf("sites and domains are lowercase, like [%s]", strings.ToLower(route))
+	}
+
+	return errors.New("it's neither a site, nor a domain of one")
+}
+
+// IsAllowed tells whether route, a site or a domain of a site, is in r.
+func (r *Registry) IsAllowed(route string) bool {
+	_, err := r.Resolve(route)
+	return err == nil
+}
+
+// AllowsURL tells whether u is on a domain of a site of r. Domains may be a bucket path, like
+// s3.amazonaws.com/hmg-prod.
+func (r *Registry) AllowsURL(u *url.URL) bool {
+	if _, ok := r.domains[u.Host]; ok {
+		return true
+	}
+	if r.patterns.match(u.Host) != nil {
+		return true
+	}
+
+	bucket := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if len(bucket) < 2 {
+		return false
+	}
+	if _, ok := r.domains[u.Host+"/"+bucket[0]]; ok {
+		return true
+	}
+
+	return r.patterns.match(u.Host+"/"+bucket[0]) != nil
+}
+
+// Policy returns the policy of route, a site or a domain of a site, if it has one.
+func (r *Registry) Policy(route string) (*Policy, bool) {
+	s, err := r.Resolve(route)
+	if err != nil || s.Policy == nil {
+		return nil, false
+	}
+
+	return s.Policy, true
+}
+
+// Policies returns the policies of the sites of r that have one, by site.
+func (r *Registry) Policies() map[string]*Policy {
+	policies := map[string]*Policy{}
+	for name, s := range r.sites {
+		if s.Policy != nil {
+			policies[name] = s.Policy
+		}
+	}
+
+	return policies
+}
+
+// Domains returns every domain of every site of r, patterns aside.
+func (r *Registry) Domains() []string {
+	domains := make([]string, 0, len(r.domains))
+	for domain := range r.domains {
+		domains = append(domains, domain)
+	}
+
+	return domains
+}
+
+// NormalizeSite normalizes site name.
+func NormalizeSite(site string) string {
+	// We have both "cosmo" and "cosmopolitan" saved in our database as possible
+	// pointers to cosmopolitan image bucket, so we must account for both.
+	if site == "cosmo" || site == "cosmopolitan" {
+		return "cosmopolitan"
+	}
+
+	return site
+}
+
+func init() {
+	registry.Store(&Registry{
+		sites:    map[string]*Site{},
+		domains:  map[string]*Site{},
+		patterns: patterns{suffixes: map[string]*pattern{}},
+	})
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go test ./config -run Test_NewRegistry -v
+func Test_NewRegistry(t *testing.T) {
+	sites := []Site{
+		{Name: "caranddriver", Domain: "amv-prod-cad.s3.amazonaws.com", CDN: "cad.h-cdn.co"},
+		{Name: "hmg-prod", Domain: "hmg-prod.s3.amazonaws.com", Aliases: []string{"s3.amazonaws.com/hmg-prod"}},
+	}
+
+	r, err := NewRegistry(sites, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, r.Len())
+
+	domain, ok := r.Domain("caranddriver")
+	assert.True(t, ok)
+	assert.Equal(t, "amv-prod-cad.s3.amazonaws.com", domain)
+	_, ok = r.Domain("cad.h-cdn.co")
+	assert.False(t, ok)
+
+	for _, route := range []string{"caranddriver", "cad.h-cdn.co", "amv-prod-cad.s3.amazonaws.com", "s3.amazonaws.com/hmg-prod"} {
+		assert.True(t, r.IsAllowed(route), route)
+	}
+	assert.False(t, r.IsAllowed("elle"))
+	assert.Equal(t, 4, len(r.Domains()))
+
+	// sites with a CDN download from it when the registry uses CDNs.
+	r, _ = NewRegistry(sites, true)
+	domain, _ = r.Domain("caranddriver")
+	assert.Equal(t, "cad.h-cdn.co", domain)
+	domain, _ = r.Domain("hmg-prod")
+	assert.Equal(t, "hmg-prod.s3.amazonaws.com", domain)
+}
+
+//go test ./config -run Test_NewRegistry_invalid -v
+func Test_NewRegistry_invalid(t *testing.T) {
+	for name, sites := range map[string][]Site{
+		"no name":   {{Domain: "a.com"}},
+		"no domain": {{Name: "a"}},
+		"scheme":    {{Name: "a", Domain: "http://a.com"}},
+		"duplicate": {{Name: "a", Domain: "a.com"}, {Name: "a", Domain: "b.com"}},
+		"conflict":  {{Name: "a", Domain: "a.com"}, {Name: "b", Domain: "b.com", CDN: "a.com"}},
+		"ambiguous": {{Name: "a", Domain: "a.com"}, {Name: "a.com", Domain: "b.com"}},
+	} {
+		_, err := NewRegistry(sites, false)
+		assert.NotNil(t, err, name)
+	}
+}
+
+//go test ./config -run Test_LoadSites -v
+func Test_LoadSites(t *testing.T) {
+	r, err := LoadSites("sites.json", false)
+	assert.Nil(t, err)
+	assert.True(t, r.IsAllowed("cosmopolitan"))
+	assert.True(t, r.IsAllowed("cnl.h.cdn.cosmopolitan.nl"))
+
+	_, err = LoadSites("crop_profiles.json", false)
+	assert.NotNil(t, err)
+	_, err = LoadSites("missing.json", false)
+	assert.NotNil(t, err)
+}
+
+//go test ./config -run Test_Registry_Policy -v
+func Test_Registry_Policy(t *testing.T) {
+	policy := &Policy{Quality: 80, Format: "jpeg", MaxWidth: 2000, Operations: []string{"resize"}, Gravity: "left,top"}
+	r, err := NewRegistry([]Site{
+		{Name: "caranddriver", Domain: "amv-prod-cad.s3.amazonaws.com", CDN: "cad.h-cdn.co", Policy: policy},
+		{Name: "hmg-prod", Domain: "hmg-prod.s3.amazonaws.com"},
+	}, false)
+	assert.Nil(t, err)
+
+	for _, route := range []string{"caranddriver", "cad.h-cdn.co"} {
+		p, ok := r.Policy(route)
+		assert.True(t, ok, route)
+		assert.Equal(t, policy, p)
+	}
+	_, ok := r.Policy("hmg-prod")
+	assert.False(t, ok)
+	assert.Equal(t, map[string]*Policy{"caranddriver": policy}, r.Policies())
+}
+
+//go test ./config -run Test_NewRegistry_invalidPolicy -v
+func Test_NewRegistry_invalidPolicy(t *testing.T) {
+	for name, policy := range map[string]*Policy{
+		"quality":    {Quality: 101},
+		"format":     {Format: "gif"},
+		"max width":  {MaxWidth: -1},
+		"max height": {MaxHeight: -1},
+		"gravity":    {Gravity: "center"},
+		"gif colors": {GifColors: 1},
+		"gif lossy":  {GifLossy: -1},
+	} {
+		_, err := NewRegistry([]Site{{Name: "a", Domain: "a.com", Policy: policy}}, false)
+		assert.NotNil(t, err, name)
+	}
+}
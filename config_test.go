@@ -1,9 +1,14 @@
 package main
 
 import (
+	"github.com/bvchevez/imageprocess/cache"
 	cnf "github.com/bvchevez/imageprocess/config"
+	"github.com/bvchevez/imageprocess/image"
 	log "github.com/Sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/url"
+	"os"
 	"testing"
 )
 
@@ -13,14 +18,14 @@ func init() {
 
 func resetConfig() {
 	useSSL = false
-	cnf.AllowedSites = map[string]string{
-		// cdn
-		"bpc.h-cdn.test.co":  "bestproducts",
-		"cad.h-cdn.test.co":  "caranddriver",
-		"clv.h-cdn.test2.co": "countryliving",
-		"clv.h-cdn.test1.co": "countryliving",
-		"cos.h-cdn.co":       "cosmopolitan",
-	}
+	sites, _ := cnf.NewRegistry([]cnf.Site{
+		{Name: "bestproducts", Domain: "bpc.h-cdn.test.co"},
+		{Name: "caranddriver", Domain: "cad.h-cdn.test.co"},
+		{Name: "countryliving", Domain: "clv.h-cdn.test1.co", Aliases: []string{"clv.h-cdn.test2.co"}},
+		{Name: "cosmopolitan", Domain: "cos.h-cdn.co"},
+		{Name: "hmg-prod", Domain: "hmg-prod.s3.amazonaws.com", Aliases: []string{"s3.amazonaws.com/hmg-prod"}},
+	}, false)
+	cnf.SetSites(sites)
 }
 
 // go test -run Test_Supported_site -v
@@ -33,14 +38,30 @@ func Test_Supported_site(t *testing.T) {
 	assert.Equal(t, true, IsSupportedSite("clv.h-cdn.test2.co"))
 }
 
+// go test -run Test_CheckSite -v
+func Test_CheckSite(t *testing.T) {
+	resetConfig()
+	assert.Nil(t, CheckSite("caranddriver"))
+	assert.Equal(t, "it's neither a site, nor a domain of one", CheckSite("elle").Error())
+	assert.Equal(t, "sites and domains are lowercase, like [caranddriver]", CheckSite("CarAndDriver").Error())
+	assert.Equal(t, "it has a scheme, sites and domains are named without one", CheckSite("http://cos.h-cdn.co").Error())
+}
+
 // go test -run Test_GetSite_useCDN -v
 func Test_GetSite_useCDN(t *testing.T) {
-	cnf.Init(true)
+	sites, err := cnf.LoadSites("config/sites.json", true)
+	assert.Nil(t, err)
+	cnf.SetSites(sites)
+	defer resetConfig()
+
 	assert.Equal(t, "http://cos.h-cdn.co", config.GetSite("cosmopolitan"))
 	assert.Equal(t, "http://amv-prod-cos.s3.amazonaws.com", config.GetSite("amv-prod-cos.s3.amazonaws.com"))
 	assert.Equal(t, "http://cos.h-cdn.co", config.GetSite("cos.h-cdn.co"))
 
-	cnf.Init(false)
+	sites, err = cnf.LoadSites("config/sites.json", false)
+	assert.Nil(t, err)
+	cnf.SetSites(sites)
+
 	assert.Equal(t, "http://amv-prod-cos.s3.amazonaws.com", config.GetSite("cosmopolitan"))
 	assert.Equal(t, "http://amv-prod-cos.s3.amazonaws.com", config.GetSite("amv-prod-cos.s3.amazonaws.com"))
 	assert.Equal(t, "http://cos.h-cdn.co", config.GetSite("cos.h-cdn.co"))
@@ -105,8 +126,77 @@ func Test_InitConfiguration__badConfig(t *testing.T) {
 	assert.Equal(t, "open /Bad/Path: no such file or directory", err.Error())
 }
 
+// go test -run Test_checkGifDefaults -v
+func Test_checkGifDefaults(t *testing.T) {
+	if config.port == nil {
+		config.Init()
+	}
+	defer func() { *config.defaultGifColors, *config.defaultGifLossy = "0", "0" }()
+
+	for _, colors := range []string{"0", "2", "64", "256"} {
+		*config.defaultGifColors = colors
+		assert.Nil(t, checkGifDefaults(), colors)
+	}
+
+	for _, colors := range []string{"1", "257", "-2", "many"} {
+		*config.defaultGifColors = colors
+		assert.NotNil(t, checkGifDefaults(), colors)
+	}
+
+	*config.defaultGifColors = "0"
+	*config.defaultGifLossy = "-1"
+	assert.NotNil(t, checkGifDefaults())
+}
+
 // go test -run Test_InitConfiguration__goodConfig -v
 func Test_InitConfiguration__goodConfig(t *testing.T) {
 	err := InitConfigurations("fixtures/test.config")
 	assert.Equal(t, nil, err)
 }
+
+// go test -run Test_InitCaches__disk -v
+func Test_InitCaches__disk(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "hips-cache")
+	defer os.RemoveAll(dir)
+	defer func() {
+		outputCache = cache.NewExpiring(cache.NewTiered(nil), 0, 0, imageRendered)
+		sourceCache = cache.NewTiered(nil)
+	}()
+
+	for _, option := range []**string{&config.outputCache, &config.sourceCache, &config.sourceCacheTTL,
+		&config.outputCacheTTL, &config.outputGrace, &config.outputDiskCache, &config.sourceDiskCache,
+		&config.diskCacheDir, &config.diskCachePolicy} {
+		*option = new(string)
+	}
+	*config.outputCache = "1"
+	*config.outputDiskCache = "1"
+	*config.diskCacheDir = dir
+	*config.diskCachePolicy = "lru"
+	InitCaches()
+
+	outputCache.Add("a", &image.Image{Data: []byte("image a"), Type: image.JPEG}, 7)
+	assert.Equal(t, 2, len(outputCache.Stats().Tiers))
+	assert.Equal(t, 0, len(sourceCache.Stats().Tiers))
+
+	// images on disk are there for the next process.
+	*config.outputCache = "0"
+	InitCaches()
+	cached, ok := outputCache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, &image.Image{Data: []byte("image a"), Type: image.JPEG}, cached)
+}
+
+// go test -run Test_IsAllowedRedirect -v
+func Test_IsAllowedRedirect(t *testing.T) {
+	resetConfig()
+
+	for u, allowed := range map[string]bool{
+		"https://cad.h-cdn.test.co/a.jpg":          true,
+		"https://s3.amazonaws.com/hmg-prod/a.jpg":  true,
+		"https://s3.amazonaws.com/hmg-other/a.jpg": false,
+		"https://evil.example.com/a.jpg":           false,
+	} {
+		parsed, _ := url.Parse(u)
+		assert.Equal(t, allowed, IsAllowedRedirect(parsed), u)
+	}
+}
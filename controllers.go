@@ -1,12 +1,15 @@
 package main
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
 
+	cnf "github.com/bvchevez/imageprocess/config"
 	"github.com/bvchevez/imageprocess/helper"
+	"github.com/bvchevez/imageprocess/image"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/newrelic/go-agent"
@@ -27,6 +30,13 @@ var (
 		Image: nil,
 	}
 
+	// default response for debug requests without a valid token.
+	forbiddenDebugResponse = &Response{
+		Code:  http.StatusForbidden,
+		Data:  []string{"Invalid debug token."},
+		Image: nil,
+	}
+
 	// default response for root.
 	defaultRootResponse = &Response{
 		Code:  http.StatusOK,
@@ -61,8 +71,10 @@ func indexController(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if res, err := imageControllerHelper(w, req.URL.Path, req.URL.RawQuery); err != nil {
+	if res, err := imageControllerHelper(w, req, req.URL.Path); err != nil || res.Image == nil {
 		JsonWriter(w, res)
+	} else if res.Code == http.StatusNotModified {
+		NotModifiedWriter(w, res)
 	} else if req.Method == "HEAD" {
 		ImageHeaderWriter(w, res)
 	} else {
@@ -78,8 +90,10 @@ func hipsController(w http.ResponseWriter, req *http.Request) {
 	}
 
 	reqURLPath := strings.Replace(req.URL.Path, "/hips", "", 1)
-	if res, err := imageControllerHelper(w, reqURLPath, req.URL.RawQuery); err != nil {
+	if res, err := imageControllerHelper(w, req, reqURLPath); err != nil || res.Image == nil {
 		JsonWriter(w, res)
+	} else if res.Code == http.StatusNotModified {
+		NotModifiedWriter(w, res)
 	} else if req.Method == "HEAD" {
 		ImageHeaderWriter(w, res)
 	} else {
@@ -88,7 +102,9 @@ func hipsController(w http.ResponseWriter, req *http.Request) {
 }
 
 // imageControllerHelper is a helper that handles all common stuff between hips and index controller.
-func imageControllerHelper(w http.ResponseWriter, path, params string) (*Response, error) {
+// Conditional requests are answered with a 304 response when the image didn't change, before processing it when possible.
+func imageControllerHelper(w http.ResponseWriter, req *http.Request, path string) (*Response, error) {
+	params := req.URL.RawQuery
 	pathInfo, err := ExtractInfoFromPath(path)
 	if pathInfo == nil || len(pathInfo) != 2 || err != nil {
 		return badRequestResponse, err
@@ -100,6 +116,21 @@ func imageControllerHelper(w http.ResponseWriter, path, params string) (*Respons
 		return badRequestResponse, err
 	}
 
+	// smartcrop debug images are only served with a valid debug token.
+	if image.IsDebug(ueParams) && !isDebugTokenValid(ueParams) {
+		log.WithFields(log.Fields{
+			"path": path,
+		}).Warn("Invalid debug token.")
+
+		return forbiddenDebugResponse, fmt.Errorf("Invalid debug token")
+	}
+
+	if isConditional(req) {
+		if img, ok := CachedValidators(pathInfo[0], pathInfo[1], ueParams); ok && isNotModified(req, img) {
+			return notModifiedResponse(img, PolicyForSite(cnf.NormalizeSite(pathInfo[0]))), nil
+		}
+	}
+
 	res := HandleImage(pathInfo[0], pathInfo[1], ueParams, txn)
 	if res.Code != http.StatusOK {
 		if txnOk {
@@ -113,9 +144,45 @@ func imageControllerHelper(w http.ResponseWriter, path, params string) (*Respons
 		return res, fmt.Errorf("Response status not OK")
 	}
 
+	if res.Image != nil && isNotModified(req, res.Image) {
+		notModified := notModifiedResponse(res.Image, res.Policy)
+		notModified.Stale = res.Stale
+		return notModified, nil
+	}
+
 	return res, nil
 }
 
+// isDebugTokenValid makes sure params has a token matching debugToken. Debugging is disabled if no debugToken is set.
+func isDebugTokenValid(params string) bool {
+	if debugToken == "" {
+		return false
+	}
+
+	// tokens are compared in constant time, so timing doesn't tell how much of one matches.
+	for _, bit := range strings.Split(params, "&") {
+		if strings.HasPrefix(bit, "token=") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(bit, "token=")), []byte(debugToken)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withoutToken returns params without their debug token, so the token is neither logged nor part of pipeline ids.
+func withoutToken(params string) string {
+	bits := strings.Split(params, "&")
+	kept := bits[:0]
+	for _, bit := range bits {
+		if bit != "token" && !strings.HasPrefix(bit, "token=") {
+			kept = append(kept, bit)
+		}
+	}
+
+	return strings.Join(kept, "&")
+}
+
 // healthController is a controller for /health path.
 func healthController(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "GET" && req.Method != "HEAD" {
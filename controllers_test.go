@@ -14,7 +14,7 @@ func Test_hipsController_goodRequest(t *testing.T) {
 
 	hipsController(w, r)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Equal(t, "[\"Invalid site [mock-unsupported-site].\"]", w.Body.String())
+	assert.Equal(t, "[\"Invalid site [mock-unsupported-site]: it's neither a site, nor a domain of one.\"]", w.Body.String())
 }
 
 // go test -run Test_imageController_badRequest -v
@@ -107,7 +107,7 @@ func Test_indexController_goodRequest(t *testing.T) {
 
 	indexController(w, r)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Equal(t, "[\"Invalid site [mock-unsupported-site].\"]", w.Body.String())
+	assert.Equal(t, "[\"Invalid site [mock-unsupported-site]: it's neither a site, nor a domain of one.\"]", w.Body.String())
 }
 
 // go test -run Test_indexController_badRequest -v
@@ -224,6 +224,50 @@ func Test_healthcheckController_badToken(t *testing.T) {
 	assert.Equal(t, http.StatusForbidden, w.Code)
 }
 
+// go test -run Test_indexController_debugBadToken -v
+func Test_indexController_debugBadToken(t *testing.T) {
+	defer func(token string) { debugToken = token }(debugToken)
+	debugToken = "test-123"
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/hdm-dev/images/test.jpg?crop=200:100;auto,auto&debug=smartcrop&token=test-1234", nil)
+	indexController(w, r)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// go test -run Test_indexController_debugDisabled -v
+func Test_indexController_debugDisabled(t *testing.T) {
+	defer func(token string) { debugToken = token }(debugToken)
+	debugToken = ""
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/hdm-dev/images/test.jpg?crop=200:100;auto,auto&debug=smartcrop&token=", nil)
+	indexController(w, r)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// go test -run Test_isDebugTokenValid -v
+func Test_isDebugTokenValid(t *testing.T) {
+	defer func(token string) { debugToken = token }(debugToken)
+	debugToken = "test-123"
+
+	assert.True(t, isDebugTokenValid("crop=200:100;auto,auto&debug=smartcrop&token=test-123"))
+	assert.False(t, isDebugTokenValid("crop=200:100;auto,auto&debug=smartcrop&token=test-1234"))
+	assert.False(t, isDebugTokenValid("crop=200:100;auto,auto&debug=smartcrop"))
+	assert.False(t, isDebugTokenValid("crop=200:100;auto,auto&debug=smartcrop&token=test-12"))
+	assert.False(t, isDebugTokenValid("crop=200:100;auto,auto&debug=smartcrop&token="))
+}
+
+// go test -run Test_withoutToken -v
+func Test_withoutToken(t *testing.T) {
+	assert.Equal(t, "crop=200:100;auto,auto&debug=smartcrop", withoutToken("crop=200:100;auto,auto&token=test-123&debug=smartcrop"))
+	assert.Equal(t, "crop=200:100;auto,auto&debug=smartcrop", withoutToken("crop=200:100;auto,auto&debug=smartcrop&token="))
+	assert.Equal(t, "resize=100:*", withoutToken("resize=100:*"))
+	assert.Equal(t, "", withoutToken("token=test-123"))
+}
+
 // go test . -run Test_indexController_HEAD_goodRequest -v
 func Test_indexController_HEAD_goodRequest(t *testing.T) {
 
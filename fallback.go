@@ -0,0 +1,118 @@
+package main
+
+// fallback.go loads the images sites serve instead of their missing images.
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+
+	"github.com/bvchevez/imageprocess/image"
+)
+
+const (
+	// defaultFallbackSite is the site whose fallback is used by sites without one, if it's defined.
+	defaultFallbackSite = "default"
+
+	// defaultPlaceholderWidth and defaultPlaceholderHeight are the size of solid placeholders that don't set one.
+	defaultPlaceholderWidth  = 1600
+	defaultPlaceholderHeight = 900
+)
+
+// fallbacks are the loaded fallbacks by site.
+var fallbacks = map[string]*Fallback{}
+
+// Fallback is the image a site serves, with the requested operations applied, when the origin doesn't have the
+// image requested. It's either a source at the site's origin, optionally blurred, or a solid color placeholder.
+// The fallbacks file sets them up by site, like:
+//  {
+//    "default": {"color": "#e5e5e5"},
+//    "caranddriver": {"path": "/assets/placeholder.jpg", "blur": 16}
+//  }
+type Fallback struct {
+	Path   string  `json:"path"`   // Path is the source at the site's origin served instead.
+	Blur   float64 `json:"blur"`   // Blur blurs the source at Path this much, 0 keeps it sharp.
+	Color  string  `json:"color"`  // Color is the color of a solid placeholder, like #e5e5e5, when there's no Path.
+	Width  int     `json:"width"`  // Width of the solid placeholder.
+	Height int     `json:"height"` // Height of the solid placeholder.
+
+	color color.RGBA
+}
+
+// LoadFallbacks loads the fallbacks file at path, replacing any fallbacks loaded before.
+func LoadFallbacks(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	f := map[string]*Fallback{}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("invalid fallbacks [%s]: %s", path, err)
+	}
+
+	for site, fallback := range f {
+		if err := fallback.init(); err != nil {
+			return fmt.Errorf("site [%s] has an invalid fallback: %s", site, err)
+		}
+	}
+
+	fallbacks = f
+	return nil
+}
+
+// init checks f, and sets the defaults of its solid placeholder.
+func (f *Fallback) init() error {
+	if f.Path != "" {
+		return nil
+	}
+	if f.Color == "" {
+		return fmt.Errorf("fallbacks need a path or a color")
+	}
+
+	c, err := image.ParseHexColor(f.Color)
+	if err != nil {
+		return err
+	}
+	f.color = c
+
+	if f.Width <= 0 || f.Height <= 0 {
+		f.Width, f.Height = defaultPlaceholderWidth, defaultPlaceholderHeight
+	}
+
+	return nil
+}
+
+// FallbackForSite returns the fallback of site, or the default fallback.
+func FallbackForSite(site string) (*Fallback, bool) {
+	if f, ok := fallbacks[site]; ok {
+		return f, true
+	}
+
+	f, ok := fallbacks[defaultFallbackSite]
+	return f, ok
+}
+
+// Source returns the source image of the fallback of site.
+func (f *Fallback) Source(site, pipelineID string) (*Source, error) {
+	if f.Path == "" {
+		data, err := image.SolidPlaceholder(f.Width, f.Height, f.color)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Source{Data: data}, nil
+	}
+
+	source, err := GetImage(site, f.Path, pipelineID)
+	if err != nil || f.Blur <= 0 {
+		return source, err
+	}
+
+	data, err := image.BlurredPlaceholder(source.Data, f.Blur)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Source{Data: data, ETag: source.ETag, LastModified: source.LastModified}, nil
+}
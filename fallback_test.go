@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/bvchevez/imageprocess/image"
+	"github.com/bvchevez/imageprocess/origin"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFallbacks writes the fallbacks file json, and returns its path.
+func writeFallbacks(t *testing.T, json string) string {
+	f, err := ioutil.TempFile("", "fallbacks")
+	assert.Nil(t, err)
+	f.WriteString(json)
+	f.Close()
+
+	return f.Name()
+}
+
+// go test -run Test_LoadFallbacks -v
+func Test_LoadFallbacks(t *testing.T) {
+	path := writeFallbacks(t, `{
+		"default": {"color": "#e5e5e5"},
+		"caranddriver": {"path": "/assets/placeholder.jpg", "blur": 16}
+	}`)
+	defer os.Remove(path)
+	defer func() { fallbacks = map[string]*Fallback{} }()
+
+	assert.Nil(t, LoadFallbacks(path))
+
+	f, ok := FallbackForSite("caranddriver")
+	assert.True(t, ok)
+	assert.Equal(t, "/assets/placeholder.jpg", f.Path)
+
+	// sites without a fallback use the default one.
+	f, ok = FallbackForSite("esquire")
+	assert.True(t, ok)
+	assert.Equal(t, "#e5e5e5", f.Color)
+	assert.Equal(t, defaultPlaceholderWidth, f.Width)
+	assert.Equal(t, defaultPlaceholderHeight, f.Height)
+
+	for _, bad := range []string{`{"default": {}}`, `{"default": {"color": "grey"}}`, `[]`} {
+		badPath := writeFallbacks(t, bad)
+		assert.NotNil(t, LoadFallbacks(badPath), bad)
+		os.Remove(badPath)
+	}
+	assert.NotNil(t, LoadFallbacks("/does/not/exist.json"))
+
+	// bad files keep the fallbacks loaded before.
+	_, ok = FallbackForSite("caranddriver")
+	assert.True(t, ok)
+}
+
+// go test -run Test_Pipeline_downloadFallback -v
+func Test_Pipeline_downloadFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	p := &Pipeline{id: "id", site: "caranddriver", path: "/missing.jpg"}
+	_, _, notFound := origin.NewHTTP(server.URL).Fetch(context.Background(), "/missing.jpg", "")
+	assert.NotNil(t, notFound)
+
+	// sites without fallbacks keep the origin's error.
+	_, err := p.downloadFallback(notFound)
+	assert.Equal(t, notFound, err)
+	assert.False(t, p.fallback)
+
+	path := writeFallbacks(t, `{"default": {"color": "#e5e5e5", "width": 160, "height": 90}}`)
+	defer os.Remove(path)
+	defer func() { fallbacks = map[string]*Fallback{} }()
+	assert.Nil(t, LoadFallbacks(path))
+
+	// other failures aren't replaced by the fallback.
+	failed := errors.New("failed")
+	_, err = p.downloadFallback(failed)
+	assert.Equal(t, failed, err)
+	assert.False(t, p.fallback)
+
+	source, err := p.downloadFallback(notFound)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, source.Data)
+	assert.True(t, p.fallback)
+}
+
+// go test -run Test_ImageHeaderWriter_fallback -v
+func Test_ImageHeaderWriter_fallback(t *testing.T) {
+	w := httptest.NewRecorder()
+	ImageHeaderWriter(w, &Response{Image: &image.Image{Type: "image/jpeg", Fallback: true}})
+
+	assert.Equal(t, "1", w.Header().Get("X-Fallback"))
+	assert.Equal(t, errorCacheControl, w.Header().Get("Cache-Control"))
+	assert.Equal(t, errorCacheControl, w.Header().Get("Surrogate-Control"))
+
+	w = httptest.NewRecorder()
+	ImageHeaderWriter(w, &Response{Image: &image.Image{Type: "image/jpeg"}})
+	assert.Empty(t, w.Header().Get("X-Fallback"))
+}
+
+// go test -run Test_NotModifiedWriter_fallback -v
+func Test_NotModifiedWriter_fallback(t *testing.T) {
+	w := httptest.NewRecorder()
+	NotModifiedWriter(w, &Response{Image: &image.Image{ETag: `"abc"`, Fallback: true}})
+
+	// a revalidated fallback isn't kept for any longer than a fresh one.
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Fallback"))
+	assert.Equal(t, errorCacheControl, w.Header().Get("Cache-Control"))
+	assert.Equal(t, errorCacheControl, w.Header().Get("Surrogate-Control"))
+}
@@ -9,7 +9,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bvchevez/imageprocess/cache"
 	cnf "github.com/bvchevez/imageprocess/config"
+	"github.com/bvchevez/imageprocess/image"
+	"github.com/bvchevez/imageprocess/origin"
 	log "github.com/Sirupsen/logrus"
 	"github.com/newrelic/go-agent"
 )
@@ -29,13 +32,19 @@ type Health struct {
 	UpTime          int64    `json:"uptime"`
 	StatusUpdated   string   `json:"status_updated"`
 	Errors          []string `json:"errors"`
+
+	OutputCache cache.Stats `json:"output_cache"`
+	SourceCache cache.Stats `json:"source_cache"`
+
+	// Origins are the states of the breakers of the origins of sites, by site.
+	Origins map[string]origin.BreakerStats `json:"origins"`
 }
 
 // HandleImage handles image request and outputs a Response pointer.
 func HandleImage(site, path, params string, txn newrelic.Transaction) *Response {
 	site = cnf.NormalizeSite(site)
-	if IsSupportedSite(site) == false {
-		err := fmt.Errorf("Invalid site [%s].", site)
+	if reason := CheckSite(site); reason != nil {
+		err := fmt.Errorf("Invalid site [%s]: %s.", site, reason)
 		log.WithFields(log.Fields{
 			"error": err.Error(),
 			"site":  site,
@@ -48,27 +57,122 @@ func HandleImage(site, path, params string, txn newrelic.Transaction) *Response
 		}
 	}
 
+	policy := PolicyForSite(site)
+
+	// Processed images are served from the output cache when they're there. Stale ones are served
+	// while they're processed again in the background, and for as long as that fails, within their grace.
+	pipelineID := policy.PipelineID(site, path, params)
+	cached, freshness := outputCache.Lookup(pipelineID)
+	if freshness != cache.Missing {
+		if freshness == cache.Stale {
+			pipelines.Go(pipelineID, func() (interface{}, error) {
+				return refreshImage(site, path, params, pipelineID, policy), nil
+			})
+		}
+
+		return &Response{
+			Code:   http.StatusOK,
+			Data:   nil,
+			Image:  cached.(*image.Image),
+			Stale:  freshness == cache.Stale,
+			Policy: policy,
+		}
+	}
+
+	// Identical requests arriving together are processed once, and all get that response.
+	resp, shared, err := pipelines.Do(pipelineID, func() (interface{}, error) {
+		return processImage(site, path, params, pipelineID, policy, txn), nil
+	})
+	// A panic processing the image was logged by logPanic, every request waiting on it fails.
+	if err != nil || resp == nil {
+		return &Response{
+			Code:   http.StatusInternalServerError,
+			Data:   [1]string{"Failed to process the image."},
+			Image:  nil,
+			Policy: policy,
+		}
+	}
+	if shared {
+		log.WithFields(log.Fields{
+			"pipeline_id": pipelineID,
+		}).Debug("Shared the response of an identical request in flight.")
+	}
+
+	return resp.(*Response)
+}
+
+// logPanic logs a panic recovered from a coalesced call of key, i.e. a pipeline id or a source url,
+// along with its stack.
+func logPanic(key string, err *cache.PanicError) {
+	log.WithFields(log.Fields{
+		"key":   key,
+		"error": err.Error(),
+		"stack": string(err.Stack),
+	}).Error("Recovered from a panic.")
+}
+
+// imageSize is the size of an *image.Image in the output cache.
+func imageSize(value interface{}) int64 {
+	return int64(len(value.(*image.Image).Data))
+}
+
+// imageRendered is when an *image.Image in the output cache was processed.
+func imageRendered(value interface{}) time.Time {
+	return value.(*image.Image).Rendered
+}
+
+// refreshImage processes a stale image of the output cache again. Failures keep the stale image, unless the
+// origin doesn't have its source anymore.
+func refreshImage(site, path, params, pipelineID string, policy *Policy) *Response {
+	resp := processImage(site, path, params, pipelineID, policy, nil)
+	if resp.Code == http.StatusNotFound || (resp.Image != nil && resp.Image.Fallback) {
+		outputCache.Remove(pipelineID)
+	}
+
+	return resp
+}
+
+// processImage runs the pipeline of an image request with the policy of its site, and caches the image
+// it outputs.
+func processImage(site, path, params, pipelineID string, policy *Policy, txn newrelic.Transaction) *Response {
 	pipeline := &Pipeline{
 		site:     site,
 		path:     path,
 		rawQuery: params,
+		policy:   policy,
 	}
-	image, resp := pipeline.Process(txn)
+	img, resp := pipeline.Process(txn)
 	if resp != nil {
+		resp.Policy = policy
+	}
+	if resp != nil && resp.Code != http.StatusOK {
 		log.WithFields(log.Fields{
 			"error":  resp.Data,
 			"site":   site,
 			"path":   path,
-			"params": params,
+			"params": withoutToken(params),
 		}).Warn("Image processing error.")
 
 		return resp
 	}
 
+	// analyze requests respond with json data instead of an image.
+	if resp != nil {
+		return resp
+	}
+
+	// Fallbacks aren't cached, the missing image may show up soon. Debug images aren't either,
+	// their urls carry the debug token.
+	if !img.Fallback && !img.Debug {
+		img.Rendered = time.Now()
+		outputCache.Add(pipelineID, img, imageSize(img))
+	}
+
 	return &Response{
-		Code:  http.StatusOK,
-		Data:  nil,
-		Image: image,
+		Code:   http.StatusOK,
+		Data:   nil,
+		Image:  img,
+		Policy: policy,
 	}
 }
 
@@ -131,6 +235,9 @@ func HandleHealthCheck() *Response {
 			NumberOfCPUs:    runtime.NumCPU(),
 			StatusUpdated:   time.Now().Format("Mon Jan 2 15:04:05 MST 2006"),
 			Errors:          errors,
+			OutputCache:     outputCache.Stats(),
+			SourceCache:     sourceCache.Stats(),
+			Origins:         origin.Breakers(),
 		},
 		Image: nil,
 	}
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"github.com/bvchevez/imageprocess/cache"
+	"github.com/bvchevez/imageprocess/image"
+	"github.com/bvchevez/imageprocess/origin"
 	"github.com/stretchr/testify/assert"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 )
 
 // go test -run Test_Healthcheck__no_errors -v
@@ -12,3 +20,160 @@ func Test_Healthcheck__no_errors(t *testing.T) {
 	res := HandleHealthCheck()
 	assert.Equal(t, http.StatusOK, res.Code)
 }
+
+// go test -run Test_HandleImage_outputCache -v
+// test that processed images are served from the output cache.
+func Test_HandleImage_outputCache(t *testing.T) {
+	resetConfig()
+	memory, _ := cache.NewMemory(1024)
+	outputCache = cache.NewExpiring(memory, 0, 0, imageRendered)
+	defer func() { outputCache = cache.NewExpiring(cache.NewTiered(nil), 0, 0, imageRendered) }()
+
+	cached := &image.Image{Data: []byte("cached"), Type: image.JPEG}
+	outputCache.Add(PolicyForSite("caranddriver").PipelineID("caranddriver", "/a.jpg", "resize=100:*"), cached, 6)
+
+	res := HandleImage("caranddriver", "/a.jpg", "resize=100:*", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.True(t, cached == res.Image)
+
+	stats := HandleHealthCheck().Data.(Health).OutputCache
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, 1, stats.Entries)
+}
+
+// go test -run Test_HandleImage_stale -v
+// test that expired images are served stale while they're processed again, and as long as that fails.
+func Test_HandleImage_stale(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone.jpg" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	f, _ := ioutil.TempFile("", "origins")
+	defer os.Remove(f.Name())
+	ioutil.WriteFile(f.Name(), []byte(`{"test-origin": {"type": "http", "url": "`+server.URL+`"}}`), 0644)
+	origin.Configure(origin.Options{ConnectTimeout: time.Second, ReadTimeout: time.Second})
+	assert.Nil(t, origin.Load(f.Name()))
+
+	memory, _ := cache.NewMemory(1024)
+	outputCache = cache.NewExpiring(memory, time.Minute, time.Hour, imageRendered)
+	defer func() {
+		outputCache = cache.NewExpiring(cache.NewTiered(nil), 0, 0, imageRendered)
+		ioutil.WriteFile(f.Name(), []byte(`{}`), 0644)
+		origin.Load(f.Name())
+		origin.Configure(origin.DefaultOptions)
+	}()
+
+	for _, path := range []string{"/a.jpg", "/gone.jpg"} {
+		pipelineID := PolicyForSite("test-origin").PipelineID("test-origin", path, "resize=100:*")
+		stale := &image.Image{Data: []byte("stale"), Type: image.JPEG, Rendered: time.Now().Add(-time.Hour)}
+		outputCache.Add(pipelineID, stale, 5)
+
+		res := HandleImage("test-origin", path, "resize=100:*", nil)
+		assert.Equal(t, http.StatusOK, res.Code, path)
+		assert.True(t, stale == res.Image, path)
+		assert.True(t, res.Stale, path)
+
+		// wait for the refresh in the background.
+		pipelines.Do(pipelineID, func() (interface{}, error) { return nil, nil })
+	}
+
+	// failed refreshes keep the stale image, but images gone from the origin aren't served anymore.
+	res := HandleImage("test-origin", "/a.jpg", "resize=100:*", nil)
+	assert.True(t, res.Stale)
+	res = HandleImage("test-origin", "/gone.jpg", "resize=100:*", nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	w := httptest.NewRecorder()
+	ImageHeaderWriter(w, &Response{Image: &image.Image{Type: image.JPEG}, Stale: true})
+	assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	assert.Equal(t, `110 - "Response is Stale"`, w.Header().Get("Warning"))
+	assert.Equal(t, errorCacheControl, w.Header().Get("Cache-Control"))
+}
+
+// go test -run Test_HandleImage_originErrors -v
+// test that failed downloads respond with the kind of failure of the origin.
+func Test_HandleImage_originErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing.jpg":
+			http.NotFound(w, r)
+		case "/slow.jpg":
+			time.Sleep(100 * time.Millisecond)
+		case "/large.jpg":
+			w.Write(make([]byte, 2048))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	f, _ := ioutil.TempFile("", "origins")
+	defer os.Remove(f.Name())
+	ioutil.WriteFile(f.Name(), []byte(`{"test-origin": {"type": "http", "url": "`+server.URL+`"}}`), 0644)
+	origin.Configure(origin.Options{ConnectTimeout: time.Second, ReadTimeout: 50 * time.Millisecond, MaxBytes: 1024})
+	assert.Nil(t, origin.Load(f.Name()))
+	defer func() {
+		ioutil.WriteFile(f.Name(), []byte(`{}`), 0644)
+		origin.Load(f.Name())
+		origin.Configure(origin.DefaultOptions)
+	}()
+
+	for path, codes := range map[string][2]int{
+		"/missing.jpg": {http.StatusNotFound, http.StatusNotFound},
+		"/broken.jpg":  {http.StatusBadGateway, http.StatusServiceUnavailable},
+		"/slow.jpg":    {http.StatusGatewayTimeout, 0},
+		"/large.jpg":   {http.StatusRequestEntityTooLarge, 0},
+	} {
+		res := HandleImage("test-origin", path, "resize=100:*", nil)
+		assert.Equal(t, codes[0], res.Code, path)
+		assert.Equal(t, codes[1], res.OriginStatus, path)
+	}
+
+	// sites without an origin are forbidden.
+	res := downloadErrorResponse(fmt.Errorf("A proper source destination was not found."))
+	assert.Equal(t, http.StatusForbidden, res.Code)
+}
+
+// go test -run Test_HandleImage_circuitOpen -v
+// test that downloads from a failing origin stop, answering 503 with a Retry-After.
+func Test_HandleImage_circuitOpen(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	f, _ := ioutil.TempFile("", "origins")
+	defer os.Remove(f.Name())
+	ioutil.WriteFile(f.Name(), []byte(`{"test-origin": {"type": "http", "url": "`+server.URL+`"}}`), 0644)
+	origin.Configure(origin.Options{ConnectTimeout: time.Second, ReadTimeout: time.Second,
+		BreakerFailures: 2, BreakerCooldown: time.Minute})
+	assert.Nil(t, origin.Load(f.Name()))
+	defer func() {
+		ioutil.WriteFile(f.Name(), []byte(`{}`), 0644)
+		origin.Load(f.Name())
+		origin.Configure(origin.DefaultOptions)
+	}()
+
+	for _, path := range []string{"/a.jpg", "/b.jpg"} {
+		res := HandleImage("test-origin", path, "resize=100:*", nil)
+		assert.Equal(t, http.StatusBadGateway, res.Code, path)
+	}
+
+	res := HandleImage("test-origin", "/c.jpg", "resize=100:*", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, 2, requests)
+
+	w := httptest.NewRecorder()
+	JsonWriter(w, res)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	health := HandleHealthCheck().Data.(Health)
+	assert.Equal(t, "open", health.Origins["test-origin"].State)
+}
@@ -0,0 +1,147 @@
+// analyze.go runs the smartcrop analysis on an image and reports it, instead of transforming the image.
+package image
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/bvchevez/imageprocess/helper"
+	"github.com/bvchevez/imageprocess/smartcrop"
+)
+
+// CropAnalysis is the smartcrop analysis for a single crop size, as returned by analyze=crop;W:H.
+type CropAnalysis struct {
+	Width        int64      `json:"width"`        // requested crop width
+	Height       int64      `json:"height"`       // requested crop height
+	X            int64      `json:"x"`            // left of the crop HIPS would cut with crop=W:H;auto,auto
+	Y            int64      `json:"y"`            // top of the crop HIPS would cut with crop=W:H;auto,auto
+	Crop         CropHint   `json:"crop"`         // the top crop found by smartcrop
+	Faces        []Rect     `json:"faces"`        // detected faces
+	Alternatives []CropHint `json:"alternatives"` // runner-up crops, best first
+}
+
+// CropHint is a scored crop rectangle.
+type CropHint struct {
+	Rect
+	Score Score `json:"score"`
+}
+
+// Score is the smartcrop score breakdown of a crop.
+type Score struct {
+	Detail     float64 `json:"detail"`
+	Saturation float64 `json:"saturation"`
+	Skin       float64 `json:"skin"`
+	Total      float64 `json:"total"`
+}
+
+// Rect is a rectangle in source image pixels.
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// IsAnalyze figures out if "analyze=" exists in our url parameter.
+func IsAnalyze(rawQuery string) bool {
+	return strings.Contains(rawQuery, "analyze=")
+}
+
+// MakeAnalysis parses the analyze parameter out of a request's query and runs it on imgObj.
+// Looks like analyze=crop;400:300 or analyze=crop;400:300;10 for ten alternatives.
+// Other parameters are ignored, except for frame=1 which is handled by MakeImage.
+func MakeAnalysis(rawQuery string, imgObj MutableImage) (*CropAnalysis, error) {
+	var params []string
+	for _, bit := range strings.Split(rawQuery, "&") {
+		if strings.HasPrefix(bit, "analyze=") {
+			params = strings.Split(strings.TrimPrefix(bit, "analyze="), ";")
+			break
+		}
+	}
+
+	if len(params) < 2 || len(params) > 3 {
+		return nil, fmt.Errorf("analyze must look like analyze=crop;W:H")
+	}
+	if params[0] != "crop" {
+		return nil, fmt.Errorf("invalid analysis [%s]", params[0])
+	}
+
+	alternatives := analyzeAlternatives
+	if len(params) == 3 {
+		if helper.IsNumeric(params[2]) == false {
+			return nil, fmt.Errorf("invalid number of alternatives [%s]", params[2])
+		}
+		alternatives = helper.String2Int(params[2])
+		if alternatives < 0 || alternatives > maxAnalyzeAlternatives {
+			return nil, fmt.Errorf("number of alternatives must be between 0 and %d", maxAnalyzeAlternatives)
+		}
+	}
+
+	imgObj.SetDimensions()
+	operation := ImageOperation{
+		ImageWidth:  imgObj.GetImage().Width,
+		ImageHeight: imgObj.GetImage().Height,
+		Image:       &imgObj,
+	}
+	if err := operation.setCrop([]string{params[1], "auto,auto"}); err != nil {
+		return nil, err
+	}
+
+	op := &CropOperation{
+		NewWidth:     operation.NewWidth,
+		NewHeight:    operation.NewHeight,
+		Position:     operation.Position,
+		Image:        &imgObj,
+		Alternatives: alternatives,
+	}
+	if !op.IsValid() {
+		return nil, fmt.Errorf("crop [%dx%d] must fit within the image", op.NewWidth, op.NewHeight)
+	}
+
+	return op.Analyze()
+}
+
+// Analyze runs smartcrop and returns its analysis.
+func (i *CropOperation) Analyze() (*CropAnalysis, error) {
+	crop, err := i.FindBestCrop()
+	if err != nil {
+		return nil, err
+	}
+
+	pos := i.AutoPosition(crop)
+	analysis := &CropAnalysis{
+		Width:        i.NewWidth,
+		Height:       i.NewHeight,
+		X:            pos.X,
+		Y:            pos.Y,
+		Crop:         newCropHint(crop),
+		Faces:        []Rect{},
+		Alternatives: []CropHint{},
+	}
+
+	for _, face := range crop.Faces {
+		analysis.Faces = append(analysis.Faces, newRect(face))
+	}
+	for _, alt := range crop.Alternatives {
+		analysis.Alternatives = append(analysis.Alternatives, newCropHint(alt))
+	}
+
+	return analysis, nil
+}
+
+func newCropHint(crop smartcrop.Crop) CropHint {
+	return CropHint{
+		Rect: Rect{X: crop.X, Y: crop.Y, Width: crop.Width, Height: crop.Height},
+		Score: Score{
+			Detail:     crop.Score.Detail,
+			Saturation: crop.Score.Saturation,
+			Skin:       crop.Score.Skin,
+			Total:      crop.Score.Total,
+		},
+	}
+}
+
+func newRect(r image.Rectangle) Rect {
+	return Rect{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
@@ -0,0 +1,80 @@
+package image
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go test ./image -run Test_MakeAnalysis_Crop -v
+func Test_MakeAnalysis_Crop(t *testing.T) {
+	path := writeTestProfiles(t, `{"profiles": {"faces": {"face_detection": true}}}`)
+	defer os.Remove(path)
+	defer LoadCropProfiles(writeTestProfiles(t, "{}"))
+	assert.Nil(t, LoadCropProfiles(path))
+
+	img := getMockImageJPEG()
+	img.SetDefaults(Options{CropProfile: "faces"})
+	analysis, err := MakeAnalysis("analyze=crop;200:100", img)
+
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, int64(200), analysis.Width)
+	assert.Equal(t, int64(100), analysis.Height)
+	assert.Len(t, analysis.Faces, 1)
+	assert.True(t, len(analysis.Alternatives) <= analyzeAlternatives)
+	for _, alt := range analysis.Alternatives {
+		assert.True(t, alt.Score.Total <= analysis.Crop.Score.Total)
+	}
+
+	// the image is left untouched.
+	assert.Equal(t, img.GetImage().SourceWidth, img.GetImage().Width)
+}
+
+//go test ./image -run Test_MakeAnalysis_Alternatives -v
+func Test_MakeAnalysis_Alternatives(t *testing.T) {
+	img := getMockImageJPEG()
+	analysis, err := MakeAnalysis("analyze=crop;200:100;0", img)
+
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Len(t, analysis.Alternatives, 0)
+}
+
+//go test ./image -run Test_MakeAnalysis_GIF -v
+func Test_MakeAnalysis_GIF(t *testing.T) {
+	img := getMockImageGIF()
+	analysis, err := MakeAnalysis("analyze=crop;200:100", img)
+
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, analysis.X >= 0 && analysis.X <= 700)
+	assert.True(t, analysis.Y >= 0 && analysis.Y <= 350)
+}
+
+//go test ./image -run Test_MakeAnalysis_Invalid -v
+func Test_MakeAnalysis_Invalid(t *testing.T) {
+	img := getMockImageGIF()
+
+	for _, q := range []string{
+		"analyze=crop",
+		"analyze=resize;200:100",
+		"analyze=crop;200",
+		"analyze=crop;200:100;a",
+		"analyze=crop;200:100;50",
+		"analyze=crop;2000:100",
+	} {
+		_, err := MakeAnalysis(q, img)
+		assert.NotNil(t, err, q)
+	}
+}
+
+//go test ./image -run Test_IsAnalyze -v
+func Test_IsAnalyze(t *testing.T) {
+	assert.True(t, IsAnalyze("frame=1&analyze=crop;200:100"))
+	assert.False(t, IsAnalyze("crop=200:100"))
+}
@@ -5,34 +5,47 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"time"
 
+	"image"
 	"image/gif"
 	"image/jpeg"
+	"image/png"
 )
 
 // MutableImage represents the gif/jpeg/png...etc type that will be responsible for transforming the Image struct.
 type MutableImage interface {
-	SetDimensions() error              // SetDimensions initializes the image. Will load vips pointer and figure out the image size.
-	SetDefaults(o Options)             // SetDefaults sets the default parameters.
-	ApplyChanges() error               // ApplyChanges applies the changes we have been making from temp data back into original data.
-	Crop(o *CropOperation) error       // Crop crops the image.
-	Resize(o *ResizeOperation) error   // resizes the image
-	Quality(o *QualityOperation) error // Quality sets quality (1-100)
-	Density(o *DensityOperation) error // Density sets density (1,2).
-	GetImage() *Image                  // GetImage returns the image binary data.
-	Shutdown()                         // Shutdown shuts down the image, clears any memory ref.
+	SetDimensions() error                  // SetDimensions initializes the image. Will load vips pointer and figure out the image size.
+	SetDefaults(o Options)                 // SetDefaults sets the default parameters.
+	ApplyChanges() error                   // ApplyChanges applies the changes we have been making from temp data back into original data.
+	Crop(o *CropOperation) error           // Crop crops the image.
+	Resize(o *ResizeOperation) error       // resizes the image
+	Quality(o *QualityOperation) error     // Quality sets quality (1-100)
+	Density(o *DensityOperation) error     // Density sets density (1,2).
+	BlurFaces(o *BlurFacesOperation) error // BlurFaces blurs the faces found in the image.
+	GetImage() *Image                      // GetImage returns the image binary data.
+	Shutdown()                             // Shutdown shuts down the image, clears any memory ref.
 }
 
 // Image is a struct that holds the basic informations of any single image to be transformed upon.
 type Image struct {
-	Data         []byte // Image data got from S3/URL
-	Type         string // Image type
-	Animated     bool   // Is this animated
-	Size         int64  // Image size
-	Width        int64  // Image width
-	Height       int64  // Image height
-	SourceWidth  int64  // Source image width
-	SourceHeight int64  // Source image height
+	Data         []byte    // Image data got from S3/URL
+	Type         string    // Image type
+	Animated     bool      // Is this animated
+	Size         int64     // Image size
+	Width        int64     // Image width
+	Height       int64     // Image height
+	SourceWidth  int64     // Source image width
+	SourceHeight int64     // Source image height
+	CropProfile  string    // Smartcrop profile auto crops are analyzed with
+	BlurFaces    bool      // Faces were blurred by blur-faces
+	FacesBlurred int       // Number of faces blurred by blur-faces
+	ETag         string    // Strong ETag of the output, sent to clients revalidating it
+	LastModified string    // Last-Modified of the source, as sent by its origin
+	Fallback     bool      // The site's fallback, served instead of a missing image
+	Rendered     time.Time // When the image was processed, its age in the output cache
+	Debug        bool      // Smartcrop's debug visualization, served instead of the image and never cached
+	SourceID     string    // Identifies the source across requests, like its site, path and ETag, for the saliency cache
 }
 
 func (i *Image) SetSourceDimensions() {
@@ -92,6 +105,7 @@ func MakeImage(data []byte, pipelineID, rawQuery string) (MutableImage, error) {
 			ImageData:  img,
 			PipelineID: pipelineID,
 			Type:       img.Type,
+			source:     data,
 		}
 
 	default:
@@ -117,6 +131,11 @@ func GetFileType(data []byte) string {
 
 // MakeOperations parses out a request's query parameters and attempts to convert them into valid Image operations
 func MakeOperations(rawQuery string, imgObj MutableImage) ([]Operations, error) {
+	return Policy{}.MakeOperations(rawQuery, imgObj)
+}
+
+// MakeOperations is MakeOperations, for the operations p allows, bounded by p.
+func (p Policy) MakeOperations(rawQuery string, imgObj MutableImage) ([]Operations, error) {
 	//Break query string up
 	bits := strings.SplitN(rawQuery, "&", -1)
 	operations := make([]Operations, 0, maxOperations)
@@ -138,12 +157,15 @@ func MakeOperations(rawQuery string, imgObj MutableImage) ([]Operations, error)
 	// of each operations.
 	width := imgObj.GetImage().Width
 	height := imgObj.GetImage().Height
+	debug := IsDebug(rawQuery)
 	for _, bit := range bits {
 
 		//initialize new operation.
 		operation := ImageOperation{
 			ImageWidth:  width,
 			ImageHeight: height,
+			Gravity:     p.gravity(),
+			Upscale:     p.Upscale,
 			Image:       &imgObj,
 		}
 
@@ -156,6 +178,9 @@ func MakeOperations(rawQuery string, imgObj MutableImage) ([]Operations, error)
 		}
 		action := split[0]
 		params := strings.Split(split[1], ";")
+		if !p.allows(action) {
+			return nil, fmt.Errorf("operation [%v] is not allowed for this site", action)
+		}
 
 		newOp, err := operation.Make(params, action)
 		if err != nil {
@@ -166,6 +191,10 @@ func MakeOperations(rawQuery string, imgObj MutableImage) ([]Operations, error)
 			continue
 		}
 
+		if cropOp, ok := newOp.(*CropOperation); ok {
+			cropOp.Debug = debug
+		}
+
 		// if new width is zero, that means width isn't affected by this operation.
 		if operation.NewWidth > 0 {
 			width = operation.NewWidth
@@ -178,6 +207,11 @@ func MakeOperations(rawQuery string, imgObj MutableImage) ([]Operations, error)
 		operations = append(operations, newOp)
 	}
 
+	// outputs larger than the policy allows are scaled down to fit.
+	if fit, ok := p.fit(width, height, &imgObj); ok && len(operations) > 0 {
+		operations = append(operations, fit)
+	}
+
 	//if we have more than one operation, we add an additional operation to apply changes.
 	if len(operations) > 0 {
 		operations = append(operations, &ApplyOperation{Image: &imgObj})
@@ -191,6 +225,39 @@ func IsFirstFrame(rawQuery string) bool {
 	return strings.Contains(rawQuery, "frame=1")
 }
 
+// IsDebug figures out if "debug=smartcrop" exists in our url parameter.
+func IsDebug(rawQuery string) bool {
+	return strings.Contains(rawQuery, "debug=smartcrop")
+}
+
+// DebugImage returns the smartcrop debug visualization of the last auto positioned crop in o as a png.
+func DebugImage(o []Operations) (*Image, error) {
+	var debug image.Image
+	for _, op := range o {
+		if cropOp, ok := op.(*CropOperation); ok && cropOp.DebugImage != nil {
+			debug = cropOp.DebugImage
+		}
+	}
+
+	if debug == nil {
+		return nil, fmt.Errorf("debug=smartcrop requires an auto positioned crop")
+	}
+
+	b := new(bytes.Buffer)
+	if err := png.Encode(b, debug); err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		Data:   b.Bytes(),
+		Type:   PNG,
+		Size:   int64(b.Len()),
+		Width:  int64(debug.Bounds().Dx()),
+		Height: int64(debug.Bounds().Dy()),
+		Debug:  true,
+	}, nil
+}
+
 // DoTransformation performs the transformation as defined by p.operations
 func DoTransformation(o []Operations) error {
 	if len(o) == 0 {
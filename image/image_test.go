@@ -1,6 +1,7 @@
 package image
 
 import (
+	"image/color"
 	"io/ioutil"
 	"reflect"
 	"testing"
@@ -8,6 +9,10 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+func init() {
+	HaarCascadesPath = "../data/haarcascades/"
+}
+
 //go test -run Test_Image_MakeImage_noData -v
 func Test_Image_MakeImage_noData(t *testing.T) {
 	var data []byte
@@ -108,6 +113,77 @@ func Test_Image_MakeOperation_NormalCropResize(t *testing.T) {
 	assert.Equal(t, nil, err)
 }
 
+//go test ./image -run Test_Policy_MakeOperations_notAllowed -v
+func Test_Policy_MakeOperations_notAllowed(t *testing.T) {
+	img := getMockImageJPEG()
+	p := Policy{Operations: []string{"resize"}}
+
+	op, err := p.MakeOperations("crop=200:200;0,0&resize=200:*", img)
+	assert.Nil(t, op)
+	assert.Equal(t, "operation [crop] is not allowed for this site", err.Error())
+
+	_, err = p.MakeOperations("resize=200:*&token=abc", img)
+	assert.Nil(t, err)
+}
+
+//go test ./image -run Test_Policy_MakeOperations_maxDimensions -v
+func Test_Policy_MakeOperations_maxDimensions(t *testing.T) {
+	img := getMockImageJPEG()
+	p := Policy{MaxWidth: 100}
+
+	// the 500x375 test image is scaled down to fit, after the requested operations.
+	op, err := p.MakeOperations("crop=400:300;0,0", img)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(op))
+	resize := op[1].(*ResizeOperation)
+	assert.Equal(t, int64(100), resize.NewWidth)
+	assert.Equal(t, int64(75), resize.NewHeight)
+
+	// outputs within the dimensions aren't resized.
+	op, _ = p.MakeOperations("resize=80:*", img)
+	assert.Equal(t, 2, len(op))
+}
+
+//go test ./image -run Test_Policy_MakeOperations_noPolicy -v
+func Test_Policy_MakeOperations_noPolicy(t *testing.T) {
+	data, err := SolidPlaceholder(4000, 3000, color.White)
+	assert.Nil(t, err)
+	img, err := MakeImage(data, "1", "")
+	assert.Nil(t, err)
+
+	// sites without a policy get the zero Policy, which fits outputs within maxWidth by maxHeight.
+	op, err := Policy{}.MakeOperations("output-quality=80", img)
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(op)) {
+		resize := op[1].(*ResizeOperation)
+		assert.Equal(t, maxWidth, resize.NewWidth)
+		assert.Equal(t, int64(2250), resize.NewHeight)
+	}
+
+	op, _ = Policy{}.MakeOperations("resize=2000:*", img)
+	assert.Equal(t, 2, len(op))
+}
+
+//go test ./image -run Test_Policy_gravity -v
+func Test_Policy_gravity(t *testing.T) {
+	assert.Equal(t, []string{"center", "top"}, Policy{}.gravity())
+	assert.Equal(t, []string{"left", "bottom"}, Policy{Gravity: "left,bottom"}.gravity())
+}
+
+//go test ./image -run Test_Policy_upscale -v
+func Test_Policy_upscale(t *testing.T) {
+	img := getMockImageJPEG()
+
+	resize := &ResizeOperation{NewWidth: 1000, NewHeight: 750, Image: &img}
+	assert.False(t, resize.IsValid())
+	resize.Upscale = true
+	assert.True(t, resize.IsValid())
+
+	op, err := Policy{Upscale: true}.MakeOperations("resize=1000:*", img)
+	assert.Nil(t, err)
+	assert.True(t, op[0].(*ResizeOperation).Upscale)
+}
+
 //go test -run Test_Image_DoTransformation_NoOperations -v
 func Test_Image_DoTransformation_NoOperations(t *testing.T) {
 	op := []Operations(nil)
@@ -227,3 +303,49 @@ func Test_Resize_Crop_AutoPosition(t *testing.T) {
 	assert.Equal(t, int64(100), img.GetImage().Height)
 	assert.Equal(t, nil, err)
 }
+
+//go test ./image -run Test_Crop_AutoPosition_GIF -v
+func Test_Crop_AutoPosition_GIF(t *testing.T) {
+	img := getMockImageGIF()
+	op, _ := MakeOperations("crop=200:100;auto,auto", img)
+	err := DoTransformation(op)
+
+	assert.Equal(t, int64(200), img.GetImage().Width)
+	assert.Equal(t, int64(100), img.GetImage().Height)
+	assert.Equal(t, true, img.GetImage().Animated)
+	assert.Equal(t, nil, err)
+}
+
+//go test ./image -run Test_Image_DebugImage -v
+func Test_Image_DebugImage(t *testing.T) {
+	img := getMockImageGIF()
+	ops, err := MakeOperations("crop=200:100;auto,auto&debug=smartcrop", img)
+	assert.Nil(t, err)
+
+	// only the crop itself is needed for the analysis.
+	assert.Nil(t, ops[0].Do())
+
+	debug, err := DebugImage(ops)
+	assert.Nil(t, err)
+	assert.Equal(t, PNG, debug.Type)
+	assert.True(t, debug.Width > 0 && debug.Height > 0)
+	assert.True(t, debug.Debug)
+}
+
+//go test ./image -run Test_Image_DebugImage_NoAutoCrop -v
+func Test_Image_DebugImage_NoAutoCrop(t *testing.T) {
+	img := getMockImageGIF()
+	ops, err := MakeOperations("crop=200:100;center,center&debug=smartcrop", img)
+	assert.Nil(t, err)
+	assert.Nil(t, ops[0].Do())
+
+	_, err = DebugImage(ops)
+	assert.NotNil(t, err)
+}
+
+//go test ./image -run Test_Image_MakeOperation_InvalidDebug -v
+func Test_Image_MakeOperation_InvalidDebug(t *testing.T) {
+	img := getMockImageGIF()
+	_, err := MakeOperations("crop=200:100;auto,auto&debug=faces", img)
+	assert.NotNil(t, err)
+}
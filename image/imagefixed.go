@@ -2,13 +2,23 @@
 package image
 
 import (
+	"bytes"
 	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"time"
 
 	"github.com/bvchevez/imageprocess/helper"
 	"github.com/h2non/bimg"
 )
 
+// bimgTypes are the bimg types of the formats fixed images can be converted to.
+var bimgTypes = map[string]bimg.ImageType{
+	JPEG: bimg.JPEG,
+	PNG:  bimg.PNG,
+}
+
 // ImageFixed is a struct that represents a non-animated image, such as jpeg/png/tiff/webm
 type ImageFixed struct {
 	PipelineID       string
@@ -16,7 +26,11 @@ type ImageFixed struct {
 	NewQuality       int64  // Quality to save this to.
 	NewDensity       int64  // Final density for this image.
 	Type             string // Image MIME
+	NewType          string // MIME to save this to, empty keeps Type.
 	BicubicThreshold int64  // Minimum pixels we want before converting to bicubic
+
+	source  []byte // source is the data before any operation, auto crops are analyzed on it.
+	cropped bool   // cropped is set once the data no longer shows the whole source.
 }
 
 // SetDimensions initializes ImageData with actual image width and height.
@@ -38,6 +52,8 @@ func (i *ImageFixed) SetDefaults(o Options) {
 	i.NewQuality = o.Quality
 	i.NewDensity = o.Density
 	i.BicubicThreshold = o.BicubicThreshold
+	i.NewType = o.Format
+	i.ImageData.CropProfile = o.CropProfile
 }
 
 // ApplyChanges applies anything other than Resize or Crop (such as Density, Quality, colorspace... etc)
@@ -60,11 +76,21 @@ func (i *ImageFixed) ApplyChanges() error {
 	//make sure this image is sRGB colorspace.
 	opt.Interpretation = bimg.InterpretationSRGB
 
+	// converts the image to the format of its site, if it has one.
+	newType, convert := bimgTypes[i.NewType]
+	if convert && i.NewType != i.Type {
+		opt.Type = newType
+	}
+
 	imgByte, err := bimg.Resize(i.ImageData.Data, opt)
 	if err != nil {
 		return err
 	}
 
+	if opt.Type != bimg.UNKNOWN {
+		i.Type = i.NewType
+		i.ImageData.Type = i.NewType
+	}
 	i.ImageData.Data = imgByte
 	i.SetDimensions()
 	return nil
@@ -87,6 +113,7 @@ func (i *ImageFixed) Resize(o *ResizeOperation) error {
 		Height:       int(o.NewHeight),
 		Quality:      100,
 		Force:        true,
+		Enlarge:      o.Upscale,
 		Interpolator: bimg.Bilinear,
 	}
 
@@ -134,6 +161,52 @@ func (i *ImageFixed) Crop(o *CropOperation) error {
 	}
 
 	i.ImageData.Data = newByte
+	i.cropped = true
+	i.SetDimensions()
+	return nil
+}
+
+// BlurFaces blurs the faces in the image. The image is decoded and encoded again in go,
+// losslessly for png and at full quality for jpeg, as quality is applied afterwards.
+func (i *ImageFixed) BlurFaces(o *BlurFacesOperation) error {
+	defer helper.Timer(helper.TimerPayload{
+		Start: time.Now(),
+		Name:  "(" + i.PipelineID + ") " + i.Type + " blur faces",
+	})
+
+	if o.IsValid() == false {
+		return fmt.Errorf("Blur faces sigma [%v] is out of bounds.", o.Sigma)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(i.ImageData.Data))
+	if err != nil {
+		return fmt.Errorf("blur-faces is not supported for [%s]: %s", i.Type, err)
+	}
+
+	faces, err := o.FindFaces(src)
+	if err != nil {
+		return err
+	}
+
+	i.ImageData.BlurFaces = true
+	i.ImageData.FacesBlurred = len(faces)
+	if len(faces) == 0 {
+		return nil
+	}
+
+	b := new(bytes.Buffer)
+	if i.Type == JPEG {
+		err = jpeg.Encode(b, o.Blur(src, faces), &jpeg.Options{Quality: 100})
+	} else {
+		err = png.Encode(b, o.Blur(src, faces))
+	}
+	if err != nil {
+		return err
+	}
+
+	i.ImageData.Data = b.Bytes()
+	i.ImageData.Type = GetFileType(i.ImageData.Data)
+	i.Type = i.ImageData.Type
 	i.SetDimensions()
 	return nil
 }
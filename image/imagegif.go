@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"time"
 
+	"image"
+	"image/draw"
 	"image/gif"
 	"os/exec"
 
@@ -22,6 +24,9 @@ type ImageGIF struct {
 
 	QualityOp bool  // QualityOp triggers quality
 	Colors    int64 // Color we want to display.
+	Lossy     int64 // Lossy is the gifsicle lossy compression level, 0 means lossless.
+
+	NewDensity int64 // Final density for this gif.
 
 	ResizeOp     bool  // ResizeOp triggers resizing
 	ResizeWidth  int64 // ResizeWidth stores the width we want resize to be
@@ -41,8 +46,21 @@ func (i *ImageGIF) SetDimensions() error {
 	return nil
 }
 
-// set default data.
-func (i *ImageGIF) SetDefaults(o Options) {}
+// SetDefaults sets default data. An explicit color count takes precedence over one derived from quality.
+func (i *ImageGIF) SetDefaults(o Options) {
+	i.NewDensity = o.Density
+	i.Lossy = o.Lossy
+	i.ImageData.CropProfile = o.CropProfile
+
+	switch {
+	case o.Colors > 0:
+		i.QualityOp = true
+		i.Colors = o.Colors
+	case o.Quality > 0:
+		i.QualityOp = true
+		i.Colors = quality2colors(o.Quality)
+	}
+}
 
 // ApplyChanges applies the changes on the gif (currently acts as a stub to satisfy interface)
 func (i *ImageGIF) ApplyChanges() error {
@@ -50,6 +68,21 @@ func (i *ImageGIF) ApplyChanges() error {
 
 	args := []string{}
 
+	// density is applied through resize, on top of whatever size the gif would otherwise end up with.
+	resizeOp, resizeWidth, resizeHeight := i.ResizeOp, i.ResizeWidth, i.ResizeHeight
+	if i.NewDensity == 2 {
+		if resizeOp == false {
+			resizeWidth, resizeHeight = i.ImageData.Width, i.ImageData.Height
+			if i.CropOp == true {
+				resizeWidth, resizeHeight = i.CropWidth, i.CropHeight
+			}
+		}
+
+		resizeOp = true
+		resizeWidth *= 2
+		resizeHeight *= 2
+	}
+
 	// --crop=x1,y1+WxH
 	if i.CropOp == true {
 		args = append(
@@ -59,10 +92,10 @@ func (i *ImageGIF) ApplyChanges() error {
 	}
 
 	// --resize=WxH
-	if i.ResizeOp == true {
+	if resizeOp == true {
 		args = append(
 			args,
-			fmt.Sprintf("--resize=%dx%d", i.ResizeWidth, i.ResizeHeight),
+			fmt.Sprintf("--resize=%dx%d", resizeWidth, resizeHeight),
 		)
 	}
 
@@ -74,6 +107,14 @@ func (i *ImageGIF) ApplyChanges() error {
 		)
 	}
 
+	// --lossy=N
+	if i.Lossy > 0 {
+		args = append(
+			args,
+			fmt.Sprintf("--lossy=%d", i.Lossy),
+		)
+	}
+
 	defer helper.Timer(helper.TimerPayload{
 		Start: time.Now(),
 		Name:  fmt.Sprintf("(%s) GIF ApplyChanges %s", i.PipelineID, args),
@@ -148,22 +189,75 @@ func (i *ImageGIF) Crop(o *CropOperation) error {
 	return nil
 }
 
-// Density does not apply to gifs.
+// Density sets the density for our gif but doesn't actually apply the density.
 func (i *ImageGIF) Density(o *DensityOperation) error {
+	i.NewDensity = o.NewDensity
 	return nil
 }
 
+// BlurFaces isn't supported for animated gifs, faces would have to be found and blurred in every frame.
+func (i *ImageGIF) BlurFaces(o *BlurFacesOperation) error {
+	return fmt.Errorf("blur-faces is not supported for animated gifs, use it with frame=1")
+}
+
 // Quality determines the gif quality by the amount of colors its using.
 func (i *ImageGIF) Quality(o *QualityOperation) error {
 	i.QualityOp = true
-
-	// Quality can be between 1 and 100. We need to conver thtat into colors
-	// which can be anywhere between 2 and 256.
-	i.Colors = int64((float64(o.NewQuality) * 2.56))
+	i.Colors = quality2colors(o.NewQuality)
 
 	return nil
 }
 
+// Frames returns up to n frames sampled evenly across the animation.
+// Frames are composited the way they would be displayed, since a gif frame only holds what changed since the last one.
+func (i *ImageGIF) Frames(n int) []image.Image {
+	frames := []image.Image{}
+	if n < 1 || len(i.gifDecoded.Image) == 0 {
+		return frames
+	}
+
+	bounds := image.Rect(0, 0, i.gifDecoded.Config.Width, i.gifDecoded.Config.Height)
+	if bounds.Empty() {
+		bounds = i.gifDecoded.Image[0].Bounds()
+	}
+
+	step := len(i.gifDecoded.Image) / n
+	if step < 1 {
+		step = 1
+	}
+
+	canvas := image.NewRGBA(bounds)
+	for idx, frame := range i.gifDecoded.Image {
+		var disposal byte
+		if idx < len(i.gifDecoded.Disposal) {
+			disposal = i.gifDecoded.Disposal[idx]
+		}
+
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			draw.Draw(previous, bounds, canvas, bounds.Min, draw.Src)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		if idx%step == 0 && len(frames) < n {
+			snapshot := image.NewRGBA(bounds)
+			draw.Draw(snapshot, bounds, canvas, bounds.Min, draw.Src)
+			frames = append(frames, snapshot)
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.ZP, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return frames
+}
+
 // GetImage returns the image data
 func (i *ImageGIF) GetImage() *Image {
 	return i.ImageData
@@ -171,3 +265,9 @@ func (i *ImageGIF) GetImage() *Image {
 
 // Shutdown represents all clean up actions necessary after transformation is complete.
 func (i *ImageGIF) Shutdown() {}
+
+// quality2colors converts quality, which can be between 1 and 100, into colors
+// which can be anywhere between 2 and 256.
+func quality2colors(quality int64) int64 {
+	return int64((float64(quality) * 2.56))
+}
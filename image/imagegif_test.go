@@ -483,3 +483,139 @@ func Test_ImageGIF_Crop_InvalidInput(t *testing.T) {
 	assert.Equal(t, int64(900), img.GetImage().Width)
 	assert.Equal(t, int64(450), img.GetImage().Height)
 }
+
+//go test -run Test_ImageGIF_SetDefaults_QualityToColors -v
+func Test_ImageGIF_SetDefaults_QualityToColors(t *testing.T) {
+	gif := mockImageGIF()
+
+	// the default quality applies to gifs as a color count.
+	gif.SetDefaults(Options{Quality: 50})
+	assert.Equal(t, true, gif.QualityOp)
+	assert.Equal(t, int64(128), gif.Colors)
+
+	// output-quality in the request overrides it.
+	gif.Quality(&QualityOperation{NewQuality: 25})
+	assert.Equal(t, int64(64), gif.Colors)
+}
+
+//go test -run Test_ImageGIF_SetDefaults_ColorsOverrideQuality -v
+func Test_ImageGIF_SetDefaults_ColorsOverrideQuality(t *testing.T) {
+	gif := mockImageGIF()
+
+	gif.SetDefaults(Options{Quality: 95, Colors: 64, Lossy: 80})
+	assert.Equal(t, true, gif.QualityOp)
+	assert.Equal(t, int64(64), gif.Colors)
+	assert.Equal(t, int64(80), gif.Lossy)
+
+	// output-quality in the request still wins over the defaults.
+	gif.Quality(&QualityOperation{NewQuality: 10})
+	assert.Equal(t, int64(25), gif.Colors)
+}
+
+//go test -run Test_ImageGIF_SetDefaults_NoQuality -v
+func Test_ImageGIF_SetDefaults_NoQuality(t *testing.T) {
+	gif := mockImageGIF()
+
+	gif.SetDefaults(Options{})
+	assert.Equal(t, false, gif.QualityOp)
+	assert.Equal(t, int64(0), gif.Colors)
+}
+
+//go test -run Test_ImageGIF_Density2 -v
+func Test_ImageGIF_Density2(t *testing.T) {
+	img := mockGif("")
+	img.SetDimensions()
+
+	err := img.Density(&DensityOperation{
+		Image:      &img,
+		NewDensity: int64(2),
+	})
+	if err != nil {
+		t.Errorf("Error not expected! [%v]", err)
+	}
+	img.ApplyChanges()
+
+	assert.Equal(t, int64(1800), img.GetImage().Width)
+	assert.Equal(t, int64(900), img.GetImage().Height)
+}
+
+//go test -run Test_ImageGIF_Density2_Resize -v
+func Test_ImageGIF_Density2_Resize(t *testing.T) {
+	img := mockGif("")
+	img.SetDimensions()
+
+	img.Resize(&ResizeOperation{
+		Image:     &img,
+		NewWidth:  200,
+		NewHeight: 100,
+	})
+	img.Density(&DensityOperation{
+		Image:      &img,
+		NewDensity: int64(2),
+	})
+	img.ApplyChanges()
+
+	assert.Equal(t, int64(400), img.GetImage().Width)
+	assert.Equal(t, int64(200), img.GetImage().Height)
+}
+
+//go test -run Test_ImageGIF_Density2_Crop -v
+func Test_ImageGIF_Density2_Crop(t *testing.T) {
+	img := mockGif("")
+	img.SetDimensions()
+
+	img.Crop(&CropOperation{
+		Image:     &img,
+		NewWidth:  200,
+		NewHeight: 100,
+		Position: &point.Point{
+			X: 1,
+			Y: 2,
+		},
+	})
+	img.Density(&DensityOperation{
+		Image:      &img,
+		NewDensity: int64(2),
+	})
+	img.ApplyChanges()
+
+	assert.Equal(t, int64(400), img.GetImage().Width)
+	assert.Equal(t, int64(200), img.GetImage().Height)
+}
+
+//go test -run Test_ImageGIF_Density2_Default -v
+func Test_ImageGIF_Density2_Default(t *testing.T) {
+	img := mockGif("")
+	img.SetDimensions()
+	img.SetDefaults(Options{
+		Quality: 50,
+		Density: 2,
+	})
+
+	img.Resize(&ResizeOperation{
+		Image:     &img,
+		NewWidth:  200,
+		NewHeight: 100,
+	})
+	img.ApplyChanges()
+
+	assert.Equal(t, int64(128), img.(*ImageGIF).Colors)
+	assert.Equal(t, int64(400), img.GetImage().Width)
+	assert.Equal(t, int64(200), img.GetImage().Height)
+}
+
+//go test -run Test_ImageGIF_Frames -v
+func Test_ImageGIF_Frames(t *testing.T) {
+	gif := mockImageGIF()
+
+	frames := gif.Frames(5)
+	assert.Equal(t, 5, len(frames))
+	for _, frame := range frames {
+		assert.Equal(t, 900, frame.Bounds().Dx())
+		assert.Equal(t, 450, frame.Bounds().Dy())
+	}
+
+	// we never return more frames than the gif has.
+	assert.Equal(t, 24, len(gif.Frames(100)))
+	assert.Equal(t, 0, len(gif.Frames(0)))
+}
@@ -26,7 +26,15 @@ type ImageOperation struct {
 	NewDensity  int64 // Pixel density of the image after processing (defaults to 1)
 	NewFrame    bool  // If true, we load first frame only (only valid for gifs)
 
+	BlurSigma    float64 // Sigma of the face blur, or the block size when pixelating
+	BlurMinSize  int64   // Width of the smallest face blurred
+	BlurPixelate bool    // If true, faces are pixelated instead of blurred
+
 	Position *point.Point //(x, y) are coordinates representing bottom left corner of our rectangle.
+	Focus    *point.Point //(x, y) is the focal point the crop is centered on, if any.
+
+	Gravity []string // Gravity is the position of crops without one, center,top when empty.
+	Upscale bool     // Upscale lets resizes enlarge the image.
 
 	Image *MutableImage
 }
@@ -72,6 +80,7 @@ func (i *ImageOperation) Make(params []string, action string) (Operations, error
 		return &ResizeOperation{
 			NewWidth:  i.NewWidth,
 			NewHeight: i.NewHeight,
+			Upscale:   i.Upscale,
 			Image:     i.Image,
 		}, nil
 
@@ -95,8 +104,29 @@ func (i *ImageOperation) Make(params []string, action string) (Operations, error
 			Image:      i.Image,
 		}, nil
 
+	case "blur-faces":
+		if err = i.setBlurFaces(params); err != nil {
+			return nil, err
+		}
+
+		return &BlurFacesOperation{
+			Sigma:    i.BlurSigma,
+			MinSize:  i.BlurMinSize,
+			Pixelate: i.BlurPixelate,
+			Image:    i.Image,
+		}, nil
+
 	case "frame":
 		return nil, nil
+
+	case "debug":
+		if err = i.setDebug(params); err != nil {
+			return nil, err
+		}
+		return nil, nil
+
+	case "token":
+		return nil, nil
 	}
 
 	return nil, fmt.Errorf("invalid operation %v", action)
@@ -139,6 +169,53 @@ func (i *ImageOperation) setFrame(dimensions []string) error {
 
 }
 
+// setDebug validates the debug parameter, smartcrop is the only debug output there is.
+func (i *ImageOperation) setDebug(dimensions []string) error {
+	if len(dimensions) != 1 || dimensions[0] != "smartcrop" {
+		return fmt.Errorf("invalid debug [%v]", strings.Join(dimensions, ";"))
+	}
+
+	return nil
+}
+
+// setBlurFaces sets all parameters necessary to blur faces.
+// params looks like this
+//  {"8"} (gaussian blur with a sigma of 8)
+//  {"8", "40"} (only faces at least 40 pixels wide)
+//  {"8", "40", "pixelate"} (pixelated in blocks of 8 pixels instead)
+func (i *ImageOperation) setBlurFaces(params []string) error {
+	if len(params) > 3 {
+		return fmt.Errorf("too many parameters for blur-faces")
+	}
+
+	sigma, err := strconv.ParseFloat(params[0], 64)
+	if err != nil || sigma <= 0 || sigma > maxBlurSigma {
+		return fmt.Errorf("blur-faces sigma must be a number between 0 and %v, not '%s'", maxBlurSigma, params[0])
+	}
+	i.BlurSigma = sigma
+
+	if len(params) > 1 {
+		minSize, err := strconv.ParseInt(params[1], 10, 64)
+		if err != nil || minSize < 0 {
+			return fmt.Errorf("blur-faces minimum face size must be a number of pixels, not '%s'", params[1])
+		}
+		i.BlurMinSize = minSize
+	}
+
+	if len(params) > 2 {
+		switch params[2] {
+		case "blur":
+			i.BlurPixelate = false
+		case "pixelate":
+			i.BlurPixelate = true
+		default:
+			return fmt.Errorf("blur-faces mode must be 'blur' or 'pixelate', not '%s'", params[2])
+		}
+	}
+
+	return nil
+}
+
 // setDensity sets density, must be of numeric type.
 func (i *ImageOperation) setDensity(dimensions []string) error {
 	if len(dimensions) != 1 {
@@ -185,6 +262,7 @@ func (i *ImageOperation) setResize(params []string) error {
 //  {"0.6xw:0.7xh", "center,center"} //with and height ratio.
 //  {"400:300", "center,center"}
 //  {"400:*", "center,center"} (where * is wildcard, such that should be maintained.)
+//  {"400:300", "focus,0.3,0.6"} (centered on a focal point, see setFocus.)
 func (i *ImageOperation) setCrop(params []string) error {
 	if len(params) > 2 {
 		return fmt.Errorf("too many parameters for crop")
@@ -197,20 +275,24 @@ func (i *ImageOperation) setCrop(params []string) error {
 	inputWidth := dimensions[0]
 	inputHeight := dimensions[1]
 
-	coords := []string{"center", "top"}
+	coords := i.gravity()
 	if len(params) == 2 {
 		coords = strings.Split(params[1], ",")
 	}
-	if len(coords) != 2 {
+	if len(coords) != 2 && coords[0] != "focus" {
 		return fmt.Errorf("crop position must have two coordinates")
 	}
-	xPosition := coords[0]
-	yPosition := coords[1]
 
 	if err := i.setNewDimensions(inputWidth, inputHeight); err != nil {
 		return err
 	}
 
+	if coords[0] == "focus" {
+		return i.setFocus(coords[1:])
+	}
+
+	xPosition := coords[0]
+	yPosition := coords[1]
 	if err := i.setCropPosition(xPosition, yPosition); err != nil {
 		return err
 	}
@@ -223,6 +305,7 @@ func (i *ImageOperation) setCrop(params []string) error {
 // must have 2 relative dimensions, and optionally 2 position parts, like:
 //  {"16:9", "center,top"}
 //  {"4:3"}
+//  {"4:3", "focus,0.3,0.6,1.5"} (centered on a focal point, see setFocus.)
 func (i *ImageOperation) setFill(params []string) error {
 	if len(params) > 2 {
 		return fmt.Errorf("too many parameters for fill")
@@ -235,20 +318,24 @@ func (i *ImageOperation) setFill(params []string) error {
 	aspectWidth := dimensions[0]
 	aspectHeight := dimensions[1]
 
-	coords := []string{"center", "top"}
+	coords := i.gravity()
 	if len(params) == 2 {
 		coords = strings.Split(params[1], ",")
 	}
-	if len(coords) != 2 {
+	if len(coords) != 2 && coords[0] != "focus" {
 		return fmt.Errorf("fill position must have two coordinates")
 	}
-	xPosition := coords[0]
-	yPosition := coords[1]
 
 	if err := i.setFillDimensions(aspectWidth, aspectHeight); err != nil {
 		return err
 	}
 
+	if coords[0] == "focus" {
+		return i.setFocus(coords[1:])
+	}
+
+	xPosition := coords[0]
+	yPosition := coords[1]
 	if err := i.setCropPosition(xPosition, yPosition); err != nil {
 		return err
 	}
@@ -256,6 +343,70 @@ func (i *ImageOperation) setFill(params []string) error {
 	return nil
 }
 
+// gravity returns the position of crops and fills without one.
+func (i *ImageOperation) gravity() []string {
+	if len(i.Gravity) == 0 {
+		return []string{"center", "top"}
+	}
+
+	return i.Gravity
+}
+
+// setFocus centers the crop on a focal point, given in pixels or as ratios of the image width and height,
+// optionally followed by a zoom factor that shrinks the crop around the focal point.
+// params looks like this
+//  {"120", "80"}
+//  {"0.3", "0.6"}
+//  {"0.3xw", "0.6xh"}
+//  {"0.3", "0.6", "2"} (a crop half the size, still centered on the focal point.)
+func (i *ImageOperation) setFocus(params []string) error {
+	if len(params) != 2 && len(params) != 3 {
+		return fmt.Errorf("focus must have two coordinates and an optional zoom")
+	}
+
+	x, err := i.focus2px(params[0], 'w')
+	if err != nil {
+		return fmt.Errorf("focus X position %s", err)
+	}
+	if x < 0 || x > i.ImageWidth {
+		return fmt.Errorf("focus X position is outside image: %d", x)
+	}
+
+	y, err := i.focus2px(params[1], 'h')
+	if err != nil {
+		return fmt.Errorf("focus Y position %s", err)
+	}
+	if y < 0 || y > i.ImageHeight {
+		return fmt.Errorf("focus Y position is outside image: %d", y)
+	}
+
+	if len(params) == 3 {
+		zoom, err := strconv.ParseFloat(params[2], 64)
+		if err != nil || zoom < 1 {
+			return fmt.Errorf("focus zoom must be a number of at least 1, not '%s'", params[2])
+		}
+
+		i.NewWidth = int64(float64(i.NewWidth) / zoom)
+		i.NewHeight = int64(float64(i.NewHeight) / zoom)
+		if i.NewWidth == 0 || i.NewHeight == 0 {
+			return fmt.Errorf("focus zoom is too large: %s", params[2])
+		}
+	}
+
+	i.Focus = &point.Point{X: x, Y: y}
+	return i.setCropPosition("focus", "focus")
+}
+
+// focus2px converts a focal point coordinate to pixels. Plain decimals like "0.3" are ratios of the
+// side given by dir ('w' or 'h'), anything else is handled by pos2px.
+func (i *ImageOperation) focus2px(dim string, dir byte) (int64, error) {
+	if strings.Contains(dim, ".") && helper.IsFloat(dim) {
+		return i.ratio2px(dim + "x" + string(dir))
+	}
+
+	return i.pos2px(dim)
+}
+
 // setNewDimensions calculates our new dimention based on inputWidth or heights.
 // it will automatically process ratio and wildcard and set the newWidth and newHeight in pixels.
 // inputWidth/inputHeight can be any mixture of the following...
@@ -305,7 +456,8 @@ func (i *ImageOperation) setFillDimensions(aspectWidth, aspectHeight string) err
 // setCropPosition takes two strings representing a horizontal and vertical position within the
 // source image from which a crop should be taken, and sets the position in pixels of the left
 // and top of the crop area, either by recognizing the special terms "left", "center", "top", &c.,
-// or by calling pos2px to handle numeric or ratio formats.
+// or by calling pos2px to handle numeric or ratio formats. "focus" centers the crop on i.Focus,
+// keeping it inside the image.
 func (i *ImageOperation) setCropPosition(xPos, yPos string) error {
 	p := &point.Point{X: 0, Y: 0}
 
@@ -319,6 +471,12 @@ func (i *ImageOperation) setCropPosition(xPos, yPos string) error {
 	case xPos == "auto":
 		// deferred below
 
+	case xPos == "focus":
+		p.X = i.Focus.X - i.NewWidth/2
+		if p.X > i.ImageWidth-i.NewWidth {
+			p.X = i.ImageWidth - i.NewWidth
+		}
+
 	default:
 		px, err := i.pos2px(xPos)
 		if err != nil {
@@ -341,6 +499,12 @@ func (i *ImageOperation) setCropPosition(xPos, yPos string) error {
 	case yPos == "auto":
 		// deferred below
 
+	case yPos == "focus":
+		p.Y = i.Focus.Y - i.NewHeight/2
+		if p.Y > i.ImageHeight-i.NewHeight {
+			p.Y = i.ImageHeight - i.NewHeight
+		}
+
 	default:
 		px, err := i.pos2px(yPos)
 		if err != nil {
@@ -0,0 +1,182 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/bvchevez/imageprocess/smartcrop"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// BlurFacesOperation represents the information necessary to anonymize the faces in an image.
+type BlurFacesOperation struct {
+	Sigma    float64 // Sigma of the gaussian blur, or the size of the blocks when pixelating.
+	MinSize  int64   // MinSize is the width of the smallest face blurred, smaller faces are left alone.
+	Pixelate bool    // Pixelate pixelates faces instead of blurring them.
+	Image    *MutableImage
+}
+
+// Do performs the actual blur.
+func (i *BlurFacesOperation) Do() error {
+	img := *i.Image
+	return img.BlurFaces(i)
+}
+
+// IsValid checks that there's a blur to apply.
+func (i *BlurFacesOperation) IsValid() bool {
+	return i.Sigma > 0 && i.Sigma <= maxBlurSigma
+}
+
+func (i *BlurFacesOperation) String() string {
+	return fmt.Sprint("BlurFaces")
+}
+
+// FindFaces detects the faces of img with the image's crop profile, leaving out the ones narrower than MinSize.
+// Faces are grown by blurFacesMargin on every side, haar detections are tight around the eyes and mouth.
+func (i *BlurFacesOperation) FindFaces(img image.Image) ([]image.Rectangle, error) {
+	mutable := *i.Image
+
+	settings := cropSettings(mutable.GetImage().CropProfile)
+	settings.PrescaleMin = blurFacesPrescaleMin
+	settings.Logger = log.WithFields(log.Fields{
+		"pipeline_id":  pipelineID(mutable),
+		"crop_profile": mutable.GetImage().CropProfile,
+	})
+
+	faces, err := smartcrop.DetectFaces(settings, img)
+	if err != nil {
+		return nil, err
+	}
+
+	found := []image.Rectangle{}
+	for _, face := range faces {
+		if int64(face.Dx()) < i.MinSize {
+			continue
+		}
+
+		margin := int(float64(face.Dx()) * blurFacesMargin)
+		found = append(found, face.Inset(-margin).Intersect(img.Bounds()))
+	}
+
+	return found, nil
+}
+
+// Blur returns a copy of img with the faces blurred, or pixelated.
+func (i *BlurFacesOperation) Blur(img image.Image, faces []image.Rectangle) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	draw.Draw(out, b, img, b.Min, draw.Src)
+
+	for _, face := range faces {
+		if i.Pixelate {
+			pixelate(out, face, int(math.Ceil(i.Sigma)))
+		} else {
+			gaussianBlur(out, face, i.Sigma)
+		}
+	}
+
+	return out
+}
+
+// gaussianBlur blurs the pixels of img inside r. Pixels around r are blurred into it,
+// so there's no hard edge, but only r is changed.
+func gaussianBlur(img *image.RGBA, r image.Rectangle, sigma float64) {
+	r = r.Intersect(img.Bounds())
+	if r.Empty() {
+		return
+	}
+
+	radius := int(math.Ceil(sigma * 3))
+	kernel := make([]float64, 2*radius+1)
+	var total float64
+	for k := range kernel {
+		d := float64(k - radius)
+		kernel[k] = math.Exp(-d * d / (2 * sigma * sigma))
+		total += kernel[k]
+	}
+	for k := range kernel {
+		kernel[k] /= total
+	}
+
+	// rows read by the vertical pass, blurred horizontally for the columns of r.
+	src := r.Inset(-radius).Intersect(img.Bounds())
+	w := r.Dx()
+	rows := make([]float64, w*src.Dy()*4)
+
+	for y := src.Min.Y; y < src.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			o := ((y-src.Min.Y)*w + x - r.Min.X) * 4
+			for k, weight := range kernel {
+				p := img.PixOffset(clamp(x+k-radius, src.Min.X, src.Max.X-1), y)
+				for c := 0; c < 4; c++ {
+					rows[o+c] += weight * float64(img.Pix[p+c])
+				}
+			}
+		}
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			var sum [4]float64
+			for k, weight := range kernel {
+				o := ((clamp(y+k-radius, src.Min.Y, src.Max.Y-1)-src.Min.Y)*w + x - r.Min.X) * 4
+				for c := 0; c < 4; c++ {
+					sum[c] += weight * rows[o+c]
+				}
+			}
+
+			p := img.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				img.Pix[p+c] = uint8(math.Min(math.Max(sum[c]+0.5, 0), 255))
+			}
+		}
+	}
+}
+
+// pixelate fills blocks of size x size pixels of img inside r with their average color.
+func pixelate(img *image.RGBA, r image.Rectangle, size int) {
+	r = r.Intersect(img.Bounds())
+	if size < 2 {
+		size = 2
+	}
+
+	for by := r.Min.Y; by < r.Max.Y; by += size {
+		for bx := r.Min.X; bx < r.Max.X; bx += size {
+			block := image.Rect(bx, by, bx+size, by+size).Intersect(r)
+
+			var sum [4]int
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					p := img.PixOffset(x, y)
+					for c := 0; c < 4; c++ {
+						sum[c] += int(img.Pix[p+c])
+					}
+				}
+			}
+
+			n := block.Dx() * block.Dy()
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					p := img.PixOffset(x, y)
+					for c := 0; c < 4; c++ {
+						img.Pix[p+c] = uint8((sum[c] + n/2) / n)
+					}
+				}
+			}
+		}
+	}
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+
+	return v
+}
@@ -0,0 +1,105 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// checkerboard returns a black and white checkerboard of 1 pixel squares.
+func checkerboard(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (x+y)%2 == 0 {
+				img.Set(x, y, color.RGBA{255, 255, 255, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 0, 255})
+			}
+		}
+	}
+
+	return img
+}
+
+//go test ./image -run Test_GaussianBlur -v
+func Test_GaussianBlur(t *testing.T) {
+	img := checkerboard(40, 40)
+	r := image.Rect(10, 10, 30, 30)
+	gaussianBlur(img, r, 2)
+
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			c := img.RGBAAt(x, y)
+			if (image.Point{X: x, Y: y}).In(r) {
+				// the checkerboard blurs to grey.
+				assert.InDelta(t, 128, int(c.R), 8, "(%d, %d)", x, y)
+			} else {
+				assert.True(t, c.R == 0 || c.R == 255, "(%d, %d) changed", x, y)
+			}
+			assert.Equal(t, uint8(255), c.A)
+		}
+	}
+}
+
+//go test ./image -run Test_Pixelate -v
+func Test_Pixelate(t *testing.T) {
+	img := checkerboard(40, 40)
+	r := image.Rect(10, 10, 30, 25)
+	pixelate(img, r, 4)
+
+	// blocks start at the corner of r, and are clipped to it.
+	for _, block := range []image.Rectangle{image.Rect(10, 10, 14, 14), image.Rect(26, 22, 30, 25)} {
+		first := img.RGBAAt(block.Min.X, block.Min.Y)
+		for y := block.Min.Y; y < block.Max.Y; y++ {
+			for x := block.Min.X; x < block.Max.X; x++ {
+				assert.Equal(t, first, img.RGBAAt(x, y))
+			}
+		}
+	}
+	assert.Equal(t, uint8(255), img.RGBAAt(9, 9).R)
+	assert.Equal(t, uint8(0), img.RGBAAt(30, 9).R)
+}
+
+//go test ./image -run Test_ImageFixed_BlurFaces -v
+func Test_ImageFixed_BlurFaces(t *testing.T) {
+	img := getMockImageJPEG()
+	data := img.GetImage().Data
+	width, height := img.GetImage().Width, img.GetImage().Height
+
+	op := &BlurFacesOperation{Sigma: 8, Image: &img}
+	assert.Nil(t, op.Do())
+
+	assert.Equal(t, true, img.GetImage().BlurFaces)
+	assert.Equal(t, 1, img.GetImage().FacesBlurred)
+	assert.Equal(t, JPEG, img.GetImage().Type)
+	assert.Equal(t, width, img.GetImage().Width)
+	assert.Equal(t, height, img.GetImage().Height)
+	assert.False(t, bytes.Equal(data, img.GetImage().Data))
+}
+
+//go test ./image -run Test_ImageFixed_BlurFaces_MinSize -v
+func Test_ImageFixed_BlurFaces_MinSize(t *testing.T) {
+	img := getMockImageJPEG()
+	data := img.GetImage().Data
+
+	// the face is smaller than that, the image is left as it is.
+	op := &BlurFacesOperation{Sigma: 8, MinSize: 2000, Image: &img}
+	assert.Nil(t, op.Do())
+
+	assert.Equal(t, true, img.GetImage().BlurFaces)
+	assert.Equal(t, 0, img.GetImage().FacesBlurred)
+	assert.True(t, bytes.Equal(data, img.GetImage().Data))
+}
+
+//go test ./image -run Test_ImageGIF_BlurFaces -v
+func Test_ImageGIF_BlurFaces(t *testing.T) {
+	img := getMockImageGIF()
+	ops, err := MakeOperations("blur-faces=8", img)
+	assert.Nil(t, err)
+
+	assert.NotNil(t, ops[0].Do())
+}
@@ -2,12 +2,13 @@ package image
 
 import (
 	"fmt"
-	"bytes"
 	"image"
+	"math"
 
-	"github.com/nfnt/resize"
 	"github.com/bvchevez/imageprocess/point"
 	"github.com/bvchevez/imageprocess/smartcrop"
+
+	log "github.com/Sirupsen/logrus"
 )
 
 // CropOperation reprensents the information necessary to perform a Image Crop.
@@ -16,32 +17,86 @@ type CropOperation struct {
 	NewHeight int64
 	Position  *point.Point
 	Image     *MutableImage
+
+	Alternatives int // Alternatives is how many runner-up crops FindBestCrop returns along with the top crop.
+
+	Debug      bool        // Debug has smartcrop render its analysis into DebugImage when auto positioning.
+	DebugImage image.Image // DebugImage is the smartcrop debug visualization.
 }
 
-// FindBestCrop calls smartcrop to analyze the image and returns top crop parameter
+// FindBestCrop calls smartcrop to analyze the image, with the image's crop profile, and returns top crop parameter
+// Animated gifs are analyzed across a sample of their frames, so moving subjects stay in the crop.
+// The analysis is cached, so crops of other sizes of the same image are found without analyzing it again.
 func (i *CropOperation) FindBestCrop() (smartcrop.Crop, error) {
-
 	mutable := *i.Image
-	s := bytes.NewReader(mutable.GetImage().Data)
-	img, _, err := image.Decode(s)
+
+	settings := cropSettings(mutable.GetImage().CropProfile)
+	settings.Alternatives = i.Alternatives
+	settings.DebugMode = i.Debug
+	settings.Logger = log.WithFields(log.Fields{
+		"pipeline_id":  pipelineID(mutable),
+		"crop_profile": mutable.GetImage().CropProfile,
+	})
+	analyzer := smartcrop.NewAnalyzerWithCropSettings(settings)
+
+	s, err := findSaliency(analyzer, mutable)
 	if err != nil {
 		return smartcrop.Crop{}, fmt.Errorf(err.Error())
 	}
 
-	settings := smartcrop.CropSettings{
-		FaceDetection: true,
-		FaceDetectionHaarCascadeFilepath: appPath + HaarCascadeFrontalFaceAlt,
-		InterpolationType: resize.Bicubic,
-		//DebugMode: true,
+	// the saliency may be of the source, before a resize, so the crop is found at the source's size
+	// and scaled back to the image.
+	size := s.Size()
+	sx := float64(size.X) / float64(mutable.GetImage().Width)
+	sy := float64(size.Y) / float64(mutable.GetImage().Height)
+	cropSize := image.Point{
+		X: clamp(int(math.Floor(float64(i.NewWidth)*sx+0.5)), 1, size.X),
+		Y: clamp(int(math.Floor(float64(i.NewHeight)*sy+0.5)), 1, size.Y),
+	}
+
+	// crops look something like
+	// {X:98 Y:0 Width:882 Height:441 Score:{Detail:-2.4122274199066016 Saturation:21.35539732757885 Skin:935.1400903412627 Total:0.006516884013613292}}
+	crops, err := analyzer.FindBestCrops(s, []image.Point{cropSize})
+	if err != nil {
+		return smartcrop.Crop{}, err
 	}
-	analyzer := smartcrop.NewAnalyzerWithCropSettings(settings)
-	cropWidth := i.NewWidth
-	cropHeight := i.NewHeight
 
-	// crop returns something like
-	// crop: {X:98 Y:0 Width:882 Height:441 Score:{Detail:-2.4122274199066016 Saturation:21.35539732757885 Skin:935.1400903412627 Total:0.006516884013613292}}
-	crop, err := analyzer.FindBestCrop2(img, int(cropWidth), int(cropHeight))
-	return crop, err
+	return scaleCrop(crops[0], 1/sx, 1/sy), nil
+}
+
+// scaleCrop scales the crop, its faces and alternatives by sx and sy.
+func scaleCrop(crop smartcrop.Crop, sx, sy float64) smartcrop.Crop {
+	if sx == 1 && sy == 1 {
+		return crop
+	}
+
+	rect := scaleRect(image.Rect(crop.X, crop.Y, crop.X+crop.Width, crop.Y+crop.Height), sx, sy)
+	crop.X, crop.Y = rect.Min.X, rect.Min.Y
+	crop.Width, crop.Height = rect.Dx(), rect.Dy()
+
+	faces := make([]image.Rectangle, len(crop.Faces))
+	for idx, face := range crop.Faces {
+		faces[idx] = scaleRect(face, sx, sy)
+	}
+	crop.Faces = faces
+
+	alternatives := make([]smartcrop.Crop, len(crop.Alternatives))
+	for idx, alternative := range crop.Alternatives {
+		alternatives[idx] = scaleCrop(alternative, sx, sy)
+	}
+	crop.Alternatives = alternatives
+
+	return crop
+}
+
+// scaleRect scales the rectangle by sx and sy, rounding to the nearest pixel.
+func scaleRect(rect image.Rectangle, sx, sy float64) image.Rectangle {
+	return image.Rect(
+		int(math.Floor(float64(rect.Min.X)*sx+0.5)),
+		int(math.Floor(float64(rect.Min.Y)*sy+0.5)),
+		int(math.Floor(float64(rect.Max.X)*sx+0.5)),
+		int(math.Floor(float64(rect.Max.Y)*sy+0.5)),
+	)
 }
 
 // Do performs the actual crop operation
@@ -59,34 +114,58 @@ func (i *CropOperation) Do() error {
 			return fmt.Errorf(err.Error())
 		}
 
-		width := img.GetImage().Width
-		height := img.GetImage().Height
+		i.Position = i.AutoPosition(crop)
+		i.DebugImage = crop.Debug
+	}
 
-		// set auto crop coordinates
-		if pos.X < 0 {
-			pos.X = int64(crop.X) + (int64(crop.Width) - i.NewWidth) / 2
-		}
-		if pos.Y < 0 {
-			pos.Y = int64(crop.Y) + (int64(crop.Height) - i.NewHeight) / 2
-		}
+	return img.Crop(i)
+}
 
-		// fit crop window if flowing outside the image
-		if pos.X > width - i.NewWidth {
-			pos.X = width - i.NewWidth
-		}
-		if pos.Y > height - i.NewHeight {
-			pos.Y = height - i.NewHeight
-		}
+// AutoPosition centers the crop window on the smartcrop result, keeping it inside the image.
+// Only the coordinates set to auto (negative) are replaced.
+func (i *CropOperation) AutoPosition(crop smartcrop.Crop) *point.Point {
+	img := *i.Image
+	pos := &point.Point{X: i.Position.X, Y: i.Position.Y}
 
-		if pos.X < 0 {
-			pos.X = 0
-		}
-		if pos.Y < 0 {
-			pos.Y = 0
-		}
+	width := img.GetImage().Width
+	height := img.GetImage().Height
+
+	// set auto crop coordinates
+	if pos.X < 0 {
+		pos.X = int64(crop.X) + (int64(crop.Width) - i.NewWidth) / 2
+	}
+	if pos.Y < 0 {
+		pos.Y = int64(crop.Y) + (int64(crop.Height) - i.NewHeight) / 2
 	}
 
-	return img.Crop(i)
+	// fit crop window if flowing outside the image
+	if pos.X > width - i.NewWidth {
+		pos.X = width - i.NewWidth
+	}
+	if pos.Y > height - i.NewHeight {
+		pos.Y = height - i.NewHeight
+	}
+
+	if pos.X < 0 {
+		pos.X = 0
+	}
+	if pos.Y < 0 {
+		pos.Y = 0
+	}
+
+	return pos
+}
+
+// pipelineID returns the id of the pipeline the image is transformed by.
+func pipelineID(mutable MutableImage) string {
+	switch img := mutable.(type) {
+	case *ImageFixed:
+		return img.PipelineID
+	case *ImageGIF:
+		return img.PipelineID
+	}
+
+	return ""
 }
 
 // IsValid checks if crop is even necessary. (if crop size is the same or greater than image size, we return false.)
@@ -8,6 +8,7 @@ import (
 type ResizeOperation struct {
 	NewWidth  int64
 	NewHeight int64
+	Upscale   bool // Upscale lets the resize enlarge the image, it's ignored otherwise.
 	Image     *MutableImage
 }
 
@@ -21,8 +22,8 @@ func (i *ResizeOperation) Do() error {
 func (i *ResizeOperation) IsValid() bool {
 	img := *i.Image
 
-	//We cannot "resize" to something that's bigger than the image itself.
-	if i.NewWidth > img.GetImage().Width || i.NewHeight > img.GetImage().Height {
+	//We cannot "resize" to something that's bigger than the image itself, unless upscaling.
+	if !i.Upscale && (i.NewWidth > img.GetImage().Width || i.NewHeight > img.GetImage().Height) {
 		return false
 	}
 
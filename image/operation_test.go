@@ -1039,3 +1039,140 @@ func Test_setNewDimensions_bothWildcard(t *testing.T) {
 	assert.Equal(t, int64(0), op.NewWidth)
 	assert.Equal(t, "height and width cannot both be '*'", err.Error())
 }
+
+//go test -run Test_setCrop_focus -v
+func Test_setCrop_focus(t *testing.T) {
+	op := ImageOperation{
+		ImageWidth:  500,
+		ImageHeight: 300,
+	}
+
+	// ratios of width and height.
+	err := op.setCrop([]string{"200:100", "focus,0.3,0.6"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(50), op.Position.X)
+	assert.Equal(t, int64(130), op.Position.Y)
+
+	// pixels.
+	err = op.setCrop([]string{"200:100", "focus,300,100"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(200), op.Position.X)
+	assert.Equal(t, int64(50), op.Position.Y)
+
+	// explicit ratios, same as above.
+	err = op.setCrop([]string{"200:100", "focus,0.6xw,0.5xh"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(200), op.Position.X)
+	assert.Equal(t, int64(100), op.Position.Y)
+}
+
+//go test -run Test_setCrop_focus_clamped -v
+func Test_setCrop_focus_clamped(t *testing.T) {
+	op := ImageOperation{
+		ImageWidth:  500,
+		ImageHeight: 300,
+	}
+
+	err := op.setCrop([]string{"200:100", "focus,10,10"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), op.Position.X)
+	assert.Equal(t, int64(0), op.Position.Y)
+
+	err = op.setCrop([]string{"200:100", "focus,490,290"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(300), op.Position.X)
+	assert.Equal(t, int64(200), op.Position.Y)
+}
+
+//go test -run Test_setCrop_focus_zoom -v
+func Test_setCrop_focus_zoom(t *testing.T) {
+	op := ImageOperation{
+		ImageWidth:  500,
+		ImageHeight: 300,
+	}
+
+	err := op.setCrop([]string{"200:100", "focus,250,150,2"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), op.NewWidth)
+	assert.Equal(t, int64(50), op.NewHeight)
+	assert.Equal(t, int64(200), op.Position.X)
+	assert.Equal(t, int64(125), op.Position.Y)
+}
+
+//go test -run Test_setCrop_focus_invalid -v
+func Test_setCrop_focus_invalid(t *testing.T) {
+	op := ImageOperation{
+		ImageWidth:  500,
+		ImageHeight: 300,
+	}
+
+	err := op.setCrop([]string{"200:100", "focus,250"})
+	assert.Equal(t, "focus must have two coordinates and an optional zoom", err.Error())
+
+	err = op.setCrop([]string{"200:100", "focus,600,100"})
+	assert.Equal(t, "focus X position is outside image: 600", err.Error())
+
+	err = op.setCrop([]string{"200:100", "focus,100,a"})
+	assert.Equal(t, "focus Y position explicit position must be ratio or number, not 'a'", err.Error())
+
+	err = op.setCrop([]string{"200:100", "focus,100,100,0.5"})
+	assert.Equal(t, "focus zoom must be a number of at least 1, not '0.5'", err.Error())
+
+	err = op.setCrop([]string{"200:100", "focus,100,100,500"})
+	assert.Equal(t, "focus zoom is too large: 500", err.Error())
+}
+
+//go test -run Test_setFill_focus -v
+func Test_setFill_focus(t *testing.T) {
+	op := ImageOperation{
+		ImageWidth:  500,
+		ImageHeight: 300,
+	}
+
+	err := op.setFill([]string{"1:1", "focus,0.8,0.5"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(300), op.NewWidth)
+	assert.Equal(t, int64(300), op.NewHeight)
+	assert.Equal(t, int64(200), op.Position.X)
+	assert.Equal(t, int64(0), op.Position.Y)
+
+	err = op.setFill([]string{"1:1", "focus,0.8,0.5,1.5"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(200), op.NewWidth)
+	assert.Equal(t, int64(200), op.NewHeight)
+	assert.Equal(t, int64(300), op.Position.X)
+	assert.Equal(t, int64(50), op.Position.Y)
+}
+
+//go test -run Test_setBlurFaces -v
+func Test_setBlurFaces(t *testing.T) {
+	op := ImageOperation{}
+
+	err := op.setBlurFaces([]string{"8"})
+	assert.Nil(t, err)
+	assert.Equal(t, 8.0, op.BlurSigma)
+	assert.Equal(t, int64(0), op.BlurMinSize)
+	assert.Equal(t, false, op.BlurPixelate)
+
+	err = op.setBlurFaces([]string{"2.5", "40", "pixelate"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2.5, op.BlurSigma)
+	assert.Equal(t, int64(40), op.BlurMinSize)
+	assert.Equal(t, true, op.BlurPixelate)
+}
+
+//go test -run Test_setBlurFaces_invalid -v
+func Test_setBlurFaces_invalid(t *testing.T) {
+	for _, params := range [][]string{
+		{"0"},
+		{"a"},
+		{"51"},
+		{"8", "-1"},
+		{"8", "a"},
+		{"8", "40", "smudge"},
+		{"8", "40", "blur", "1"},
+	} {
+		op := ImageOperation{}
+		assert.NotNil(t, op.setBlurFaces(params), "%v", params)
+	}
+}
@@ -37,6 +37,10 @@ func (m MockedMutableImage) Density(i *DensityOperation) error {
 	return fmt.Errorf("Density called!")
 }
 
+func (m MockedMutableImage) BlurFaces(i *BlurFacesOperation) error {
+	return fmt.Errorf("BlurFaces called!")
+}
+
 func (m MockedMutableImage) GetImage() *Image {
 	return nil
 }
@@ -272,3 +276,29 @@ func Test_ApplyOperation_Do(t *testing.T) {
 	err := op.Do()
 	assert.Equal(t, "Applying Changes!", err.Error())
 }
+
+//go test -run Test_BlurFacesOperation_String -v
+func Test_BlurFacesOperation_String(t *testing.T) {
+	op := &BlurFacesOperation{Sigma: 8}
+
+	assert.Equal(t, "BlurFaces", fmt.Sprintf("%s", op))
+}
+
+//go test -run Test_BlurFacesOperation_Do -v
+func Test_BlurFacesOperation_Do(t *testing.T) {
+	img := MakeMockMutableImage()
+	op := &BlurFacesOperation{
+		Sigma: 8,
+		Image: &img,
+	}
+
+	err := op.Do()
+	assert.Equal(t, "BlurFaces called!", err.Error())
+}
+
+//go test -run Test_BlurFacesOperation_IsValid -v
+func Test_BlurFacesOperation_IsValid(t *testing.T) {
+	assert.Equal(t, true, (&BlurFacesOperation{Sigma: 8}).IsValid())
+	assert.Equal(t, false, (&BlurFacesOperation{Sigma: 0}).IsValid())
+	assert.Equal(t, false, (&BlurFacesOperation{Sigma: maxBlurSigma + 1}).IsValid())
+}
@@ -1,7 +1,9 @@
 package image
 
 import (
-    "os"
+	"fmt"
+	"math"
+	"strings"
 )
 
 const (
@@ -10,8 +12,7 @@ const (
 	GIF  = "image/gif"  // gif mime
 	TIFF = "image/tiff" // tiff mime
 
-	HaarCascadesPath = "/data/haarcascades/"
-	HaarCascadeFrontalFaceAlt = HaarCascadesPath + "haarcascade_frontalface_alt.xml"
+	HaarCascadeFrontalFaceAlt = "haarcascade_frontalface_alt.xml" // frontal face cascade used by auto crop
 )
 
 var (
@@ -36,22 +37,40 @@ var (
 	allowedOperations = []string{
 		"resize",
 		"crop",
+		"fill",
 		"output-quality",
 		"density",
 		"frame",
+		"blur-faces",
+		"debug",
 	}
 	// maxOperations represents the maximum operations allowed per request
 	maxOperations int = 5
 
+	// autoCropFrames is the maximum number of gif frames analyzed for auto cropping.
+	autoCropFrames int = 5
+
+	// analyzeAlternatives is the default number of alternative crops returned by analyze, up to maxAnalyzeAlternatives.
+	analyzeAlternatives    int = 5
+	maxAnalyzeAlternatives int = 20
+
+	// maxBlurSigma is the strongest blur-faces allows.
+	maxBlurSigma float64 = 50
+	// blurFacesPrescaleMin is the size of the shorter side of images when looking for faces to blur.
+	// It's larger than for auto crops, small faces in the background need blurring too.
+	blurFacesPrescaleMin float64 = 800
+	// blurFacesMargin grows detected faces by this ratio of their width on every side before blurring.
+	blurFacesMargin float64 = 0.1
+
 	// interlace represents the Interlace option of libvips.
 	interlace bool = true
 
-	// maximum dimensions we want to set our width and height to
+	// maximum dimensions we want to set our width and height to, unless a site's Policy sets its own.
 	maxWidth  int64 = 3000
 	maxHeight int64 = 3000
 
-	goPath string = os.Getenv("GOPATH")
-	appPath string = goPath + "/src/github.com/bvchevez/imageprocess"
+	// HaarCascadesPath is the directory holding the haar cascades used for face detection.
+	HaarCascadesPath string = "data/haarcascades/"
 )
 
 // Options represents different image options available.
@@ -59,4 +78,99 @@ type Options struct {
 	Quality          int64
 	Density          int64
 	BicubicThreshold int64
+	Colors           int64  // Colors is the default color count for gifs, over the one derived from Quality. 0 derives it.
+	Lossy            int64  // Lossy is the default gifsicle lossy level for gifs, 0 disables it.
+	CropProfile      string // CropProfile is the smartcrop profile auto crops are analyzed with.
+	Format           string // Format is the mime fixed images are saved as, JPEG or PNG. Empty keeps theirs.
+}
+
+// Policy bounds the operations requests may ask for, per site. The zero Policy allows every operation,
+// positions crops without a position at center,top, ignores resizes larger than the image, and fits
+// outputs within maxWidth by maxHeight.
+type Policy struct {
+	Operations []string // Operations are the operations requests may ask for, empty allows all of them.
+	Gravity    string   // Gravity is the position of crops and fills without one, like "center,top" or "auto,auto".
+	MaxWidth   int64    // MaxWidth and MaxHeight bound outputs, larger ones are scaled down to fit.
+	MaxHeight  int64    // 0 uses maxWidth or maxHeight.
+	Upscale    bool     // Upscale lets resizes enlarge images.
+}
+
+// IsOperation tells whether name is an operation HIPS supports.
+func IsOperation(name string) bool {
+	for _, op := range allowedOperations {
+		if op == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allows tells whether p lets requests ask for the operation action.
+func (p Policy) allows(action string) bool {
+	if len(p.Operations) == 0 || action == "token" {
+		return true
+	}
+
+	for _, op := range p.Operations {
+		if op == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckGravity returns an error if gravity isn't a position the crop parameter accepts, like "center,top",
+// "auto,auto", "0.5xw,10" or "focus,0.3,0.6".
+func CheckGravity(gravity string) error {
+	coords := strings.Split(gravity, ",")
+	if len(coords) != 2 && coords[0] != "focus" {
+		return fmt.Errorf("gravity must have two coordinates, like center,top, not [%s]", gravity)
+	}
+
+	// positions are checked against an image large enough for any of them.
+	i := &ImageOperation{ImageWidth: math.MaxInt32, ImageHeight: math.MaxInt32, NewWidth: math.MaxInt32, NewHeight: math.MaxInt32}
+	if coords[0] == "focus" {
+		return i.setFocus(coords[1:])
+	}
+
+	return i.setCropPosition(coords[0], coords[1])
+}
+
+// gravity returns the crop position of p, as the coordinates of a crop parameter.
+func (p Policy) gravity() []string {
+	if p.Gravity == "" {
+		return []string{"center", "top"}
+	}
+
+	return strings.Split(p.Gravity, ",")
+}
+
+// maxDimensions returns the largest output p allows.
+func (p Policy) maxDimensions() (int64, int64) {
+	width, height := p.MaxWidth, p.MaxHeight
+	if width <= 0 {
+		width = maxWidth
+	}
+	if height <= 0 {
+		height = maxHeight
+	}
+
+	return width, height
+}
+
+// fit returns the resize that scales width by height down to fit within the largest output of p, if they don't.
+func (p Policy) fit(width, height int64, img *MutableImage) (*ResizeOperation, bool) {
+	maxW, maxH := p.maxDimensions()
+	if width <= maxW && height <= maxH {
+		return nil, false
+	}
+
+	scale := math.Min(float64(maxW)/float64(width), float64(maxH)/float64(height))
+	return &ResizeOperation{
+		NewWidth:  int64(float64(width) * scale),
+		NewHeight: int64(float64(height) * scale),
+		Image:     img,
+	}, true
 }
@@ -0,0 +1,61 @@
+// placeholder.go makes the placeholders sites serve instead of their missing images.
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+// placeholderQuality is the jpeg quality of placeholders, before the requested operations are applied.
+const placeholderQuality = 90
+
+// ParseHexColor parses a color written like #e5e5e5.
+func ParseHexColor(s string) (color.RGBA, error) {
+	c := color.RGBA{A: 255}
+	if _, err := fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B); err != nil || len(s) != 7 {
+		return c, fmt.Errorf("Invalid color [%s], it must look like #e5e5e5.", s)
+	}
+
+	return c, nil
+}
+
+// SolidPlaceholder returns a jpeg of width by height pixels of c.
+func SolidPlaceholder(width, height int, c color.Color) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.ZP, draw.Src)
+
+	b := new(bytes.Buffer)
+	if err := jpeg.Encode(b, img, &jpeg.Options{Quality: placeholderQuality}); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// BlurredPlaceholder returns the image in data blurred, as a jpeg. It's shrunk factor times and scaled back up,
+// which blurs about as much as a gaussian of sigma factor, for a fraction of its cost.
+func BlurredPlaceholder(data []byte, factor float64) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode the placeholder: %s", err)
+	}
+
+	b := src.Bounds()
+	width := uint(math.Max(1, float64(b.Dx())/math.Max(1, factor)))
+	small := resize.Resize(width, 0, src, resize.Bilinear)
+	blurred := resize.Resize(uint(b.Dx()), uint(b.Dy()), small, resize.Bicubic)
+
+	out := new(bytes.Buffer)
+	if err := jpeg.Encode(out, blurred, &jpeg.Options{Quality: placeholderQuality}); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
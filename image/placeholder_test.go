@@ -0,0 +1,54 @@
+package image
+
+import (
+	"bytes"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go test ./image -run Test_ParseHexColor -v
+func Test_ParseHexColor(t *testing.T) {
+	c, err := ParseHexColor("#e5a010")
+	assert.Nil(t, err)
+	assert.Equal(t, color.RGBA{R: 0xe5, G: 0xa0, B: 0x10, A: 255}, c)
+
+	for _, s := range []string{"", "e5e5e5", "#e5e5", "#e5e5e5e5", "#zzzzzz"} {
+		_, err := ParseHexColor(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+//go test ./image -run Test_SolidPlaceholder -v
+func Test_SolidPlaceholder(t *testing.T) {
+	data, err := SolidPlaceholder(160, 90, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+	assert.Nil(t, err)
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, 160, img.Bounds().Dx())
+	assert.Equal(t, 90, img.Bounds().Dy())
+
+	r, g, b, _ := img.At(80, 45).RGBA()
+	assert.InDelta(t, 200, r>>8, 4)
+	assert.InDelta(t, 100, g>>8, 4)
+	assert.InDelta(t, 50, b>>8, 4)
+}
+
+//go test ./image -run Test_BlurredPlaceholder -v
+func Test_BlurredPlaceholder(t *testing.T) {
+	source, _ := SolidPlaceholder(160, 90, color.White)
+
+	data, err := BlurredPlaceholder(source, 16)
+	assert.Nil(t, err)
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, 160, img.Bounds().Dx())
+	assert.Equal(t, 90, img.Bounds().Dy())
+
+	_, err = BlurredPlaceholder([]byte("not an image"), 16)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,133 @@
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestProfiles(t testing.TB, data string) string {
+	f, err := ioutil.TempFile("", "crop_profiles")
+	if err != nil {
+		t.Fatalf("Error not expected at temp file %s", err.Error())
+	}
+	defer f.Close()
+
+	f.WriteString(data)
+	return f.Name()
+}
+
+//go test ./image -run Test_LoadCropProfiles -v
+func Test_LoadCropProfiles(t *testing.T) {
+	defer LoadCropProfiles(writeTestProfiles(t, "{}"))
+
+	err := LoadCropProfiles("../config/crop_profiles.json")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "vehicles", CropProfileForSite("caranddriver"))
+	assert.Equal(t, DefaultCropProfile, CropProfileForSite("hmg-dev"))
+
+	settings := cropSettings("vehicles")
+	assert.Equal(t, false, settings.FaceDetection)
+	assert.Equal(t, 0.0, settings.SkinWeight)
+	assert.Equal(t, false, settings.RuleOfThirds)
+	// left out settings keep their defaults.
+	assert.Equal(t, 8, settings.Step)
+	assert.Equal(t, HaarCascadesPath+HaarCascadeFrontalFaceAlt, settings.FaceDetectionHaarCascadeFilepath)
+
+	settings = cropSettings("people")
+	assert.Equal(t, true, settings.FaceDetection)
+	assert.Equal(t, []string{
+		HaarCascadesPath + "haarcascade_profileface.xml",
+		HaarCascadesPath + "haarcascade_upperbody.xml",
+	}, settings.ExtraHaarCascadeFilepaths)
+
+	// no default profile defined, smartcrop defaults without face detection.
+	settings = cropSettings(DefaultCropProfile)
+	assert.Equal(t, false, settings.FaceDetection)
+	assert.Equal(t, 1.8, settings.SkinWeight)
+	assert.Len(t, settings.ExtraHaarCascadeFilepaths, 0)
+}
+
+//go test ./image -run Test_LoadCropProfiles_Invalid -v
+func Test_LoadCropProfiles_Invalid(t *testing.T) {
+	for _, data := range []string{
+		`{"profiles": {"a": {"skin_weight": "heavy"}}}`,
+		`{"profiles": {"a": {"cascades": ["missing.xml"]}}}`,
+		`{"profiles": {"a": {"step": 0}}}`,
+		`{"profiles": {"a": {"scale_step": 0}}}`,
+		`{"profiles": {"a": {"score_down_sample": 0}}}`,
+		`{"profiles": {"a": {"min_scale": 1.2, "max_scale": 1.0}}}`,
+		`{"profiles": {"a": {}}, "sites": {"elle": "b"}}`,
+		`not json`,
+	} {
+		path := writeTestProfiles(t, data)
+		assert.NotNil(t, LoadCropProfiles(path), data)
+		os.Remove(path)
+	}
+
+	assert.NotNil(t, LoadCropProfiles("missing.json"))
+}
+
+//go test ./image -run Test_Crop_AutoPosition_Profile -v
+func Test_Crop_AutoPosition_Profile(t *testing.T) {
+	path := writeTestProfiles(t, `{"profiles": {"nofaces": {"face_detection": false}}, "sites": {"hmg-dev": "nofaces"}}`)
+	defer os.Remove(path)
+	defer LoadCropProfiles(writeTestProfiles(t, "{}"))
+	assert.Nil(t, LoadCropProfiles(path))
+
+	img := getMockImageGIF()
+	img.SetDefaults(Options{CropProfile: CropProfileForSite("hmg-dev")})
+
+	op := &CropOperation{NewWidth: 200, NewHeight: 100, Image: &img}
+	crop, err := op.FindBestCrop()
+	assert.Nil(t, err)
+	assert.Len(t, crop.Faces, 0)
+}
+
+//go test ./image -run Test_Crop_AutoPosition_NoFaceDetection -v
+func Test_Crop_AutoPosition_NoFaceDetection(t *testing.T) {
+	// without cascades face detection fails, auto crops of sites that don't opt in never run it.
+	path := HaarCascadesPath
+	HaarCascadesPath = "missing/"
+	defer func() { HaarCascadesPath = path }()
+
+	img := getMockImageJPEG()
+	img.SetDefaults(Options{CropProfile: CropProfileForSite("hmg-dev")})
+
+	op := &CropOperation{NewWidth: 200, NewHeight: 100, Image: &img}
+	crop, err := op.FindBestCrop()
+	assert.Nil(t, err)
+	assert.Len(t, crop.Faces, 0)
+}
+
+//go test ./image -run NONE -bench BenchmarkCrop_FindBestCrop -benchmem
+func BenchmarkCrop_FindBestCrop(b *testing.B) {
+	img := getMockImageJPEG()
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		op := &CropOperation{NewWidth: 200, NewHeight: 100, Image: &img}
+		op.FindBestCrop()
+	}
+}
+
+func BenchmarkCrop_FindBestCrop_Faces(b *testing.B) {
+	path := writeTestProfiles(b, `{"profiles": {"faces": {"face_detection": true}}}`)
+	defer os.Remove(path)
+	defer LoadCropProfiles(writeTestProfiles(b, "{}"))
+	if err := LoadCropProfiles(path); err != nil {
+		b.Fatalf("Error not expected at load %s", err.Error())
+	}
+
+	img := getMockImageJPEG()
+	img.SetDefaults(Options{CropProfile: "faces"})
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		op := &CropOperation{NewWidth: 200, NewHeight: 100, Image: &img}
+		op.FindBestCrop()
+	}
+}
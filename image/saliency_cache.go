@@ -0,0 +1,100 @@
+// saliency_cache.go keeps the smartcrop saliency of recently auto cropped images,
+// so auto crops of other sizes of the same image skip the analysis.
+package image
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"image"
+
+	"github.com/bvchevez/imageprocess/smartcrop"
+	"github.com/hashicorp/golang-lru"
+)
+
+// saliencyCache maps saliencyKey to *smartcrop.Saliency. It's nil when disabled.
+var saliencyCache *lru.Cache
+
+// InitSaliencyCache keeps the saliency of up to size images. 0 disables the cache.
+func InitSaliencyCache(size int) error {
+	if size <= 0 {
+		saliencyCache = nil
+		return nil
+	}
+
+	cache, err := lru.New(size)
+	if err != nil {
+		return err
+	}
+
+	saliencyCache = cache
+	return nil
+}
+
+// saliencyKey identifies the saliency of the source analyzed with profile.
+// The source is identified by sourceID when it's set, by its data otherwise.
+// Gifs are analyzed across their frames, so they're told apart from the same source analyzed as a still.
+func saliencyKey(sourceID string, source []byte, profile string, frames bool) string {
+	if sourceID == "" {
+		sum := sha1.Sum(source)
+		sourceID = hex.EncodeToString(sum[:])
+	}
+	return fmt.Sprintf("%s:%s:%t", sourceID, profile, frames)
+}
+
+// findSaliency returns the saliency of the mutable image's source, from the cache when it's there.
+// The source is analyzed, not the current data, so earlier operations like resize don't miss the cache.
+// Images already cropped no longer show the whole source, their current data is analyzed and not cached.
+func findSaliency(analyzer smartcrop.Analyzer, mutable MutableImage) (*smartcrop.Saliency, error) {
+	var source []byte
+	switch img := mutable.(type) {
+	case *ImageGIF:
+		// gif operations are deferred to ApplyChanges, its frames are always the source.
+		source = img.ImageData.Data
+	case *ImageFixed:
+		if !img.cropped {
+			source = img.source
+		}
+	}
+
+	if source == nil {
+		return analyzeData(analyzer, mutable.GetImage().Data)
+	}
+
+	gifImg, isGIF := mutable.(*ImageGIF)
+	key := saliencyKey(mutable.GetImage().SourceID, source, mutable.GetImage().CropProfile, isGIF)
+
+	if saliencyCache != nil {
+		if s, ok := saliencyCache.Get(key); ok {
+			return s.(*smartcrop.Saliency), nil
+		}
+	}
+
+	var s *smartcrop.Saliency
+	var err error
+	if isGIF {
+		s, err = analyzer.Saliency(gifImg.Frames(autoCropFrames)...)
+	} else {
+		s, err = analyzeData(analyzer, source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if saliencyCache != nil {
+		saliencyCache.Add(key, s)
+	}
+
+	return s, nil
+}
+
+// analyzeData decodes data and returns its saliency.
+func analyzeData(analyzer smartcrop.Analyzer, data []byte) (*smartcrop.Saliency, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return analyzer.Saliency(img)
+}
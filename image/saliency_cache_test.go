@@ -0,0 +1,105 @@
+package image
+
+import (
+	"image"
+	"testing"
+
+	"github.com/bvchevez/imageprocess/point"
+	"github.com/bvchevez/imageprocess/smartcrop"
+	"github.com/stretchr/testify/assert"
+)
+
+//go test ./image -run Test_SaliencyCache_Sizes -v
+func Test_SaliencyCache_Sizes(t *testing.T) {
+	assert.Nil(t, InitSaliencyCache(4))
+	defer InitSaliencyCache(0)
+
+	img := getMockImageJPEG()
+	img.SetDimensions()
+	analyzer := smartcrop.NewAnalyzerWithCropSettings(cropSettings(""))
+
+	s, err := findSaliency(analyzer, img)
+	assert.Nil(t, err)
+
+	// crops of other sizes of the same image reuse its saliency.
+	for _, size := range [][2]int64{{200, 100}, {100, 100}, {160, 90}} {
+		op := &CropOperation{NewWidth: size[0], NewHeight: size[1], Position: &point.Point{X: -1, Y: -1}, Image: &img}
+		crop, err := op.FindBestCrop()
+		assert.Nil(t, err)
+		assert.True(t, crop.Width > 0 && crop.Height > 0)
+
+		cached, err := findSaliency(analyzer, img)
+		assert.Nil(t, err)
+		assert.True(t, s == cached)
+	}
+	assert.Equal(t, 1, saliencyCache.Len())
+
+	// the same data analyzed with another profile is analyzed again.
+	img.GetImage().CropProfile = "people"
+	other, err := findSaliency(analyzer, img)
+	assert.Nil(t, err)
+	assert.False(t, s == other)
+	assert.Equal(t, 2, saliencyCache.Len())
+}
+
+//go test ./image -run Test_SaliencyCache_Resized -v
+func Test_SaliencyCache_Resized(t *testing.T) {
+	assert.Nil(t, InitSaliencyCache(4))
+	defer InitSaliencyCache(0)
+
+	img := getMockImageJPEG()
+	analyzer := smartcrop.NewAnalyzerWithCropSettings(cropSettings(""))
+
+	s, err := findSaliency(analyzer, img)
+	assert.Nil(t, err)
+
+	// responsive sizes resize the source before the auto crop, they reuse its saliency.
+	for _, width := range []int64{600, 300} {
+		resized := getMockImageJPEG()
+		height := width * resized.GetImage().Height / resized.GetImage().Width
+		assert.Nil(t, resized.Resize(&ResizeOperation{NewWidth: width, NewHeight: height, Image: &resized}))
+
+		cached, err := findSaliency(analyzer, resized)
+		assert.Nil(t, err)
+		assert.True(t, s == cached)
+
+		op := &CropOperation{NewWidth: width / 2, NewHeight: height / 2, Position: &point.Point{X: -1, Y: -1}, Image: &resized}
+		crop, err := op.FindBestCrop()
+		assert.Nil(t, err)
+		assert.True(t, crop.X >= 0 && crop.Y >= 0)
+		assert.True(t, int64(crop.X+crop.Width) <= width && int64(crop.Y+crop.Height) <= height)
+		assert.InDelta(t, width/2, crop.Width, 2)
+		assert.InDelta(t, height/2, crop.Height, 2)
+
+		// once cropped, the image no longer shows the whole source, it's analyzed as is.
+		assert.Nil(t, op.Do())
+		cropped, err := findSaliency(analyzer, resized)
+		assert.Nil(t, err)
+		assert.False(t, s == cropped)
+		assert.Equal(t, image.Point{X: int(width / 2), Y: int(height / 2)}, cropped.Size())
+	}
+	assert.Equal(t, 1, saliencyCache.Len())
+
+	// the source id tells the source apart, instead of its data.
+	img.GetImage().SourceID = "site:/test.jpg@etag"
+	other, err := findSaliency(analyzer, img)
+	assert.Nil(t, err)
+	assert.False(t, s == other)
+	assert.Equal(t, 2, saliencyCache.Len())
+	_, ok := saliencyCache.Get(saliencyKey("site:/test.jpg@etag", nil, "", false))
+	assert.True(t, ok)
+}
+
+//go test ./image -run Test_SaliencyCache_Disabled -v
+func Test_SaliencyCache_Disabled(t *testing.T) {
+	assert.Nil(t, InitSaliencyCache(0))
+
+	img := getMockImageJPEG()
+	analyzer := smartcrop.NewAnalyzerWithCropSettings(cropSettings(""))
+
+	first, err := findSaliency(analyzer, img)
+	assert.Nil(t, err)
+	second, err := findSaliency(analyzer, img)
+	assert.Nil(t, err)
+	assert.False(t, first == second)
+}
@@ -27,8 +27,13 @@ func main() {
 	}
 
 	InitLogLevel()
+	InitFaceDetection()
+	InitOrigins()
+	InitFallbacks()
+	InitCaches()
 	InitMontoring()
 	InitRoutes()
+	WatchSites()
 	StartServer()
 
 	// Listen for and terminate HIPS on SIGKILL or SIGINT signals.
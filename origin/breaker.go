@@ -0,0 +1,195 @@
+package origin
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of the circuit breaker of an origin.
+type BreakerState int
+
+const (
+	Closed   BreakerState = iota // Closed lets fetches through, counting their failures.
+	Open                         // Open fails fetches fast, until Options.BreakerCooldown is over.
+	HalfOpen                     // HalfOpen lets a single fetch through, to probe whether the origin is back.
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = map[string]*Breaker{}
+)
+
+// Breaker is the circuit breaker of an origin. Once Options.BreakerFailures fetches in a row fail because the
+// origin is unavailable or timing out, it opens, and fetches fail fast instead of piling up on the origin.
+// After Options.BreakerCooldown a single fetch probes the origin: the breaker closes if it succeeds, or opens again.
+type Breaker struct {
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// BreakerStats is the state of a breaker, as reported by the health check.
+type BreakerStats struct {
+	State      string `json:"state"`
+	Failures   int    `json:"failures"`
+	RetryAfter int64  `json:"retry_after,omitempty"` // RetryAfter is the seconds left before an open breaker probes.
+}
+
+// BreakerFor returns the breaker of name, usually a site, shared by all the origins it guards.
+func BreakerFor(name string) *Breaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	b, ok := breakers[name]
+	if !ok {
+		b = &Breaker{}
+		breakers[name] = b
+	}
+
+	return b
+}
+
+// Breakers returns the stats of the breakers of the origins fetched from so far, by name.
+func Breakers() map[string]BreakerStats {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	stats := make(map[string]BreakerStats, len(breakers))
+	for name, b := range breakers {
+		stats[name] = b.Stats()
+	}
+
+	return stats
+}
+
+// Guard returns o, with its fetches guarded by b.
+func (b *Breaker) Guard(o Origin) Origin {
+	return &guarded{Origin: o, breaker: b}
+}
+
+// Stats returns the state of b.
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := BreakerStats{State: b.state.String(), Failures: b.failures}
+	if b.state == Open {
+		s.RetryAfter = int64(b.retryAfter().Seconds() + 0.5)
+	}
+
+	return s
+}
+
+// allow tells whether a fetch can go through b, or how long until it can.
+func (b *Breaker) allow() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if options.BreakerFailures <= 0 {
+		return 0, true
+	}
+
+	switch b.state {
+	case Open:
+		if wait := b.retryAfter(); wait > 0 {
+			return wait, false
+		}
+		b.state = HalfOpen
+	case HalfOpen:
+		if b.probing {
+			return time.Second, false
+		}
+	}
+
+	b.probing = b.state == HalfOpen
+	return 0, true
+}
+
+// record counts a fetch allowed through b, which failed with err.
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if options.BreakerFailures <= 0 {
+		return
+	}
+
+	failed := isOutage(err)
+	switch {
+	case b.state == HalfOpen && b.probing:
+		b.probing = false
+		if failed {
+			b.open()
+		} else {
+			b.state, b.failures = Closed, 0
+		}
+	case b.state != Closed:
+		// fetches let through before b opened don't count.
+	case !failed:
+		b.failures = 0
+	default:
+		b.failures++
+		if b.failures >= options.BreakerFailures {
+			b.open()
+		}
+	}
+}
+
+func (b *Breaker) open() {
+	b.state = Open
+	b.openedAt = time.Now()
+}
+
+// retryAfter is how long until the open breaker b lets a probe through.
+func (b *Breaker) retryAfter() time.Duration {
+	return b.openedAt.Add(options.BreakerCooldown).Sub(time.Now())
+}
+
+// isOutage tells whether a fetch failing with err means the origin is in trouble: it timed out, couldn't be
+// reached or answered with a 5xx. Missing sources, too large ones, and any 4xx don't count: S3 answers
+// missing keys with 403 in buckets it can't list, those are as much a bad request as a 404.
+func isOutage(err error) bool {
+	e, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+
+	switch e.Kind {
+	case Timeout:
+		return true
+	case Unavailable:
+		return e.Status == 0 || e.Status >= 500
+	}
+
+	return false
+}
+
+// guarded is an origin guarded by a breaker.
+type guarded struct {
+	Origin
+	breaker *Breaker
+}
+
+func (g *guarded) Fetch(ctx context.Context, path, etag string) ([]byte, Metadata, error) {
+	if wait, ok := g.breaker.allow(); !ok {
+		return nil, Metadata{}, circuitOpenError(g.URL(path), wait)
+	}
+
+	data, meta, err := g.Origin.Fetch(ctx, path, etag)
+	g.breaker.record(err)
+
+	return data, meta, err
+}
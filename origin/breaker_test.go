@@ -0,0 +1,125 @@
+package origin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubOrigin fails its fetches with err, counting them.
+type stubOrigin struct {
+	err     error
+	fetches int
+}
+
+func (o *stubOrigin) Fetch(ctx context.Context, path, etag string) ([]byte, Metadata, error) {
+	o.fetches++
+	if o.err != nil {
+		return nil, Metadata{}, o.err
+	}
+	return []byte("image"), Metadata{}, nil
+}
+
+func (o *stubOrigin) URL(path string) string {
+	return "stub" + path
+}
+
+//go test ./origin -run Test_Breaker_opens -v
+func Test_Breaker_opens(t *testing.T) {
+	defer configureTest(Options{BreakerFailures: 3, BreakerCooldown: 50 * time.Millisecond})()
+
+	stub := &stubOrigin{err: &Error{Kind: Timeout, Err: errors.New("timeout")}}
+	o := BreakerFor("site").Guard(stub)
+
+	for i := 0; i < 3; i++ {
+		_, _, err := o.Fetch(context.Background(), "/a.jpg", "")
+		assert.Equal(t, Timeout, err.(*Error).Kind)
+	}
+	assert.Equal(t, "open", Breakers()["site"].State)
+
+	// open breakers fail fast, without asking the origin.
+	_, _, err := o.Fetch(context.Background(), "/a.jpg", "")
+	assert.Equal(t, CircuitOpen, err.(*Error).Kind)
+	assert.True(t, err.(*Error).RetryAfter > 0)
+	assert.Equal(t, 3, stub.fetches)
+
+	// 5xx are outages too.
+	assert.True(t, isOutage(statusError(503)))
+	assert.True(t, isOutage(&Error{Kind: Unavailable, Err: errors.New("connection refused")}))
+
+	// after the cooldown, a failed probe opens the breaker again.
+	time.Sleep(60 * time.Millisecond)
+	_, _, err = o.Fetch(context.Background(), "/a.jpg", "")
+	assert.Equal(t, Timeout, err.(*Error).Kind)
+	assert.Equal(t, "open", Breakers()["site"].State)
+
+	// and a successful one closes it.
+	time.Sleep(60 * time.Millisecond)
+	stub.err = nil
+	_, _, err = o.Fetch(context.Background(), "/a.jpg", "")
+	assert.Nil(t, err)
+	assert.Equal(t, BreakerStats{State: "closed"}, Breakers()["site"])
+}
+
+//go test ./origin -run Test_Breaker_halfOpen -v
+func Test_Breaker_halfOpen(t *testing.T) {
+	defer configureTest(Options{BreakerFailures: 1, BreakerCooldown: time.Millisecond})()
+
+	b := BreakerFor("site")
+	b.record(&Error{Kind: Unavailable, Err: errors.New("down")})
+	time.Sleep(2 * time.Millisecond)
+
+	// a single probe goes through at a time.
+	_, ok := b.allow()
+	assert.True(t, ok)
+	assert.Equal(t, "half-open", b.Stats().State)
+
+	wait, ok := b.allow()
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+}
+
+//go test ./origin -run Test_Breaker_ignores -v
+func Test_Breaker_ignores(t *testing.T) {
+	defer configureTest(Options{BreakerFailures: 2, BreakerCooldown: time.Minute})()
+
+	// missing and too large sources, or not modified ones, don't mean the origin is failing.
+	for _, err := range []error{
+		&Error{Kind: NotFound, Err: errors.New("missing")},
+		&Error{Kind: TooLarge, Err: errors.New("large")},
+		ErrNotModified,
+	} {
+		o := BreakerFor("site").Guard(&stubOrigin{err: err})
+		for i := 0; i < 3; i++ {
+			o.Fetch(context.Background(), "/a.jpg", "")
+		}
+	}
+	assert.Equal(t, "closed", Breakers()["site"].State)
+
+	// neither do 4xx, like the 403s S3 answers missing keys with.
+	for _, status := range []int{400, 401, 403, 404, 410, 429} {
+		o := BreakerFor("site").Guard(&stubOrigin{err: statusError(status)})
+		for i := 0; i < 3; i++ {
+			o.Fetch(context.Background(), "/a.jpg", "")
+		}
+	}
+	assert.Equal(t, BreakerStats{State: "closed"}, Breakers()["site"])
+
+	// successes reset the count of failures in a row.
+	b := BreakerFor("site")
+	b.record(&Error{Kind: Unavailable, Err: errors.New("down")})
+	b.record(nil)
+	b.record(&Error{Kind: Unavailable, Err: errors.New("down")})
+	assert.Equal(t, BreakerStats{State: "closed", Failures: 1}, b.Stats())
+
+	// breakers are disabled by no failures.
+	Configure(Options{})
+	o := BreakerFor("site").Guard(&stubOrigin{err: &Error{Kind: Unavailable, Err: errors.New("down")}})
+	for i := 0; i < 10; i++ {
+		_, _, err := o.Fetch(context.Background(), "/a.jpg", "")
+		assert.Equal(t, Unavailable, err.(*Error).Kind)
+	}
+}
@@ -0,0 +1,96 @@
+package origin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+)
+
+// siteOrigins are the origins of the sites in the origins file, by site.
+var siteOrigins = map[string]Origin{}
+
+// Config is how the origin of a site is set up in the origins file, like:
+//  {
+//    "hmg-prod": {"type": "s3", "bucket": "hmg-prod", "region": "us-east-1"},
+//    "partner": {"type": "http", "url": "https://images.partner.com"},
+//    "local-dev": {"type": "local", "dir": "fixtures"}
+//  }
+// S3 origins without keys use the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+type Config struct {
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	Bucket    string `json:"bucket"`
+	Region    string `json:"region"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	Dir       string `json:"dir"`
+}
+
+// New returns the origin c sets up.
+func New(c Config) (Origin, error) {
+	switch c.Type {
+	case "http":
+		if c.URL == "" {
+			return nil, fmt.Errorf("http origins need a url")
+		}
+		return NewHTTP(c.URL), nil
+
+	case "s3":
+		if c.Bucket == "" {
+			return nil, fmt.Errorf("s3 origins need a bucket")
+		}
+
+		region, ok := aws.Regions[c.Region]
+		if !ok {
+			return nil, fmt.Errorf("unknown s3 region [%s]", c.Region)
+		}
+
+		auth, err := aws.GetAuth(c.AccessKey, c.SecretKey, "", time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		return NewS3(c.Bucket, auth, region), nil
+
+	case "local":
+		if c.Dir == "" {
+			return nil, fmt.Errorf("local origins need a dir")
+		}
+		return NewLocal(c.Dir), nil
+	}
+
+	return nil, fmt.Errorf("unknown origin type [%s]", c.Type)
+}
+
+// Load sets up the origins in the origins file at path, replacing any origins loaded before.
+func Load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var configs map[string]Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return fmt.Errorf("invalid origins [%s]: %s", path, err)
+	}
+
+	origins := map[string]Origin{}
+	for site, c := range configs {
+		o, err := New(c)
+		if err != nil {
+			return fmt.Errorf("site [%s] has an invalid origin: %s", site, err)
+		}
+		origins[site] = o
+	}
+
+	siteOrigins = origins
+	return nil
+}
+
+// ForSite returns the origin of site, if the origins file sets one up.
+func ForSite(site string) (Origin, bool) {
+	o, ok := siteOrigins[site]
+	return o, ok
+}
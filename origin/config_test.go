@@ -0,0 +1,59 @@
+package origin
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestOrigins(t *testing.T, data string) string {
+	f, err := ioutil.TempFile("", "origins")
+	if err != nil {
+		t.Fatalf("Error not expected at temp file %s", err.Error())
+	}
+	defer f.Close()
+
+	f.WriteString(data)
+	return f.Name()
+}
+
+//go test ./origin -run Test_Load -v
+func Test_Load(t *testing.T) {
+	defer Load(writeTestOrigins(t, "{}"))
+
+	err := Load(writeTestOrigins(t, `{
+		"hmg-prod": {"type": "s3", "bucket": "hmg-prod", "region": "us-east-1", "access_key": "AKID", "secret_key": "secret"},
+		"partner": {"type": "http", "url": "https://images.partner.com"},
+		"local-dev": {"type": "local", "dir": "fixtures"}
+	}`))
+	assert.Nil(t, err)
+
+	o, ok := ForSite("hmg-prod")
+	assert.True(t, ok)
+	assert.Equal(t, "s3://hmg-prod/a.jpg", o.URL("/a.jpg"))
+
+	o, ok = ForSite("partner")
+	assert.True(t, ok)
+	assert.Equal(t, "https://images.partner.com/a.jpg", o.URL("/a.jpg"))
+
+	o, ok = ForSite("local-dev")
+	assert.True(t, ok)
+	assert.Equal(t, "file://fixtures/a.jpg", o.URL("/a.jpg"))
+
+	_, ok = ForSite("caranddriver")
+	assert.False(t, ok)
+}
+
+//go test ./origin -run Test_Load_invalid -v
+func Test_Load_invalid(t *testing.T) {
+	for data, msg := range map[string]string{
+		`{"a": {"type": "ftp"}}`:                                   "site [a] has an invalid origin: unknown origin type [ftp]",
+		`{"a": {"type": "http"}}`:                                  "site [a] has an invalid origin: http origins need a url",
+		`{"a": {"type": "s3", "bucket": "b", "region": "mars-1"}}`: "site [a] has an invalid origin: unknown s3 region [mars-1]",
+		`{"a": {"type": "local"}}`:                                 "site [a] has an invalid origin: local origins need a dir",
+	} {
+		err := Load(writeTestOrigins(t, data))
+		assert.Equal(t, msg, err.Error())
+	}
+}
@@ -0,0 +1,85 @@
+package origin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Kind is what went wrong when fetching a source.
+type Kind int
+
+const (
+	Unavailable Kind = iota // Unavailable means the origin failed, or couldn't be reached.
+	NotFound                // NotFound means the origin doesn't have the source.
+	Timeout                 // Timeout means the origin took too long to answer.
+	TooLarge                // TooLarge means the source is larger than Options.MaxBytes.
+	CircuitOpen             // CircuitOpen means the origin's breaker is open, so it wasn't asked.
+)
+
+// Error is the error of a failed fetch.
+type Error struct {
+	Kind   Kind
+	Status int   // Status is the HTTP status the origin answered with, 0 when it didn't answer.
+	Err    error // Err describes the failure.
+
+	// RetryAfter is how long until the origin is asked again, for CircuitOpen errors.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// statusError is the error of an origin answering with status, instead of 200.
+func statusError(status int) *Error {
+	kind := Unavailable
+	if status == http.StatusNotFound || status == http.StatusGone {
+		kind = NotFound
+	}
+
+	return &Error{
+		Kind:   kind,
+		Status: status,
+		Err:    fmt.Errorf("Source returned a status code other than 200: %d", status),
+	}
+}
+
+// requestError is the error of a request failing before the origin answered, like a timeout or a DNS failure.
+// format describes the failure, with a %v for err.
+func requestError(format string, err error) *Error {
+	kind := Unavailable
+	if ne, ok := err.(net.Error); (ok && ne.Timeout()) || err == context.DeadlineExceeded {
+		kind = Timeout
+	}
+
+	return &Error{Kind: kind, Err: fmt.Errorf(format, err)}
+}
+
+// fileError is the error of a local origin failing to read a source file.
+func fileError(format string, err error) *Error {
+	kind := Unavailable
+	if os.IsNotExist(err) {
+		kind = NotFound
+	}
+
+	return &Error{Kind: kind, Err: fmt.Errorf(format, err)}
+}
+
+// tooLargeError is the error of the source at url being larger than max bytes.
+func tooLargeError(url string, max int64) *Error {
+	return &Error{Kind: TooLarge, Err: fmt.Errorf("Source [%s] is larger than the %d bytes limit.", url, max)}
+}
+
+// circuitOpenError is the error of a fetch of the source at url not tried, because its origin's breaker is open
+// for wait more.
+func circuitOpenError(url string, wait time.Duration) *Error {
+	return &Error{
+		Kind:       CircuitOpen,
+		Err:        fmt.Errorf("Origin of [%s] is failing, it's not asked again for %s.", url, wait),
+		RetryAfter: wait,
+	}
+}
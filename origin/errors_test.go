@@ -0,0 +1,55 @@
+package origin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go test ./origin -run Test_Error_Kinds -v
+func Test_Error_Kinds(t *testing.T) {
+	defer configureTest(Options{Retries: 0, ConnectTimeout: DefaultOptions.ConnectTimeout, ReadTimeout: DefaultOptions.ReadTimeout})()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gone.jpg":
+			w.WriteHeader(http.StatusGone)
+		case "/forbidden.jpg":
+			w.WriteHeader(http.StatusForbidden)
+		case "/broken.jpg":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	defer server.Close()
+
+	for _, c := range []struct {
+		url, path string
+		kind      Kind
+		status    int
+	}{
+		{server.URL, "/missing.jpg", NotFound, 404},
+		{server.URL, "/gone.jpg", NotFound, 410},
+		{server.URL, "/forbidden.jpg", Unavailable, 403},
+		{server.URL, "/broken.jpg", Unavailable, 502},
+		{closed.URL, "/a.jpg", Unavailable, 0},
+	} {
+		_, _, err := NewHTTP(c.url).Fetch(context.Background(), c.path, "")
+		assert.Equal(t, c.kind, err.(*Error).Kind, c.path)
+		assert.Equal(t, c.status, err.(*Error).Status, c.path)
+	}
+
+	o, s3 := newTestS3(t)
+	defer s3.Close()
+	_, _, err := o.Fetch(context.Background(), "/missing.jpg", "")
+	assert.Equal(t, &Error{Kind: NotFound, Status: 404, Err: err.(*Error).Err}, err)
+
+	_, _, err = NewLocal(".").Fetch(context.Background(), "/missing.jpg", "")
+	assert.Equal(t, NotFound, err.(*Error).Kind)
+}
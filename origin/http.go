@@ -0,0 +1,81 @@
+package origin
+
+import (
+	"context"
+	"net/http"
+)
+
+// HTTP is an origin serving sources over http(s), under a base url.
+type HTTP struct {
+	BaseURL string
+	Client  *http.Client // Client makes the requests, nil uses a client within the limits of Configure.
+}
+
+// NewHTTP returns an origin downloading sources from baseURL + path.
+func NewHTTP(baseURL string) *HTTP {
+	return &HTTP{BaseURL: baseURL}
+}
+
+// URL is baseURL + path.
+func (o *HTTP) URL(path string) string {
+	return o.BaseURL + path
+}
+
+// Fetch downloads the source at path. 5xx responses are retried.
+func (o *HTTP) Fetch(ctx context.Context, path, etag string) ([]byte, Metadata, error) {
+	return retry(ctx, func() ([]byte, Metadata, error) {
+		return o.fetch(ctx, path, etag)
+	})
+}
+
+func (o *HTTP) fetch(ctx context.Context, path, etag string) ([]byte, Metadata, error) {
+	req, err := http.NewRequest("GET", o.URL(path), nil)
+	if err != nil {
+		return nil, Metadata{}, requestError("Error getting image: %v", err)
+	}
+	req = req.WithContext(ctx)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	// Make request for resource
+	c := o.Client
+	if c == nil {
+		c = client
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, Metadata{}, requestError("Error getting image: %v", err)
+	}
+
+	// Close the response body after this function returns
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified && etag != "" {
+		return nil, Metadata{}, ErrNotModified
+	}
+
+	// Check for 200 status code
+	// S3 does not always send 404s only
+	if res.StatusCode != http.StatusOK {
+		return nil, Metadata{}, statusError(res.StatusCode)
+	}
+
+	// Read in data from response body, up to the size limit
+	data, err := readAll(o.URL(path), res.Body, res.ContentLength)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return data, headerMetadata(res.Header), nil
+}
+
+// headerMetadata is the metadata of a source in the headers of its response.
+func headerMetadata(h http.Header) Metadata {
+	return Metadata{
+		ETag:         h.Get("ETag"),
+		LastModified: h.Get("Last-Modified"),
+		ContentType:  h.Get("Content-Type"),
+	}
+}
@@ -0,0 +1,43 @@
+package origin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go test ./origin -run Test_HTTP_Fetch -v
+func Test_HTTP_Fetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/a.jpg" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("image a"))
+	}))
+	defer server.Close()
+
+	o := NewHTTP(server.URL + "/images")
+	assert.Equal(t, server.URL+"/images/a.jpg", o.URL("/a.jpg"))
+
+	data, meta, err := o.Fetch(context.Background(), "/a.jpg", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "image a", string(data))
+	assert.Equal(t, Metadata{ETag: `"v1"`, LastModified: "Wed, 21 Oct 2015 07:28:00 GMT", ContentType: "image/jpeg"}, meta)
+
+	_, _, err = o.Fetch(context.Background(), "/a.jpg", `"v1"`)
+	assert.Equal(t, ErrNotModified, err)
+
+	_, _, err = o.Fetch(context.Background(), "/b.jpg", "")
+	assert.Equal(t, "Source returned a status code other than 200: 404", err.Error())
+}
@@ -0,0 +1,58 @@
+package origin
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Local is an origin reading sources from a local directory, for development.
+type Local struct {
+	Dir string
+}
+
+// NewLocal returns an origin reading sources from dir.
+func NewLocal(dir string) *Local {
+	return &Local{Dir: dir}
+}
+
+// URL is the file:// url of path.
+func (o *Local) URL(path string) string {
+	return "file://" + o.file(path)
+}
+
+// file is the file of path, which can't be outside of the directory.
+func (o *Local) file(path string) string {
+	return filepath.Join(o.Dir, filepath.Clean("/"+path))
+}
+
+// Fetch reads the file at path. Its ETag is made of its size and modification time.
+func (o *Local) Fetch(ctx context.Context, path, etag string) ([]byte, Metadata, error) {
+	info, err := os.Stat(o.file(path))
+	if err != nil {
+		return nil, Metadata{}, fileError("Error getting image: %v", err)
+	}
+
+	meta := Metadata{
+		ETag:         fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime().UTC().Format(http.TimeFormat),
+		ContentType:  mime.TypeByExtension(filepath.Ext(path)),
+	}
+	if etag != "" && etag == meta.ETag {
+		return nil, Metadata{}, ErrNotModified
+	}
+	if options.MaxBytes > 0 && info.Size() > options.MaxBytes {
+		return nil, Metadata{}, tooLargeError(o.URL(path), options.MaxBytes)
+	}
+
+	data, err := ioutil.ReadFile(o.file(path))
+	if err != nil {
+		return nil, Metadata{}, fileError("Error reading image: %v", err)
+	}
+
+	return data, meta, nil
+}
@@ -0,0 +1,34 @@
+package origin
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go test ./origin -run Test_Local_Fetch -v
+func Test_Local_Fetch(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "hips-origin")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "images"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "images", "a.jpg"), []byte("image a"), 0644)
+
+	o := NewLocal(dir)
+	data, meta, err := o.Fetch(context.Background(), "/images/a.jpg", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "image a", string(data))
+	assert.Equal(t, "image/jpeg", meta.ContentType)
+	assert.NotEqual(t, "", meta.LastModified)
+
+	_, _, err = o.Fetch(context.Background(), "/images/a.jpg", meta.ETag)
+	assert.Equal(t, ErrNotModified, err)
+
+	// paths can't leave the directory.
+	assert.Equal(t, "file://"+filepath.Join(dir, "etc/passwd"), o.URL("/../../etc/passwd"))
+	_, _, err = o.Fetch(context.Background(), "/../../etc/passwd", "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,140 @@
+package origin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxRedirects is how many redirects a fetch follows, at most.
+const maxRedirects = 5
+
+var (
+	options = DefaultOptions
+	client  = newClient(options)
+)
+
+// Options are the limits of fetches from origins, so a slow or huge origin can't hang or exhaust the server.
+type Options struct {
+	ConnectTimeout time.Duration // ConnectTimeout bounds connecting to an origin.
+	ReadTimeout    time.Duration // ReadTimeout bounds reading a response, once connected.
+	MaxBytes       int64         // MaxBytes is the size of the largest source downloaded, 0 means no limit.
+	Retries        int           // Retries is how many times fetches failing with a 5xx are tried again.
+	RetryWait      time.Duration // RetryWait is the wait before the first retry, doubled for each one after, with jitter.
+
+	// BreakerFailures is how many fetches in a row failing with a 5xx, a connection error or a timeout open
+	// its breaker, 0 disables breakers. BreakerCooldown is how long breakers stay open before probing again.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+
+	// AllowRedirect tells whether redirects to u are followed. Redirects within the host asked first always are,
+	// nil follows no other.
+	AllowRedirect func(u *url.URL) bool
+}
+
+// DefaultOptions are the limits of fetches until Configure is called.
+var DefaultOptions = Options{
+	ConnectTimeout: 5 * time.Second,
+	ReadTimeout:    30 * time.Second,
+	MaxBytes:       50 * 1024 * 1024,
+	Retries:        2,
+	RetryWait:      100 * time.Millisecond,
+
+	BreakerFailures: 5,
+	BreakerCooldown: 30 * time.Second,
+}
+
+// Configure sets the limits of the fetches of origins made after it, and closes all breakers.
+// S3 origins of the origins file are given the new timeouts too.
+func Configure(o Options) {
+	options = o
+	client = newClient(o)
+	for _, origin := range siteOrigins {
+		if s, ok := origin.(*S3); ok {
+			s.configure(o)
+		}
+	}
+
+	breakersMu.Lock()
+	breakers = map[string]*Breaker{}
+	breakersMu.Unlock()
+}
+
+// newClient returns an http client enforcing o.
+func newClient(o Options) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			Dial:                  (&net.Dialer{Timeout: o.ConnectTimeout, KeepAlive: 30 * time.Second}).Dial,
+			TLSHandshakeTimeout:   o.ConnectTimeout,
+			ResponseHeaderTimeout: o.ReadTimeout,
+			MaxIdleConnsPerHost:   16,
+		},
+		Timeout: o.ConnectTimeout + o.ReadTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("Stopped after %d redirects.", maxRedirects)
+			}
+			if req.URL.Host == via[0].URL.Host || (o.AllowRedirect != nil && o.AllowRedirect(req.URL)) {
+				return nil
+			}
+
+			return fmt.Errorf("Redirect to [%s] is not allowed.", req.URL.Host)
+		},
+	}
+}
+
+// readAll reads the body of the source at url, up to options.MaxBytes. size is the size the origin announced, or -1.
+func readAll(url string, body io.Reader, size int64) ([]byte, error) {
+	max := options.MaxBytes
+	if max > 0 && size > max {
+		return nil, tooLargeError(url, max)
+	}
+
+	r := body
+	if max > 0 {
+		r = io.LimitReader(body, max+1)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, requestError("Error reading response body: %v", err)
+	}
+	if max > 0 && int64(len(data)) > max {
+		return nil, tooLargeError(url, max)
+	}
+
+	return data, nil
+}
+
+// isRetryable tells whether a fetch failing with err is worth trying again: when the origin answered with a 5xx.
+func isRetryable(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Status >= 500
+}
+
+// retry calls fetch until it doesn't fail with a retryable error, or options.Retries retries are done.
+// Retries wait options.RetryWait, doubled for each retry, with jitter so origins aren't hit in lockstep.
+func retry(ctx context.Context, fetch func() ([]byte, Metadata, error)) ([]byte, Metadata, error) {
+	wait := options.RetryWait
+	for attempt := 0; ; attempt++ {
+		data, meta, err := fetch()
+		if !isRetryable(err) || attempt >= options.Retries {
+			return data, meta, err
+		}
+
+		// wait between half and one and a half times wait.
+		select {
+		case <-time.After(wait/2 + time.Duration(rand.Int63n(int64(wait)+1))):
+		case <-ctx.Done():
+			return nil, Metadata{}, err
+		}
+		wait *= 2
+	}
+}
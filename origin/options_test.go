@@ -0,0 +1,144 @@
+package origin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// configureTest sets o, with short waits, for the rest of a test.
+func configureTest(o Options) func() {
+	o.RetryWait = time.Millisecond
+	Configure(o)
+	return func() { Configure(DefaultOptions) }
+}
+
+//go test ./origin -run Test_Options_Retries -v
+func Test_Options_Retries(t *testing.T) {
+	defer configureTest(Options{Retries: 2, ConnectTimeout: time.Second, ReadTimeout: time.Second})()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch {
+		case r.URL.Path == "/missing.jpg":
+			http.NotFound(w, r)
+		case r.URL.Path == "/flaky.jpg" && n%3 != 0:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/flaky.jpg":
+			w.Write([]byte("image"))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	// 5xx are retried.
+	data, _, err := NewHTTP(server.URL).Fetch(context.Background(), "/flaky.jpg", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "image", string(data))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// up to Retries times.
+	atomic.StoreInt32(&requests, 0)
+	_, _, err = NewHTTP(server.URL).Fetch(context.Background(), "/broken.jpg", "")
+	assert.Equal(t, "Source returned a status code other than 200: 500", err.Error())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// other failures aren't.
+	atomic.StoreInt32(&requests, 0)
+	_, _, err = NewHTTP(server.URL).Fetch(context.Background(), "/missing.jpg", "")
+	assert.Equal(t, "Source returned a status code other than 200: 404", err.Error())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+//go test ./origin -run Test_Options_MaxBytes -v
+func Test_Options_MaxBytes(t *testing.T) {
+	defer configureTest(Options{MaxBytes: 10, ConnectTimeout: time.Second, ReadTimeout: time.Second})()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked.jpg" {
+			// without a Content-Length, the body is cut off at the limit.
+			w.Write([]byte(strings.Repeat("a", 6)))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(strings.Repeat("a", 6)))
+			return
+		}
+		w.Write([]byte(strings.Repeat("a", 11)))
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/large.jpg", "/chunked.jpg"} {
+		_, _, err := NewHTTP(server.URL).Fetch(context.Background(), path, "")
+		assert.Equal(t, TooLarge, err.(*Error).Kind)
+		assert.Equal(t, "Source ["+server.URL+path+"] is larger than the 10 bytes limit.", err.Error())
+	}
+}
+
+//go test ./origin -run Test_Options_Redirects -v
+func Test_Options_Redirects(t *testing.T) {
+	allowed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image"))
+	}))
+	defer allowed.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("other"))
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved.jpg":
+			http.Redirect(w, r, "/a.jpg", http.StatusMovedPermanently)
+		case "/allowed.jpg":
+			http.Redirect(w, r, allowed.URL+"/a.jpg", http.StatusFound)
+		case "/other.jpg":
+			http.Redirect(w, r, other.URL+"/a.jpg", http.StatusFound)
+		default:
+			w.Write([]byte("image"))
+		}
+	}))
+	defer server.Close()
+
+	allowedURL, _ := url.Parse(allowed.URL)
+	defer configureTest(Options{
+		ConnectTimeout: time.Second,
+		ReadTimeout:    time.Second,
+		AllowRedirect:  func(u *url.URL) bool { return u.Host == allowedURL.Host },
+	})()
+
+	// redirects within the host, and to allowed hosts, are followed.
+	for _, path := range []string{"/moved.jpg", "/allowed.jpg"} {
+		data, _, err := NewHTTP(server.URL).Fetch(context.Background(), path, "")
+		assert.Nil(t, err)
+		assert.Equal(t, "image", string(data))
+	}
+
+	_, _, err := NewHTTP(server.URL).Fetch(context.Background(), "/other.jpg", "")
+	assert.Contains(t, err.Error(), "is not allowed.")
+}
+
+//go test ./origin -run Test_Options_ReadTimeout -v
+func Test_Options_ReadTimeout(t *testing.T) {
+	defer configureTest(Options{ConnectTimeout: time.Second, ReadTimeout: 50 * time.Millisecond})()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, _, err := NewHTTP(server.URL).Fetch(context.Background(), "/slow.jpg", "")
+	assert.Contains(t, err.Error(), "Error getting image")
+	assert.Equal(t, Timeout, err.(*Error).Kind)
+	assert.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,26 @@
+// Package origin downloads source images from where sites keep them: web servers, S3 buckets or local directories.
+package origin
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotModified is returned by Fetch when the source still has the ETag it was asked for.
+var ErrNotModified = errors.New("source not modified")
+
+// Origin is where the source images of a site are downloaded from.
+type Origin interface {
+	// Fetch downloads the source at path. When etag isn't empty and the source still has it,
+	// Fetch returns ErrNotModified instead.
+	Fetch(ctx context.Context, path, etag string) ([]byte, Metadata, error)
+	// URL is where the source at path is downloaded from, it identifies the source in caches and logs.
+	URL(path string) string
+}
+
+// Metadata is what an origin tells about a source, along with its data.
+type Metadata struct {
+	ETag         string
+	LastModified string
+	ContentType  string
+}
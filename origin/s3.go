@@ -0,0 +1,78 @@
+package origin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+)
+
+// S3 is an origin downloading sources from an S3 bucket with credentials, so private buckets work too.
+type S3 struct {
+	s3     *s3.S3
+	bucket *s3.Bucket
+}
+
+// NewS3 returns an origin downloading sources from bucket, in region, within the timeouts of the current Options.
+func NewS3(bucket string, auth aws.Auth, region aws.Region) *S3 {
+	o := &S3{s3: s3.New(auth, region)}
+	o.bucket = o.s3.Bucket(bucket)
+	o.configure(options)
+
+	return o
+}
+
+// configure bounds the requests of o with the timeouts of opts. goamz bounds connecting with ConnectTimeout,
+// and the whole request, once connected, with ReadTimeout.
+func (o *S3) configure(opts Options) {
+	o.s3.ConnectTimeout = opts.ConnectTimeout
+	o.s3.ReadTimeout = opts.ReadTimeout
+}
+
+// URL is the s3:// url of path.
+func (o *S3) URL(path string) string {
+	return "s3://" + o.bucket.Name + "/" + strings.TrimLeft(path, "/")
+}
+
+// Fetch downloads the object at path. 5xx responses are retried.
+func (o *S3) Fetch(ctx context.Context, path, etag string) ([]byte, Metadata, error) {
+	return retry(ctx, func() ([]byte, Metadata, error) {
+		return o.fetch(ctx, path, etag)
+	})
+}
+
+// fetch downloads the object at path once. goamz doesn't take a context, so ctx is only checked before asking S3,
+// the timeouts set by configure bound the request itself.
+func (o *S3) fetch(ctx context.Context, path, etag string) ([]byte, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, requestError("Error getting image: %v", err)
+	}
+
+	headers := map[string][]string{}
+	if etag != "" {
+		headers["If-None-Match"] = []string{etag}
+	}
+
+	res, err := o.bucket.GetResponseWithHeaders(strings.TrimLeft(path, "/"), headers)
+	if err != nil {
+		if s3err, ok := err.(*s3.Error); ok {
+			if s3err.StatusCode == http.StatusNotModified && etag != "" {
+				return nil, Metadata{}, ErrNotModified
+			}
+
+			return nil, Metadata{}, statusError(s3err.StatusCode)
+		}
+
+		return nil, Metadata{}, requestError("Error getting image: %v", err)
+	}
+	defer res.Body.Close()
+
+	data, err := readAll(o.URL(path), res.Body, res.ContentLength)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return data, headerMetadata(res.Header), nil
+}
@@ -0,0 +1,110 @@
+package origin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestS3 returns an S3 origin for bucket "images" of a stand-in S3, serving a.jpg to signed requests only.
+func newTestS3(t *testing.T) (*S3, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS AKID:") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+			return
+		}
+		if r.URL.Path != "/images/a.jpg" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Write([]byte("image a"))
+	}))
+
+	auth := aws.Auth{AccessKey: "AKID", SecretKey: "secret"}
+	region := aws.Region{Name: "test", S3Endpoint: server.URL}
+	return NewS3("images", auth, region), server
+}
+
+//go test ./origin -run Test_S3_Fetch -v
+func Test_S3_Fetch(t *testing.T) {
+	o, server := newTestS3(t)
+	defer server.Close()
+
+	assert.Equal(t, "s3://images/a.jpg", o.URL("/a.jpg"))
+
+	data, meta, err := o.Fetch(context.Background(), "/a.jpg", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "image a", string(data))
+	assert.Equal(t, `"v1"`, meta.ETag)
+	assert.Equal(t, "Wed, 21 Oct 2015 07:28:00 GMT", meta.LastModified)
+
+	_, _, err = o.Fetch(context.Background(), "/a.jpg", `"v1"`)
+	assert.Equal(t, ErrNotModified, err)
+
+	_, _, err = o.Fetch(context.Background(), "/b.jpg", "")
+	assert.Equal(t, "Source returned a status code other than 200: 404", err.Error())
+}
+
+//go test ./origin -run Test_S3_Fetch_canceled -v
+func Test_S3_Fetch_canceled(t *testing.T) {
+	o, server := newTestS3(t)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := o.Fetch(ctx, "/a.jpg", "")
+	assert.Equal(t, "Error getting image: context canceled", err.Error())
+}
+
+//go test ./origin -run Test_S3_Fetch_timeout -v
+func Test_S3_Fetch_timeout(t *testing.T) {
+	defer configureTest(Options{ConnectTimeout: time.Second, ReadTimeout: 50 * time.Millisecond})()
+
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+	o := NewS3("images", aws.Auth{AccessKey: "AKID", SecretKey: "secret"}, aws.Region{Name: "test", S3Endpoint: server.URL})
+
+	// a slow bucket fails within the timeouts, and the few attempts goamz makes, instead of hanging the fetch.
+	start := time.Now()
+	_, _, err := o.Fetch(context.Background(), "/a.jpg", "")
+	assert.Equal(t, Timeout, err.(*Error).Kind)
+	assert.True(t, time.Since(start) < 5*time.Second, "fetch took %s", time.Since(start))
+}
+
+//go test ./origin -run Test_S3_Configure -v
+func Test_S3_Configure(t *testing.T) {
+	defer Load(writeTestOrigins(t, "{}"))
+	defer configureTest(Options{ConnectTimeout: time.Second, ReadTimeout: 2 * time.Second})()
+
+	assert.Nil(t, Load(writeTestOrigins(t, `{"hmg-prod": {"type": "s3", "bucket": "hmg-prod", "region": "us-east-1"}}`)))
+	o, _ := ForSite("hmg-prod")
+	assert.Equal(t, time.Second, o.(*S3).s3.ConnectTimeout)
+	assert.Equal(t, 2*time.Second, o.(*S3).s3.ReadTimeout)
+
+	// loaded origins follow the timeouts configured after them.
+	Configure(Options{ConnectTimeout: 3 * time.Second, ReadTimeout: 4 * time.Second})
+	assert.Equal(t, 3*time.Second, o.(*S3).s3.ConnectTimeout)
+	assert.Equal(t, 4*time.Second, o.(*S3).s3.ReadTimeout)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/bvchevez/imageprocess/helper"
 	"github.com/bvchevez/imageprocess/image"
+	"github.com/bvchevez/imageprocess/origin"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/newrelic/go-agent"
@@ -19,13 +20,19 @@ type Pipeline struct {
 	site     string
 	path     string
 	rawQuery string
+	source   *Source
+	fallback bool    // fallback is set when the site's fallback is processed, instead of a missing image.
+	policy   *Policy // policy is how images of the site are processed.
 	imgObj   image.MutableImage
 }
 
 // Process processes our pipeline
 // Takes in the new relic transaction of this particular handler.
 func (p *Pipeline) Process(txn newrelic.Transaction) (*image.Image, *Response) {
-	p.id = helper.GetPipelineID(p.site, p.path, p.rawQuery)
+	if p.policy == nil {
+		p.policy = PolicyForSite(p.site)
+	}
+	p.id = p.policy.PipelineID(p.site, p.path, p.rawQuery)
 	defer helper.Timer(helper.TimerPayload{
 		Start: time.Now(),
 		Name:  "(" + p.id + ") Total Time",
@@ -34,23 +41,23 @@ func (p *Pipeline) Process(txn newrelic.Transaction) (*image.Image, *Response) {
 	log.WithFields(log.Fields{
 		"site":  p.site,
 		"path":  p.path,
-		"query": p.rawQuery,
+		"query": withoutToken(p.rawQuery),
 	}).Info("(" + p.id + ") Processing Request")
 
-	// Download image.
-	// Returns 403 on failure.
-	bytes, err := p.downloadImage(txn)
+	// Download image, or the site's fallback if the image is missing.
+	// Returns the status of the origin's failure, see downloadErrorResponse.
+	source, err := p.downloadImage(txn)
 	if err != nil {
-		return nil, &Response{
-			Code:  http.StatusForbidden,
-			Data:  [1]string{err.Error()},
-			Image: nil,
-		}
+		source, err = p.downloadFallback(err)
+	}
+	if err != nil {
+		return nil, downloadErrorResponse(err)
 	}
 
 	// Initializes image.
 	// Returns 400 on failure.
-	err = p.initImage(bytes, txn)
+	p.source = source
+	err = p.initImage(source.Data, txn)
 	if err != nil {
 		return nil, &Response{
 			Code:  http.StatusBadRequest,
@@ -59,9 +66,15 @@ func (p *Pipeline) Process(txn newrelic.Transaction) (*image.Image, *Response) {
 		}
 	}
 
+	// Analyze requests get the smartcrop analysis as json, instead of the image.
+	// Returns 400 on failure.
+	if image.IsAnalyze(p.rawQuery) {
+		return nil, p.analyze(txn)
+	}
+
 	// Make and validates operations.
 	// Returns 400 on failure.
-	ops, err := image.MakeOperations(p.rawQuery, p.imgObj)
+	ops, err := p.policy.Operations.MakeOperations(p.rawQuery, p.imgObj)
 	if err != nil {
 		return nil, &Response{
 			Code:  http.StatusBadRequest,
@@ -83,21 +96,99 @@ func (p *Pipeline) Process(txn newrelic.Transaction) (*image.Image, *Response) {
 		}
 	}
 
-	return p.imgObj.GetImage(), nil
+	// Debug requests get smartcrop's visualization of the auto crop, instead of the image.
+	// Returns 400 on failure.
+	if image.IsDebug(p.rawQuery) {
+		debug, err := image.DebugImage(ops)
+		if err != nil {
+			return nil, &Response{
+				Code:  http.StatusBadRequest,
+				Data:  [1]string{err.Error()},
+				Image: nil,
+			}
+		}
+		return debug, nil
+	}
+
+	// Validators let clients revalidate the image without downloading it again.
+	img := p.imgObj.GetImage()
+	img.ETag = ImageETag(p.id, p.source, img.Data)
+	img.LastModified = p.source.LastModified
+	img.Fallback = p.fallback
+
+	return img, nil
 }
 
-func (p *Pipeline) downloadImage(txn newrelic.Transaction) ([]byte, error) {
+// downloadFallback returns the source of the site's fallback when the origin doesn't have the image,
+// and failed with err. Otherwise, or if the fallback fails too, it returns err.
+func (p *Pipeline) downloadFallback(err error) (*Source, error) {
+	e, ok := err.(*origin.Error)
+	if !ok || e.Kind != origin.NotFound {
+		return nil, err
+	}
+
+	fallback, ok := FallbackForSite(p.site)
+	if !ok {
+		return nil, err
+	}
+
+	source, fallbackErr := fallback.Source(p.site, p.id)
+	if fallbackErr != nil {
+		log.WithFields(log.Fields{
+			"site":  p.site,
+			"path":  p.path,
+			"error": fallbackErr.Error(),
+		}).Warn("(" + p.id + ") Failed to get the fallback image.")
+
+		return nil, err
+	}
+
+	p.fallback = true
+	return source, nil
+}
+
+// downloadErrorResponse is the response to a failed download: 404 when the origin doesn't have the image,
+// 504 when it timed out, 413 when the image is too large, 503 while the origin's breaker is open,
+// and 502 when the origin failed otherwise. Sites without an origin get a 403.
+func downloadErrorResponse(err error) *Response {
+	res := &Response{
+		Code:  http.StatusForbidden,
+		Data:  [1]string{err.Error()},
+		Image: nil,
+	}
+
+	if e, ok := err.(*origin.Error); ok {
+		res.OriginStatus = e.Status
+		switch e.Kind {
+		case origin.NotFound:
+			res.Code = http.StatusNotFound
+		case origin.Timeout:
+			res.Code = http.StatusGatewayTimeout
+		case origin.TooLarge:
+			res.Code = http.StatusRequestEntityTooLarge
+		case origin.CircuitOpen:
+			res.Code = http.StatusServiceUnavailable
+			res.RetryAfter = e.RetryAfter
+		default:
+			res.Code = http.StatusBadGateway
+		}
+	}
+
+	return res
+}
+
+func (p *Pipeline) downloadImage(txn newrelic.Transaction) (*Source, error) {
 	defer newrelic.Segment{
 		Name:      "Download Image",
 		StartTime: newrelic.StartSegmentNow(txn),
 	}.End()
 
-	bytes, err := GetImage(p.site, p.path, p.id)
+	source, err := GetImage(p.site, p.path, p.id)
 	if err != nil {
 		return nil, err
 	}
 
-	return bytes, nil
+	return source, nil
 }
 
 func (p *Pipeline) initImage(bytes []byte, txn newrelic.Transaction) error {
@@ -112,14 +203,38 @@ func (p *Pipeline) initImage(bytes []byte, txn newrelic.Transaction) error {
 		return err
 	}
 
-	p.imgObj.SetDefaults(image.Options{
-		Quality:          helper.String2Int64(*config.defaultQuality),
-		BicubicThreshold: helper.String2Int64(*config.bicubicThreshold),
-	})
+	// The origin's etag tells the source apart across requests, so its saliency is reused by auto crops of other sizes.
+	if p.source != nil && p.source.ETag != "" {
+		p.imgObj.GetImage().SourceID = p.site + ":" + p.path + "@" + p.source.ETag
+	}
+
+	p.imgObj.SetDefaults(p.policy.Options)
 
 	return nil
 }
 
+func (p *Pipeline) analyze(txn newrelic.Transaction) *Response {
+	defer newrelic.Segment{
+		Name:      "Analyze Image",
+		StartTime: newrelic.StartSegmentNow(txn),
+	}.End()
+
+	analysis, err := image.MakeAnalysis(p.rawQuery, p.imgObj)
+	if err != nil {
+		return &Response{
+			Code:  http.StatusBadRequest,
+			Data:  [1]string{err.Error()},
+			Image: nil,
+		}
+	}
+
+	return &Response{
+		Code:  http.StatusOK,
+		Data:  analysis,
+		Image: nil,
+	}
+}
+
 func (p *Pipeline) doOp(txn newrelic.Transaction, op image.Operations) error {
 	defer newrelic.Segment{
 		Name:      fmt.Sprintf("%s", op),
@@ -0,0 +1,108 @@
+package main
+
+// policy.go resolves how the images of a site are processed and cached.
+import (
+	"fmt"
+
+	cnf "github.com/bvchevez/imageprocess/config"
+	"github.com/bvchevez/imageprocess/helper"
+	"github.com/bvchevez/imageprocess/image"
+)
+
+// formatTypes are the mimes of the formats site policies convert images to.
+var formatTypes = map[string]string{
+	"jpeg": image.JPEG,
+	"png":  image.PNG,
+}
+
+// Policy is how the images of a site are processed and cached: the policy of the site in the sites file,
+// over the global defaults.
+type Policy struct {
+	Options          image.Options // Options are the defaults images are processed with.
+	Operations       image.Policy  // Operations bounds the operations requests may ask for.
+	CacheControl     string
+	SurrogateControl string
+}
+
+// PolicyForSite resolves the policy of site.
+func PolicyForSite(site string) *Policy {
+	p := &Policy{
+		Options: image.Options{
+			Quality:          helper.String2Int64(*config.defaultQuality),
+			BicubicThreshold: helper.String2Int64(*config.bicubicThreshold),
+			Colors:           helper.String2Int64(*config.defaultGifColors),
+			Lossy:            helper.String2Int64(*config.defaultGifLossy),
+			CropProfile:      image.CropProfileForSite(site),
+		},
+		CacheControl:     *config.cacheControl,
+		SurrogateControl: *config.surrogateControl,
+	}
+
+	sitePolicy, ok := cnf.Sites().Policy(site)
+	if !ok {
+		return p
+	}
+
+	if sitePolicy.Quality > 0 {
+		p.Options.Quality = sitePolicy.Quality
+	}
+	if sitePolicy.GifColors > 0 {
+		p.Options.Colors = sitePolicy.GifColors
+	}
+	if sitePolicy.GifLossy > 0 {
+		p.Options.Lossy = sitePolicy.GifLossy
+	}
+	if sitePolicy.CacheControl != "" {
+		p.CacheControl = sitePolicy.CacheControl
+	}
+	if sitePolicy.SurrogateControl != "" {
+		p.SurrogateControl = sitePolicy.SurrogateControl
+	}
+	p.Options.Format = formatTypes[sitePolicy.Format]
+	p.Operations = image.Policy{
+		Operations: sitePolicy.Operations,
+		Gravity:    sitePolicy.Gravity,
+		MaxWidth:   sitePolicy.MaxWidth,
+		MaxHeight:  sitePolicy.MaxHeight,
+		Upscale:    sitePolicy.Upscale,
+	}
+
+	return p
+}
+
+// PipelineID returns the id of the pipeline of an image request of site processed with p. Images are cached
+// and their ETags derived by pipeline id, so it changes along with what p processes images with: once the sites
+// file changes a policy, images processed with the old one are neither served nor revalidated.
+// The debug token of params doesn't change the image, it's left out.
+func (p *Policy) PipelineID(site, path, params string) string {
+	return helper.GetPipelineID(site, path, fmt.Sprintf("%s %+v %+v", withoutToken(params), p.Options, p.Operations))
+}
+
+// checkPolicies returns an error if a policy of sites allows an operation that doesn't exist,
+// or has a gravity crops don't accept.
+func checkPolicies(sites *cnf.Registry) error {
+	for site, p := range sites.Policies() {
+		for _, op := range p.Operations {
+			if !image.IsOperation(op) {
+				return fmt.Errorf("site [%s] allows an unknown operation [%s]", site, op)
+			}
+		}
+
+		if p.Gravity != "" {
+			if err := image.CheckGravity(p.Gravity); err != nil {
+				return fmt.Errorf("site [%s] has an invalid gravity: %s", site, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// cacheHeaders returns the Surrogate-Control and Cache-Control of res, from its policy when it has one.
+func cacheHeaders(res *Response) (string, string) {
+	if res.Policy != nil {
+		return res.Policy.SurrogateControl, res.Policy.CacheControl
+	}
+
+	return *config.surrogateControl, *config.cacheControl
+}
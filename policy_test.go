@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cnf "github.com/bvchevez/imageprocess/config"
+	"github.com/bvchevez/imageprocess/image"
+	"github.com/stretchr/testify/assert"
+)
+
+// go test -run Test_PolicyForSite -v
+func Test_PolicyForSite(t *testing.T) {
+	if config.port == nil {
+		config.Init()
+	}
+	*config.defaultQuality = "85"
+	*config.cacheControl = "max-age=54321"
+	*config.surrogateControl = "max-age=12345"
+	colors, lossy := *config.defaultGifColors, *config.defaultGifLossy
+	defer func() { *config.defaultGifColors, *config.defaultGifLossy = colors, lossy }()
+	*config.defaultGifColors = "128"
+	*config.defaultGifLossy = "20"
+	sites, _ := cnf.NewRegistry([]cnf.Site{
+		{Name: "caranddriver", Domain: "cad.h-cdn.test.co", Policy: &cnf.Policy{
+			Quality:      70,
+			Format:       "png",
+			MaxWidth:     1000,
+			Operations:   []string{"resize", "crop"},
+			CacheControl: "max-age=60",
+			Upscale:      true,
+			GifColors:    64,
+			GifLossy:     80,
+		}},
+		{Name: "cosmopolitan", Domain: "cos.h-cdn.co"},
+	}, false)
+	cnf.SetSites(sites)
+	defer resetConfig()
+
+	p := PolicyForSite("caranddriver")
+	assert.Equal(t, int64(70), p.Options.Quality)
+	assert.Equal(t, int64(64), p.Options.Colors)
+	assert.Equal(t, int64(80), p.Options.Lossy)
+	assert.Equal(t, image.PNG, p.Options.Format)
+	assert.Equal(t, image.Policy{MaxWidth: 1000, Operations: []string{"resize", "crop"}, Upscale: true}, p.Operations)
+	assert.Equal(t, "max-age=60", p.CacheControl)
+	assert.Equal(t, "max-age=12345", p.SurrogateControl)
+
+	// sites without a policy get the global defaults.
+	p = PolicyForSite("cosmopolitan")
+	assert.Equal(t, int64(85), p.Options.Quality)
+	assert.Equal(t, int64(128), p.Options.Colors)
+	assert.Equal(t, int64(20), p.Options.Lossy)
+	assert.Equal(t, "", p.Options.Format)
+	assert.Equal(t, image.Policy{}, p.Operations)
+	assert.Equal(t, "max-age=54321", p.CacheControl)
+}
+
+// go test -run Test_Policy_PipelineID -v
+func Test_Policy_PipelineID(t *testing.T) {
+	p := &Policy{Options: image.Options{Quality: 85}}
+	id := p.PipelineID("caranddriver", "/a.jpg", "resize=100:*")
+	assert.Equal(t, id, (&Policy{Options: image.Options{Quality: 85}}).PipelineID("caranddriver", "/a.jpg", "resize=100:*"))
+	assert.NotEqual(t, id, p.PipelineID("caranddriver", "/a.jpg", "resize=200:*"))
+
+	// images processed with another policy are cached and revalidated apart.
+	assert.NotEqual(t, id, (&Policy{Options: image.Options{Quality: 70}}).PipelineID("caranddriver", "/a.jpg", "resize=100:*"))
+	assert.NotEqual(t, id, (&Policy{Options: image.Options{Quality: 85}, Operations: image.Policy{MaxWidth: 1000}}).PipelineID("caranddriver", "/a.jpg", "resize=100:*"))
+	assert.NotEqual(t, id, (&Policy{Options: image.Options{Quality: 85}, Operations: image.Policy{Gravity: "auto,auto"}}).PipelineID("caranddriver", "/a.jpg", "resize=100:*"))
+
+	// neither does the debug token, it's left out of the id.
+	assert.Equal(t, p.PipelineID("caranddriver", "/a.jpg", "resize=100:*&debug=smartcrop"),
+		p.PipelineID("caranddriver", "/a.jpg", "resize=100:*&debug=smartcrop&token=test-123"))
+
+	// cache headers don't change the image.
+	assert.Equal(t, id, (&Policy{Options: image.Options{Quality: 85}, CacheControl: "max-age=60"}).PipelineID("caranddriver", "/a.jpg", "resize=100:*"))
+}
+
+// go test -run Test_checkPolicies -v
+func Test_checkPolicies(t *testing.T) {
+	sites, _ := cnf.NewRegistry([]cnf.Site{
+		{Name: "a", Domain: "a.com", Policy: &cnf.Policy{Operations: []string{"resize", "crop"}}},
+	}, false)
+	assert.Nil(t, checkPolicies(sites))
+
+	sites, _ = cnf.NewRegistry([]cnf.Site{
+		{Name: "a", Domain: "a.com", Policy: &cnf.Policy{Operations: []string{"resize", "rotate"}}},
+	}, false)
+	assert.Equal(t, "site [a] allows an unknown operation [rotate]", checkPolicies(sites).Error())
+
+	for _, gravity := range []string{"center,top", "auto,auto", "0.5xw,10", "focus,0.3,0.6", "focus,0.3,0.6,1.5"} {
+		sites, _ = cnf.NewRegistry([]cnf.Site{
+			{Name: "a", Domain: "a.com", Policy: &cnf.Policy{Gravity: gravity}},
+		}, false)
+		assert.Nil(t, checkPolicies(sites), gravity)
+	}
+
+	// gravities are checked like crop positions.
+	for _, gravity := range []string{"middle,top", "center,up", "0.5xq,0", "focus,0.3"} {
+		sites, _ = cnf.NewRegistry([]cnf.Site{
+			{Name: "a", Domain: "a.com", Policy: &cnf.Policy{Gravity: gravity}},
+		}, false)
+		assert.NotNil(t, checkPolicies(sites), gravity)
+	}
+}
+
+// go test -run Test_ImageWriter_policy -v
+func Test_ImageWriter_policy(t *testing.T) {
+	if config.port == nil {
+		config.Init()
+	}
+	*config.surrogateControl = "max-age=12345"
+	*config.cacheControl = "max-age=54321"
+
+	res := &Response{
+		Code:   http.StatusOK,
+		Image:  &image.Image{Type: "mock/type"},
+		Policy: &Policy{CacheControl: "max-age=60", SurrogateControl: "max-age=120"},
+	}
+
+	w := httptest.NewRecorder()
+	ImageWriter(w, res)
+	assert.Equal(t, "max-age=120", w.Header().Get("Surrogate-Control"))
+	assert.Equal(t, "max-age=60", w.Header().Get("Cache-Control"))
+}
@@ -0,0 +1,84 @@
+package main
+
+// sites.go loads the site registry, and reloads it on SIGHUP or when its file changes.
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	cnf "github.com/bvchevez/imageprocess/config"
+	"github.com/bvchevez/imageprocess/helper"
+	log "github.com/Sirupsen/logrus"
+)
+
+// loadSites loads the sites file, and makes it the site registry.
+func loadSites() error {
+	sites, err := cnf.LoadSites(*config.sites, useCDN)
+	if err != nil {
+		return err
+	}
+	if err := checkPolicies(sites); err != nil {
+		return fmt.Errorf("invalid sites [%s]: %s", *config.sites, err)
+	}
+
+	cnf.SetSites(sites)
+	return nil
+}
+
+// reloadSites loads the sites file again. When it fails, the sites loaded before are kept.
+func reloadSites() {
+	if err := loadSites(); err != nil {
+		log.WithFields(log.Fields{
+			"sites": *config.sites,
+			"error": err.Error(),
+		}).Error("Failed to reload sites, keeping the sites loaded before.")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"sites": *config.sites,
+		"count": cnf.Sites().Len(),
+	}).Info("Reloaded sites.")
+}
+
+// sitesModTime is when the sites file was last changed, zero if it can't be read.
+func sitesModTime() time.Time {
+	info, err := os.Stat(*config.sites)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// WatchSites reloads the sites file on SIGHUP, and when it changes, which is checked every
+// sites-reload-interval seconds. Requests in flight finish with the sites they started with.
+func WatchSites() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if seconds := helper.String2Int64(*config.sitesReload); seconds > 0 {
+		tick = time.NewTicker(time.Duration(seconds) * time.Second).C
+	}
+
+	go watchSites(sitesModTime(), hup, tick)
+}
+
+// watchSites reloads the sites file when hup receives, or when it changed since modified by the time tick receives.
+func watchSites(modified time.Time, hup <-chan os.Signal, tick <-chan time.Time) {
+	for {
+		select {
+		case <-hup:
+		case <-tick:
+			if sitesModTime().Equal(modified) {
+				continue
+			}
+		}
+
+		modified = sitesModTime()
+		reloadSites()
+	}
+}
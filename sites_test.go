@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	cnf "github.com/bvchevez/imageprocess/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// go test -run Test_watchSites -v
+func Test_watchSites(t *testing.T) {
+	if config.port == nil {
+		config.Init()
+	}
+	f, _ := ioutil.TempFile("", "sites")
+	defer os.Remove(f.Name())
+	ioutil.WriteFile(f.Name(), []byte(`[{"site": "a", "domain": "a.com"}]`), 0644)
+
+	sites := *config.sites
+	*config.sites = f.Name()
+	defer func() {
+		*config.sites = sites
+		resetConfig()
+	}()
+	assert.Nil(t, loadSites())
+
+	hup := make(chan os.Signal)
+	tick := make(chan time.Time)
+	go watchSites(sitesModTime(), hup, tick)
+
+	// changes are picked up on the next tick.
+	ioutil.WriteFile(f.Name(), []byte(`[{"site": "a", "domain": "a.com"}, {"site": "b", "domain": "b.com"}]`), 0644)
+	os.Chtimes(f.Name(), time.Now(), time.Now().Add(time.Minute))
+	tick <- time.Now()
+	tick <- time.Now()
+	assert.True(t, cnf.Sites().IsAllowed("b"))
+
+	// and on SIGHUP. Invalid sites keep the sites loaded before.
+	ioutil.WriteFile(f.Name(), []byte(`[{"site": "b", "domain": "b.com"}, {"site": "b", "domain": "c.com"}]`), 0644)
+	hup <- os.Interrupt
+	hup <- os.Interrupt
+	assert.True(t, cnf.Sites().IsAllowed("a"))
+	assert.Equal(t, 2, cnf.Sites().Len())
+
+	ioutil.WriteFile(f.Name(), []byte(`[{"site": "c", "domain": "c.com"}]`), 0644)
+	hup <- os.Interrupt
+	hup <- os.Interrupt
+	assert.False(t, cnf.Sites().IsAllowed("a"))
+	assert.True(t, cnf.Sites().IsAllowed("c"))
+}
@@ -34,12 +34,11 @@ import (
 	"errors"
 	"image"
 	"image/color"
-	"log"
+	"image/draw"
 	"math"
-	"os"
 	"time"
 
-	"github.com/lazywei/go-opencv/opencv"
+	log "github.com/Sirupsen/logrus"
 	"github.com/llgcode/draw2d/draw2dimg"
 	"github.com/llgcode/draw2d/draw2dkit"
 	"github.com/nfnt/resize"
@@ -47,31 +46,8 @@ import (
 
 var skinColor = [3]float64{0.78, 0.57, 0.44}
 
-const (
-	detailWeight            = 0.2
-	skinBias                = 0.9
-	skinBrightnessMin       = 0.2
-	skinBrightnessMax       = 1.0
-	skinThreshold           = 0.8
-	skinWeight              = 1.8
-	saturationBrightnessMin = 0.05
-	saturationBrightnessMax = 0.9
-	saturationThreshold     = 0.4
-	saturationBias          = 0.2
-	saturationWeight        = 0.3
-	scoreDownSample         = 8
-	// step * minscale rounded down to the next power of two should be good
-	step              = 8
-	scaleStep         = 0.1
-	minScale          = 0.9
-	maxScale          = 1.0
-	edgeRadius        = 0.4
-	edgeWeight        = -20.0
-	outsideImportance = -0.5
-	ruleOfThirds      = true
-	prescale          = true
-	prescaleMin       = 400.00
-)
+// alternatives overlapping a better crop by more than this (intersection over union) are skipped
+const alternativeOverlap = 0.5
 
 // Score contains values that classify matches
 type Score struct {
@@ -83,21 +59,115 @@ type Score struct {
 
 // Crop contains results
 type Crop struct {
-	X      int
-	Y      int
-	Width  int
-	Height int
-	Score  Score
-	Faces  []*opencv.Rect
+	X            int
+	Y            int
+	Width        int
+	Height       int
+	Score        Score
+	Faces        []image.Rectangle
+	Alternatives []Crop      // Alternatives are the runner-up crops, best first, when CropSettings.Alternatives is set.
+	Debug        image.Image // Debug visualizes the analysis, at the prescaled resolution, when CropSettings.DebugMode is set.
 }
 
 //CropSettings contains options to
 //change cropping behaviour
+//Start from DefaultCropSettings, the zero value doesn't find useful crops.
 type CropSettings struct {
-	FaceDetection                    bool
-	FaceDetectionHaarCascadeFilepath string
-	InterpolationType                resize.InterpolationFunction
-	DebugMode                        bool
+	FaceDetection                    bool                         `json:"face_detection"`
+	FaceDetectionHaarCascadeFilepath string                       `json:"-"`
+	ExtraHaarCascadeFilepaths        []string                     `json:"-"` // ExtraHaarCascadeFilepaths are detected along with faces, e.g. profile faces or upper bodies.
+	FaceDetector                     FaceDetector                 `json:"-"` // FaceDetector overrides the default detector built from the cascade files.
+	InterpolationType                resize.InterpolationFunction `json:"-"`
+	DebugMode                        bool                         `json:"-"` // DebugMode renders Crop.Debug.
+	Alternatives                     int                          `json:"-"` // Alternatives is how many runner-up crops to return along with the top crop.
+	Logger                           *log.Entry                   `json:"-"` // Logger gets timings and counts of each analysis as debug fields, nil keeps smartcrop quiet.
+
+	// scoring
+	DetailWeight            float64 `json:"detail_weight"`
+	SkinBias                float64 `json:"skin_bias"`
+	SkinBrightnessMin       float64 `json:"skin_brightness_min"`
+	SkinBrightnessMax       float64 `json:"skin_brightness_max"`
+	SkinThreshold           float64 `json:"skin_threshold"`
+	SkinWeight              float64 `json:"skin_weight"`
+	SaturationBrightnessMin float64 `json:"saturation_brightness_min"`
+	SaturationBrightnessMax float64 `json:"saturation_brightness_max"`
+	SaturationThreshold     float64 `json:"saturation_threshold"`
+	SaturationBias          float64 `json:"saturation_bias"`
+	SaturationWeight        float64 `json:"saturation_weight"`
+	ScoreDownSample         int     `json:"score_down_sample"`
+	ScoreCells              int     `json:"score_cells"` // ScoreCells is how many cells per side crops are split into for scoring, more is slower but more accurate.
+	EdgeRadius              float64 `json:"edge_radius"`
+	EdgeWeight              float64 `json:"edge_weight"`
+	OutsideImportance       float64 `json:"outside_importance"`
+	RuleOfThirds            bool    `json:"rule_of_thirds"`
+
+	// candidate crops
+	// Step * MinScale rounded down to the next power of two should be good
+	Step      int     `json:"step"`
+	ScaleStep float64 `json:"scale_step"`
+	MinScale  float64 `json:"min_scale"`
+	MaxScale  float64 `json:"max_scale"`
+
+	// Prescale shrinks images so their smaller side is PrescaleMin pixels before analysis.
+	Prescale    bool    `json:"prescale"`
+	PrescaleMin float64 `json:"prescale_min"`
+}
+
+//DefaultCropSettings returns the settings smartcrop is tuned for,
+//with face detection using the given haar cascade.
+func DefaultCropSettings(faceDetectionHaarCascade string) CropSettings {
+	return CropSettings{
+		FaceDetection:                    true,
+		FaceDetectionHaarCascadeFilepath: faceDetectionHaarCascade,
+		InterpolationType:                resize.Bicubic,
+
+		DetailWeight:            0.2,
+		SkinBias:                0.9,
+		SkinBrightnessMin:       0.2,
+		SkinBrightnessMax:       1.0,
+		SkinThreshold:           0.8,
+		SkinWeight:              1.8,
+		SaturationBrightnessMin: 0.05,
+		SaturationBrightnessMax: 0.9,
+		SaturationThreshold:     0.4,
+		SaturationBias:          0.2,
+		SaturationWeight:        0.3,
+		ScoreDownSample:         8,
+		ScoreCells:              16,
+		EdgeRadius:              0.4,
+		EdgeWeight:              -20.0,
+		OutsideImportance:       -0.5,
+		RuleOfThirds:            true,
+
+		Step:      8,
+		ScaleStep: 0.1,
+		MinScale:  0.9,
+		MaxScale:  1.0,
+
+		Prescale:    true,
+		PrescaleMin: 400.00,
+	}
+}
+
+//Validate returns an error if the settings would make the analysis loop forever or divide by zero.
+func (s CropSettings) Validate() error {
+	if s.Step <= 0 {
+		return errors.New("Expect a step greater than 0")
+	}
+	if s.ScaleStep <= 0 {
+		return errors.New("Expect a scale step greater than 0")
+	}
+	if s.ScoreDownSample <= 0 {
+		return errors.New("Expect a score down sample greater than 0")
+	}
+	if s.MinScale > s.MaxScale {
+		return errors.New("Expect a min scale no greater than the max scale")
+	}
+	if d, ok := s.FaceDetector.(*HaarFaceDetector); ok {
+		return d.Validate()
+	}
+
+	return nil
 }
 
 //Analyzer interface analyzes its struct
@@ -107,6 +177,29 @@ type CropSettings struct {
 type Analyzer interface {
 	FindBestCrop(img image.Image, width, height int) (Crop, error)
 	FindBestCrop2(img image.Image, width, height int) (Crop, error)
+	FindBestCropFrames(frames []image.Image, width, height int) (Crop, error)
+
+	// Saliency and FindBestCrops split FindBestCrop2 (or FindBestCropFrames, given several frames) in two,
+	// so the saliency of an image is computed once for crops of several sizes.
+	Saliency(frames ...image.Image) (*Saliency, error)
+	FindBestCrops(s *Saliency, sizes []image.Point) ([]Crop, error)
+}
+
+// Saliency is the analysis of an image that doesn't depend on the crop size: the prescaled saliency map,
+// the faces found and the tables crops are scored with. It isn't modified once built,
+// so it can be shared between goroutines and cached.
+type Saliency struct {
+	size           image.Point // size of the analyzed image
+	prescalefactor float64
+	img            image.Image // img is the (first) prescaled frame, for debugging
+	o              *image.RGBA
+	faces          []image.Rectangle
+	scores         *scoreMap
+}
+
+// Size returns the size of the analyzed image.
+func (s *Saliency) Size() image.Point {
+	return s.size
 }
 
 type openCVAnalyzer struct {
@@ -115,19 +208,13 @@ type openCVAnalyzer struct {
 
 //NewAnalyzer returns a new analyzer with default settings
 func NewAnalyzer() Analyzer {
-	faceDetectionHaarCascade := "/usr/share/opencv/haarcascades/haarcascade_frontalface_alt.xml"
-
-	cropSettings := CropSettings{
-		FaceDetection:                    true,
-		FaceDetectionHaarCascadeFilepath: faceDetectionHaarCascade,
-		InterpolationType:                resize.Bicubic,
-		//DebugMode:                        false,
-	}
+	cropSettings := DefaultCropSettings("data/haarcascades/haarcascade_frontalface_alt.xml")
 
 	return &openCVAnalyzer{cropSettings: cropSettings}
 }
 
-//NewAnalyzerWithCropSettings returns a new analyzer with the given settings
+//NewAnalyzerWithCropSettings returns a new analyzer with the given settings,
+//its analysis fails if they aren't valid.
 func NewAnalyzerWithCropSettings(cropSettings CropSettings) Analyzer {
 	return &openCVAnalyzer{cropSettings: cropSettings}
 }
@@ -136,108 +223,156 @@ func (o openCVAnalyzer) FindBestCrop(img image.Image, width, height int) (Crop,
 	if width == 0 && height == 0 {
 		return Crop{}, errors.New("Expect either a height or width")
 	}
+	if err := o.cropSettings.Validate(); err != nil {
+		return Crop{}, err
+	}
 
 	scale := math.Min(float64(img.Bounds().Size().X)/float64(width), float64(img.Bounds().Size().Y)/float64(height))
 
 	// resize image for faster processing
-	var lowimg image.Image
-	var prescalefactor = 1.0
-
-	if prescale {
+	stats := &analysisStats{frames: 1}
+	now := time.Now()
+	lowimg, prescalefactor := prescaleImage(o.cropSettings, img)
+	since(&stats.prescale, now)
 
-		if f := prescaleMin / math.Min(float64(img.Bounds().Size().X), float64(img.Bounds().Size().Y)); f < 1.0 {
-			prescalefactor = f
-		}
-		log.Println(prescalefactor)
+	cropWidth, cropHeight := chop(float64(width)*scale*prescalefactor), chop(float64(height)*scale*prescalefactor)
+	realMinScale := math.Min(o.cropSettings.MaxScale, math.Max(1.0/scale, o.cropSettings.MinScale))
 
-		lowimg = resize.Resize(
-			uint(float64(img.Bounds().Size().X)*prescalefactor),
-			0,
-			img,
-			o.cropSettings.InterpolationType)
-	} else {
-		lowimg = img
+	topCrop, err := analyse(o.cropSettings, lowimg, cropWidth, cropHeight, realMinScale, stats)
+	if err != nil {
+		return topCrop, err
 	}
 
-	if o.cropSettings.DebugMode {
-		writeImageToPng(&lowimg, "./smartcrop_prescale.png")
+	if o.cropSettings.Prescale == true {
+		topCrop = rescaleCrop(topCrop, prescalefactor)
 	}
 
-	cropWidth, cropHeight := chop(float64(width)*scale*prescalefactor), chop(float64(height)*scale*prescalefactor)
-	realMinScale := math.Min(maxScale, math.Max(1.0/scale, minScale))
+	return topCrop, nil
+}
 
-	log.Printf("original resolution: %dx%d\n", img.Bounds().Size().X, img.Bounds().Size().Y)
-	log.Printf("scale: %f, cropw: %f, croph: %f, minscale: %f\n", scale, cropWidth, cropHeight, realMinScale)
+func (o openCVAnalyzer) FindBestCrop2(img image.Image, width, height int) (Crop, error) {
+	if width == 0 && height == 0 {
+		return Crop{}, errors.New("Expect either a height or width")
+	}
 
-	topCrop, err := analyse(o.cropSettings, lowimg, cropWidth, cropHeight, realMinScale)
+	s, err := o.Saliency(img)
 	if err != nil {
-		return topCrop, err
+		return Crop{}, err
 	}
 
-	if prescale == true {
-		topCrop.X = int(chop(float64(topCrop.X) / prescalefactor))
-		topCrop.Y = int(chop(float64(topCrop.Y) / prescalefactor))
-		topCrop.Width = int(chop(float64(topCrop.Width) / prescalefactor))
-		topCrop.Height = int(chop(float64(topCrop.Height) / prescalefactor))
+	topCrops, err := o.FindBestCrops(s, []image.Point{{X: width, Y: height}})
+	if err != nil {
+		return Crop{}, err
 	}
 
-	return topCrop, nil
+	return topCrops[0], nil
 }
 
-func (o openCVAnalyzer) FindBestCrop2(img image.Image, width, height int) (Crop, error) {
+// FindBestCropFrames analyzes several frames of the same animation and returns the crop
+// that scores best across all of them. The saliency maps of all frames are merged before scoring,
+// so a subject moving through the animation is kept in frame throughout.
+func (o openCVAnalyzer) FindBestCropFrames(frames []image.Image, width, height int) (Crop, error) {
+	if len(frames) == 0 {
+		return Crop{}, errors.New("Expect at least one frame")
+	}
 	if width == 0 && height == 0 {
 		return Crop{}, errors.New("Expect either a height or width")
 	}
 
-	focalScale := 3.0
-	scale := math.Max(math.Min(float64(img.Bounds().Size().X)/float64(width), float64(img.Bounds().Size().Y)/float64(height)) / focalScale, 1.0)
+	s, err := o.Saliency(frames...)
+	if err != nil {
+		return Crop{}, err
+	}
 
-	// resize image for faster processing
-	var lowimg image.Image
-	var prescalefactor = 1.0
+	topCrops, err := o.FindBestCrops(s, []image.Point{{X: width, Y: height}})
+	if err != nil {
+		return Crop{}, err
+	}
 
-	if prescale {
+	return topCrops[0], nil
+}
 
-		if f := prescaleMin / math.Min(float64(img.Bounds().Size().X), float64(img.Bounds().Size().Y)); f < 1.0 {
-			prescalefactor = f
-		}
-		log.Println(prescalefactor)
+// Saliency analyzes one image, or several frames of the same animation, up to the point where the crop size matters.
+// Frames are prescaled and their saliency maps merged, keeping the strongest value of each channel.
+func (o openCVAnalyzer) Saliency(frames ...image.Image) (*Saliency, error) {
+	if len(frames) == 0 {
+		return nil, errors.New("Expect at least one frame")
+	}
+	if err := o.cropSettings.Validate(); err != nil {
+		return nil, err
+	}
 
-		lowimg = resize.Resize(
-			uint(float64(img.Bounds().Size().X)*prescalefactor),
-			0,
-			img,
-			o.cropSettings.InterpolationType)
-	} else {
-		lowimg = img
+	s := &Saliency{
+		size:           frames[0].Bounds().Size(),
+		prescalefactor: 1.0,
 	}
 
-	if o.cropSettings.DebugMode {
-		writeImageToPng(&lowimg, "./smartcrop_prescale.png")
+	stats := &analysisStats{frames: len(frames)}
+	for _, frame := range frames {
+		now := time.Now()
+		lowimg, prescalefactor := prescaleImage(o.cropSettings, frame)
+		since(&stats.prescale, now)
+		if s.img == nil {
+			s.img = lowimg
+		}
+
+		out, faces, err := saliency(o.cropSettings, lowimg, stats)
+		if err != nil {
+			return nil, err
+		}
+
+		s.o = mergeSaliency(s.o, out.(*image.RGBA))
+		s.faces = append(s.faces, faces...)
+		s.prescalefactor = prescalefactor
 	}
 
-	cropWidth, cropHeight := chop(float64(width)*scale*prescalefactor), chop(float64(height)*scale*prescalefactor)
-	realMinScale := math.Min(maxScale, math.Max(1.0/scale, minScale))
+	s.scores = newScoreMap(&o.cropSettings, s.o)
 
-	log.Printf("original resolution: %dx%d\n", img.Bounds().Size().X, img.Bounds().Size().Y)
-	log.Printf("scale: %f, cropw: %f, croph: %f, minscale: %f\n", scale, cropWidth, cropHeight, realMinScale)
+	fields := stats.fields()
+	fields["width"] = s.size.X
+	fields["height"] = s.size.Y
+	fields["prescale_factor"] = s.prescalefactor
+	o.cropSettings.logDebug("Smartcrop saliency", fields)
 
-	topCrop, err := analyse(o.cropSettings, lowimg, cropWidth, cropHeight, realMinScale)
-	if err != nil {
-		return topCrop, err
+	return s, nil
+}
+
+// FindBestCrops returns the top crop of s for each of sizes, the same way FindBestCrop2 would for a single size.
+func (o openCVAnalyzer) FindBestCrops(s *Saliency, sizes []image.Point) ([]Crop, error) {
+	if err := o.cropSettings.Validate(); err != nil {
+		return nil, err
 	}
 
-	if prescale == true {
-		topCrop.X = int(chop(float64(topCrop.X) / prescalefactor))
-		topCrop.Y = int(chop(float64(topCrop.Y) / prescalefactor))
-		topCrop.Width = int(chop(float64(topCrop.Width) / prescalefactor))
-		topCrop.Height = int(chop(float64(topCrop.Height) / prescalefactor))
+	topCrops := make([]Crop, len(sizes))
+
+	for i, size := range sizes {
+		if size.X == 0 && size.Y == 0 {
+			return nil, errors.New("Expect either a height or width")
+		}
+
+		focalScale := 3.0
+		scale := math.Max(math.Min(float64(s.size.X)/float64(size.X), float64(s.size.Y)/float64(size.Y))/focalScale, 1.0)
+
+		cropWidth, cropHeight := chop(float64(size.X)*scale*s.prescalefactor), chop(float64(size.Y)*scale*s.prescalefactor)
+		realMinScale := math.Min(o.cropSettings.MaxScale, math.Max(1.0/scale, o.cropSettings.MinScale))
+
+		topCrop := bestCrop(&o.cropSettings, s.o, s.scores, cropWidth, cropHeight, realMinScale)
+		topCrop.Faces = append([]image.Rectangle(nil), s.faces...)
+
+		if o.cropSettings.DebugMode {
+			topCrop.Debug = debugImage(&o.cropSettings, s.img, s.o, topCrop)
+		}
+
+		if o.cropSettings.Prescale == true {
+			topCrop = rescaleCrop(topCrop, s.prescalefactor)
+		}
+
+		topCrops[i] = topCrop
 	}
 
-	return topCrop, nil
+	return topCrops, nil
 }
 
-
 // SmartCrop applies the smartcrop algorithms on the the given image and returns
 // the top crop or an error if somthing went wrong.
 func SmartCrop(img image.Image, width, height int) (Crop, error) {
@@ -252,6 +387,51 @@ func chop(x float64) float64 {
 	return math.Floor(x)
 }
 
+// prescaleImage resizes img for faster processing and returns it along with the factor it was scaled by.
+func prescaleImage(settings CropSettings, img image.Image) (image.Image, float64) {
+	if !settings.Prescale {
+		return img, 1.0
+	}
+
+	prescalefactor := 1.0
+	if f := settings.PrescaleMin / math.Min(float64(img.Bounds().Size().X), float64(img.Bounds().Size().Y)); f < 1.0 {
+		prescalefactor = f
+	}
+
+	lowimg := resize.Resize(
+		uint(float64(img.Bounds().Size().X)*prescalefactor),
+		0,
+		img,
+		settings.InterpolationType)
+
+	return lowimg, prescalefactor
+}
+
+// rescaleCrop scales a crop found on the prescaled image, along with its faces and alternatives,
+// back to the original image.
+func rescaleCrop(crop Crop, prescalefactor float64) Crop {
+	crop.X = int(chop(float64(crop.X) / prescalefactor))
+	crop.Y = int(chop(float64(crop.Y) / prescalefactor))
+	crop.Width = int(chop(float64(crop.Width) / prescalefactor))
+	crop.Height = int(chop(float64(crop.Height) / prescalefactor))
+
+	faces := make([]image.Rectangle, len(crop.Faces))
+	for i, face := range crop.Faces {
+		faces[i] = image.Rect(
+			int(chop(float64(face.Min.X)/prescalefactor)),
+			int(chop(float64(face.Min.Y)/prescalefactor)),
+			int(chop(float64(face.Max.X)/prescalefactor)),
+			int(chop(float64(face.Max.Y)/prescalefactor)))
+	}
+	crop.Faces = faces
+
+	for i := range crop.Alternatives {
+		crop.Alternatives[i] = rescaleCrop(crop.Alternatives[i], prescalefactor)
+	}
+
+	return crop
+}
+
 func thirds(x float64) float64 {
 	x = (math.Mod(x-(1.0/3.0)+1.0, 2.0)*0.5 - 0.5) * 16.0
 	return math.Max(1.0-x*x, 0.0)
@@ -261,37 +441,43 @@ func bounds(l float64) float64 {
 	return math.Min(math.Max(l, 0.0), 255)
 }
 
-func importance(crop *Crop, x, y int) float64 {
-	if crop.X > x || x >= crop.X+crop.Width || crop.Y > y || y >= crop.Y+crop.Height {
-		return outsideImportance
+func importance(settings *CropSettings, crop *Crop, x, y int) float64 {
+	return importanceAt(settings, crop, float64(x), float64(y))
+}
+
+// importanceAt is importance for any point, not just pixels.
+func importanceAt(settings *CropSettings, crop *Crop, x, y float64) float64 {
+	if float64(crop.X) > x || x >= float64(crop.X+crop.Width) || float64(crop.Y) > y || y >= float64(crop.Y+crop.Height) {
+		return settings.OutsideImportance
 	}
 
-	xf := float64(x-crop.X) / float64(crop.Width)
-	yf := float64(y-crop.Y) / float64(crop.Height)
+	xf := (x - float64(crop.X)) / float64(crop.Width)
+	yf := (y - float64(crop.Y)) / float64(crop.Height)
 
 	px := math.Abs(0.5-xf) * 2.0
 	py := math.Abs(0.5-yf) * 2.0
 
-	dx := math.Max(px-1.0+edgeRadius, 0.0)
-	dy := math.Max(py-1.0+edgeRadius, 0.0)
-	d := (dx*dx + dy*dy) * edgeWeight
+	dx := math.Max(px-1.0+settings.EdgeRadius, 0.0)
+	dy := math.Max(py-1.0+settings.EdgeRadius, 0.0)
+	d := (dx*dx + dy*dy) * settings.EdgeWeight
 
 	s := 1.41 - math.Sqrt(px*px+py*py)
-	if ruleOfThirds {
+	if settings.RuleOfThirds {
 		s += (math.Max(0.0, s+d+0.5) * 1.2) * (thirds(px) + thirds(py))
 	}
 
 	return s + d
 }
 
-func score(output *image.Image, crop *Crop) Score {
+// score scores crop pixel by pixel. It's the reference scoreMap is checked and benchmarked against.
+func score(settings *CropSettings, output *image.Image, crop *Crop) Score {
 	height := (*output).Bounds().Size().Y
 	width := (*output).Bounds().Size().X
 	score := Score{}
 
 	// same loops but with downsampling
-	for y := 0; y <= height-scoreDownSample; y += scoreDownSample {
-		for x := 0; x <= width-scoreDownSample; x += scoreDownSample {
+	for y := 0; y <= height-settings.ScoreDownSample; y += settings.ScoreDownSample {
+		for x := 0; x <= width-settings.ScoreDownSample; x += settings.ScoreDownSample {
 
 			r, g, b, _ := (*output).At(x, y).RGBA()
 
@@ -299,20 +485,20 @@ func score(output *image.Image, crop *Crop) Score {
 			g8 := float64(g >> 8)
 			b8 := float64(b >> 8)
 
-			imp := importance(crop, int(x), int(y))
+			imp := importance(settings, crop, int(x), int(y))
 			det := g8 / 255.0
 
-			score.Skin += r8 / 255.0 * (det + skinBias) * imp
+			score.Skin += r8 / 255.0 * (det + settings.SkinBias) * imp
 			score.Detail += det * imp
-			score.Saturation += b8 / 255.0 * (det + saturationBias) * imp
+			score.Saturation += b8 / 255.0 * (det + settings.SaturationBias) * imp
 		}
 	}
 
-	score.Total = (score.Detail*detailWeight + score.Skin*skinWeight + score.Saturation*saturationWeight) / float64(crop.Width) / float64(crop.Height)
+	score.Total = (score.Detail*settings.DetailWeight + score.Skin*settings.SkinWeight + score.Saturation*settings.SaturationWeight) / float64(crop.Width) / float64(crop.Height)
 	return score
 }
 
-func drawDebugCrop(topCrop *Crop, o *image.Image) {
+func drawDebugCrop(settings *CropSettings, topCrop *Crop, o *image.Image) {
 	w := (*o).Bounds().Size().X
 	h := (*o).Bounds().Size().Y
 
@@ -324,7 +510,7 @@ func drawDebugCrop(topCrop *Crop, o *image.Image) {
 			g8 := float64(g >> 8)
 			b8 := uint8(b >> 8)
 
-			imp := importance(topCrop, x, y)
+			imp := importance(settings, topCrop, x, y)
 
 			if imp > 0 {
 				g8 += imp * 32
@@ -338,71 +524,171 @@ func drawDebugCrop(topCrop *Crop, o *image.Image) {
 	}
 }
 
-func analyse(settings CropSettings, img image.Image, cropWidth, cropHeight, realMinScale float64) (Crop, error) {
-	var faces []*opencv.Rect
+func analyse(settings CropSettings, img image.Image, cropWidth, cropHeight, realMinScale float64, stats *analysisStats) (Crop, error) {
+	o, faces, err := saliency(settings, img, stats)
+	if err != nil {
+		return Crop{}, err
+	}
+	settings.logDebug("Smartcrop saliency", stats.fields())
+
+	topCrop := bestCrop(&settings, o, newScoreMap(&settings, o), cropWidth, cropHeight, realMinScale)
+
+	topCrop.Faces = faces
+
+	if settings.DebugMode {
+		topCrop.Debug = debugImage(&settings, img, o, topCrop)
+	}
+
+	return topCrop, nil
+}
+
+// saliency builds the map crops are scored against, with edges in the green channel,
+// skin (or faces) in the red channel and saturation in the blue channel.
+// The time each step takes and the faces found are added to stats.
+func saliency(settings CropSettings, img image.Image, stats *analysisStats) (image.Image, []image.Rectangle, error) {
+	var faces []image.Rectangle
 	var err error
-	o := image.Image(image.NewRGBA(img.Bounds()))
+	rgba := toRGBA(img)
+	o := image.NewRGBA(rgba.Bounds())
 
 	now := time.Now()
-	edgeDetect(img, o)
-	log.Println("Time elapsed edge:", time.Since(now))
-	debugOutput(settings.DebugMode, &o, "edge")
+	edgeDetect(rgba, o)
+	since(&stats.edges, now)
 
 	now = time.Now()
 	if settings.FaceDetection {
 		faces, err = faceDetect(settings, img, o)
 
 		if err != nil {
-			return Crop{}, err
+			return nil, nil, err
 		}
 
-		log.Println("Time elapsed face:", time.Since(now))
-		debugOutput(settings.DebugMode, &o, "face")
+		since(&stats.faceDetect, now)
+		stats.faces += len(faces)
 	} else {
-		skinDetect(img, o)
-		log.Println("Time elapsed skin:", time.Since(now))
-		debugOutput(settings.DebugMode, &o, "skin")
+		skinDetect(settings, rgba, o)
+		since(&stats.skinDetect, now)
 	}
 
 	now = time.Now()
-	saturationDetect(img, o)
-	log.Println("Time elapsed sat:", time.Since(now))
-	debugOutput(settings.DebugMode, &o, "saturation")
+	saturationDetect(settings, rgba, o)
+	since(&stats.saturation, now)
 
-	now = time.Now()
-	var topCrop Crop
-	topScore := -1.0
-	cs := crops(o, cropWidth, cropHeight, realMinScale)
-	log.Println("Time elapsed crops:", time.Since(now), len(cs))
+	return o, faces, nil
+}
+
+// bestCrop scores every candidate crop against the saliency map o, with its score map m, and returns the top one,
+// along with up to settings.Alternatives runner-up crops that don't overlap much with a better one.
+// Candidates are scored as they are generated, only their total scores are kept when alternatives are wanted.
+func bestCrop(settings *CropSettings, o image.Image, m *scoreMap, cropWidth, cropHeight, realMinScale float64) Crop {
+	now := time.Now()
+	cs := newCandidates(settings, o, cropWidth, cropHeight, realMinScale)
+	cropsTime := time.Since(now)
 
 	now = time.Now()
-	for _, crop := range cs {
-		nowIn := time.Now()
-		crop.Score = score(&o, &crop)
-		log.Println("Time elapsed single-score:", time.Since(nowIn))
-		if crop.Score.Total > topScore {
-			topCrop = crop
-			topScore = crop.Score.Total
+	var scores []float64
+	if settings.Alternatives > 0 {
+		scores = make([]float64, cs.total)
+	}
+	topCrop, topScore := topScoredCrop(settings, m, cs, scores)
+
+	settings.logDebug("Smartcrop scored crops", log.Fields{
+		"crop_width":  cropWidth,
+		"crop_height": cropHeight,
+		"min_scale":   realMinScale,
+		"candidates":  cs.total,
+		"crops_time":  cropsTime,
+		"score_time":  time.Since(now),
+		"top_score":   topScore,
+	})
+
+	if settings.Alternatives > 0 {
+		topCrop.Alternatives = alternativeCrops(settings, m, cs, scores, topCrop, settings.Alternatives)
+	}
+
+	return topCrop
+}
+
+// alternativeCrops returns up to n of the best scored crops after top, skipping the ones
+// that are mostly the same as top or as a better alternative. scores holds the total score of every candidate,
+// the ones that are skipped are set to NaN. Ties go to the first candidate, like they do for top.
+func alternativeCrops(settings *CropSettings, m *scoreMap, cs *candidates, scores []float64, top Crop, n int) []Crop {
+	skip := func(picked Crop) {
+		for i := range scores {
+			if !math.IsNaN(scores[i]) && cropOverlap(cs.crop(settings, i), picked) > alternativeOverlap {
+				scores[i] = math.NaN()
+			}
 		}
 	}
-	log.Println("Time elapsed score:", time.Since(now))
+	skip(top)
+
+	var picked []Crop
+	for len(picked) < n {
+		best := -1
+		for i, score := range scores {
+			if !math.IsNaN(score) && (best < 0 || score > scores[best]) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
 
-	if settings.DebugMode {
-		drawDebugCrop(&topCrop, &o)
-		debugOutput(true, &o, "final")
+		crop := cs.crop(settings, best)
+		crop.Score = m.score(settings, &crop)
+		scores[best] = math.NaN()
+		skip(crop)
+		picked = append(picked, crop)
 	}
 
-	topCrop.Faces = faces
+	return picked
+}
 
-	return topCrop, nil
+// cropOverlap returns the intersection over union of two crops.
+func cropOverlap(a, b Crop) float64 {
+	ra := image.Rect(a.X, a.Y, a.X+a.Width, a.Y+a.Height)
+	rb := image.Rect(b.X, b.Y, b.X+b.Width, b.Y+b.Height)
+
+	in := ra.Intersect(rb)
+	inArea := float64(in.Dx() * in.Dy())
+	union := float64(ra.Dx()*ra.Dy()+rb.Dx()*rb.Dy()) - inArea
+	if union <= 0 {
+		return 0
+	}
+
+	return inArea / union
+}
+
+// mergeSaliency merges the saliency map of one frame into the merged map of all previous frames
+// by keeping the strongest value of each channel. It returns the merged map.
+func mergeSaliency(merged, o *image.RGBA) *image.RGBA {
+	if merged == nil {
+		return o
+	}
+
+	// frames are prescaled individually, so in case of rounding differences we only merge the overlap.
+	b := merged.Bounds().Intersect(o.Bounds())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			mi := merged.PixOffset(x, y)
+			oi := o.PixOffset(x, y)
+			for c := 0; c < 3; c++ {
+				if o.Pix[oi+c] > merged.Pix[mi+c] {
+					merged.Pix[mi+c] = o.Pix[oi+c]
+				}
+			}
+		}
+	}
+
+	return merged
 }
 
 func saturation(c color.Color) float64 {
 	r, g, b, _ := c.RGBA()
-	r8 := float64(r >> 8)
-	g8 := float64(g >> 8)
-	b8 := float64(b >> 8)
+	return saturationRGB(float64(r>>8), float64(g>>8), float64(b>>8))
+}
 
+func saturationRGB(r8, g8, b8 float64) float64 {
 	maximum := math.Max(math.Max(r8/255.0, g8/255.0), b8/255.0)
 	minimum := math.Min(math.Min(r8/255.0, g8/255.0), b8/255.0)
 
@@ -422,19 +708,19 @@ func saturation(c color.Color) float64 {
 
 func cie(c color.Color) float64 {
 	r, g, b, _ := c.RGBA()
-	r8 := float64(r >> 8)
-	g8 := float64(g >> 8)
-	b8 := float64(b >> 8)
+	return cieRGB(float64(r>>8), float64(g>>8), float64(b>>8))
+}
 
+func cieRGB(r8, g8, b8 float64) float64 {
 	return 0.5126*b8 + 0.7152*g8 + 0.0722*r8
 }
 
 func skinCol(c color.Color) float64 {
 	r, g, b, _ := c.RGBA()
-	r8 := float64(r >> 8)
-	g8 := float64(g >> 8)
-	b8 := float64(b >> 8)
+	return skinColRGB(float64(r>>8), float64(g>>8), float64(b>>8))
+}
 
+func skinColRGB(r8, g8, b8 float64) float64 {
 	mag := math.Sqrt(r8*r8 + g8*g8 + b8*b8)
 	rd := r8/mag - skinColor[0]
 	gd := g8/mag - skinColor[1]
@@ -444,27 +730,49 @@ func skinCol(c color.Color) float64 {
 	return 1.0 - d
 }
 
-func makeCies(img image.Image) []float64 {
+// pixelRGB returns the channels of the pixel at Pix offset p of i.
+func pixelRGB(i *image.RGBA, p int) (float64, float64, float64) {
+	return float64(i.Pix[p]), float64(i.Pix[p+1]), float64(i.Pix[p+2])
+}
+
+// toRGBA returns img as an *image.RGBA with its origin at (0, 0), so the detections can read its Pix directly.
+// It is only copied when it isn't one already.
+func toRGBA(img image.Image) *image.RGBA {
+	size := img.Bounds().Size()
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	draw.Draw(rgba, rgba.Bounds(), img, image.Point{}, draw.Src)
+
+	return rgba
+}
+
+func makeCies(img *image.RGBA) []float64 {
 	w := img.Bounds().Size().X
 	h := img.Bounds().Size().Y
 	cies := make([]float64, h*w, h*w)
 	i := 0
 	for y := 0; y < h; y++ {
+		p := img.PixOffset(0, y)
 		for x := 0; x < w; x++ {
-			cies[i] = cie(img.At(x, y))
+			cies[i] = cieRGB(pixelRGB(img, p))
 			i++
+			p += 4
 		}
 	}
 
 	return cies
 }
 
-func edgeDetect(i image.Image, o image.Image) {
+func edgeDetect(i *image.RGBA, o *image.RGBA) {
 	w := i.Bounds().Size().X
 	h := i.Bounds().Size().Y
 	cies := makeCies(i)
 
 	for y := 0; y < h; y++ {
+		p := o.PixOffset(0, y)
 		for x := 0; x < w; x++ {
 			var lightness float64
 
@@ -479,93 +787,123 @@ func edgeDetect(i image.Image, o image.Image) {
 					cies[x+(y+1)*w]
 			}
 
-			nc := color.RGBA{0, uint8(bounds(lightness)), 0, 255}
-			o.(*image.RGBA).Set(x, y, nc)
+			o.Pix[p], o.Pix[p+1], o.Pix[p+2], o.Pix[p+3] = 0, uint8(bounds(lightness)), 0, 255
+			p += 4
 		}
 	}
 }
 
-func faceDetect(settings CropSettings, i image.Image, o image.Image) ([]*opencv.Rect, error) {
-	var faces []*opencv.Rect
-
-	cvImage := opencv.FromImage(i)
-	_, err := os.Stat(settings.FaceDetectionHaarCascadeFilepath)
+func faceDetect(settings CropSettings, i image.Image, o image.Image) ([]image.Rectangle, error) {
+	faces, err := detectFaces(settings, i)
 	if err != nil {
-		return faces, err
+		return nil, err
 	}
-	cascade := opencv.LoadHaarClassifierCascade(settings.FaceDetectionHaarCascadeFilepath)
-	faces = cascade.DetectObjects(cvImage)
 
 	gc := draw2dimg.NewGraphicContext((o).(*image.RGBA))
 
-	if settings.DebugMode == true {
-		log.Println("Faces detected:", len(faces))
-	}
-
 	for _, face := range faces {
-		if settings.DebugMode == true {
-			log.Printf("Face: x: %d y: %d w: %d h: %d\n", face.X(), face.Y(), face.Width(), face.Height())
-		}
 		draw2dkit.Ellipse(
 			gc,
-			float64(face.X()+(face.Width()/2)),
-			float64(face.Y()+(face.Height()/2)),
-			float64(face.Width()/2),
-			float64(face.Height())/2)
+			float64(face.Min.X+(face.Dx()/2)),
+			float64(face.Min.Y+(face.Dy()/2)),
+			float64(face.Dx()/2),
+			float64(face.Dy())/2)
 		gc.SetFillColor(color.RGBA{255, 0, 0, 255})
 		gc.Fill()
 	}
 	return faces, nil
 }
 
-func skinDetect(i image.Image, o image.Image) {
+// detectFaces runs settings.FaceDetector, or a detector for each of the cascades of settings, on i.
+func detectFaces(settings CropSettings, i image.Image) ([]image.Rectangle, error) {
+	detectors := []FaceDetector{settings.FaceDetector}
+	if settings.FaceDetector == nil {
+		detectors = nil
+		for _, path := range append([]string{settings.FaceDetectionHaarCascadeFilepath}, settings.ExtraHaarCascadeFilepaths...) {
+			detector, err := newFaceDetector(path)
+			if err != nil {
+				return nil, err
+			}
+			detectors = append(detectors, detector)
+		}
+	}
+
+	faces := []image.Rectangle{}
+	for _, detector := range detectors {
+		found, err := detector.DetectFaces(i)
+		if err != nil {
+			return nil, err
+		}
+		faces = append(faces, found...)
+	}
+
+	return faces, nil
+}
+
+func skinDetect(settings CropSettings, i *image.RGBA, o *image.RGBA) {
 	w := i.Bounds().Size().X
 	h := i.Bounds().Size().Y
 
 	for y := 0; y < h; y++ {
+		ip, op := i.PixOffset(0, y), o.PixOffset(0, y)
 		for x := 0; x < w; x++ {
-			lightness := cie(i.At(x, y)) / 255.0
-			skin := skinCol(i.At(x, y))
-
-			if skin > skinThreshold && lightness >= skinBrightnessMin && lightness <= skinBrightnessMax {
-				r := (skin - skinThreshold) * (255.0 / (1.0 - skinThreshold))
-				_, g, b, _ := o.At(x, y).RGBA()
-				nc := color.RGBA{uint8(bounds(r)), uint8(g >> 8), uint8(b >> 8), 255}
-				o.(*image.RGBA).Set(x, y, nc)
+			r8, g8, b8 := pixelRGB(i, ip)
+			lightness := cieRGB(r8, g8, b8) / 255.0
+			skin := skinColRGB(r8, g8, b8)
+
+			if skin > settings.SkinThreshold && lightness >= settings.SkinBrightnessMin && lightness <= settings.SkinBrightnessMax {
+				r := (skin - settings.SkinThreshold) * (255.0 / (1.0 - settings.SkinThreshold))
+				o.Pix[op] = uint8(bounds(r))
 			} else {
-				_, g, b, _ := o.At(x, y).RGBA()
-				nc := color.RGBA{0, uint8(g >> 8), uint8(b >> 8), 255}
-				o.(*image.RGBA).Set(x, y, nc)
+				o.Pix[op] = 0
 			}
+			ip += 4
+			op += 4
 		}
 	}
 }
 
-func saturationDetect(i image.Image, o image.Image) {
+func saturationDetect(settings CropSettings, i *image.RGBA, o *image.RGBA) {
 	w := i.Bounds().Size().X
 	h := i.Bounds().Size().Y
 
 	for y := 0; y < h; y++ {
+		ip, op := i.PixOffset(0, y), o.PixOffset(0, y)
 		for x := 0; x < w; x++ {
-			lightness := cie(i.At(x, y)) / 255.0
-			saturation := saturation(i.At(x, y))
-
-			if saturation > saturationThreshold && lightness >= saturationBrightnessMin && lightness <= saturationBrightnessMax {
-				b := (saturation - saturationThreshold) * (255.0 / (1.0 - saturationThreshold))
-				r, g, _, _ := o.At(x, y).RGBA()
-				nc := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(bounds(b)), 255}
-				o.(*image.RGBA).Set(x, y, nc)
+			r8, g8, b8 := pixelRGB(i, ip)
+			lightness := cieRGB(r8, g8, b8) / 255.0
+			saturation := saturationRGB(r8, g8, b8)
+
+			if saturation > settings.SaturationThreshold && lightness >= settings.SaturationBrightnessMin && lightness <= settings.SaturationBrightnessMax {
+				b := (saturation - settings.SaturationThreshold) * (255.0 / (1.0 - settings.SaturationThreshold))
+				o.Pix[op+2] = uint8(bounds(b))
 			} else {
-				r, g, _, _ := o.At(x, y).RGBA()
-				nc := color.RGBA{uint8(r >> 8), uint8(g >> 8), 0, 255}
-				o.(*image.RGBA).Set(x, y, nc)
+				o.Pix[op+2] = 0
 			}
+			ip += 4
+			op += 4
 		}
 	}
 }
 
-func crops(i image.Image, cropWidth, cropHeight, realMinScale float64) []Crop {
-	res := []Crop{}
+// candidates lists the candidate crops of an image without allocating them: every scale from MaxScale down to the
+// minimum scale, and at each scale every position Step pixels apart. Crops are numbered in that order.
+type candidates struct {
+	scales []candidateScale
+	total  int
+}
+
+// candidateScale holds the crops of one scale, rows x cols of them starting at crop number first.
+type candidateScale struct {
+	width  int
+	height int
+	cols   int
+	rows   int
+	first  int
+}
+
+func newCandidates(settings *CropSettings, i image.Image, cropWidth, cropHeight, realMinScale float64) *candidates {
+	cs := &candidates{}
 	width := i.Bounds().Size().X
 	height := i.Bounds().Size().Y
 
@@ -583,18 +921,43 @@ func crops(i image.Image, cropWidth, cropHeight, realMinScale float64) []Crop {
 		cropH = minDimension
 	}
 
-	for scale := maxScale; scale >= realMinScale; scale -= scaleStep {
-		for y := 0; float64(y)+cropH*scale <= float64(height); y += step {
-			for x := 0; float64(x)+cropW*scale <= float64(width); x += step {
-				res = append(res, Crop{
-					X:      x,
-					Y:      y,
-					Width:  int(cropW * scale),
-					Height: int(cropH * scale),
-				})
-			}
+	for scale := settings.MaxScale; scale >= realMinScale; scale -= settings.ScaleStep {
+		s := candidateScale{
+			width:  int(cropW * scale),
+			height: int(cropH * scale),
+			first:  cs.total,
+		}
+		for y := 0; float64(y)+cropH*scale <= float64(height); y += settings.Step {
+			s.rows++
+		}
+		for x := 0; float64(x)+cropW*scale <= float64(width); x += settings.Step {
+			s.cols++
+		}
+
+		if s.rows > 0 && s.cols > 0 {
+			cs.scales = append(cs.scales, s)
+			cs.total += s.rows * s.cols
 		}
 	}
 
-	return res
+	return cs
+}
+
+// crop returns the n-th candidate crop.
+func (cs *candidates) crop(settings *CropSettings, n int) Crop {
+	s := cs.scales[0]
+	for _, next := range cs.scales[1:] {
+		if next.first > n {
+			break
+		}
+		s = next
+	}
+
+	n -= s.first
+	return Crop{
+		X:      n % s.cols * settings.Step,
+		Y:      n / s.cols * settings.Step,
+		Width:  s.width,
+		Height: s.height,
+	}
 }
@@ -0,0 +1,378 @@
+package smartcrop
+
+import (
+	"image"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testAnalyzer(alternatives int) Analyzer {
+	settings := DefaultCropSettings(testCascade)
+	settings.Alternatives = alternatives
+	return NewAnalyzerWithCropSettings(settings)
+}
+
+//go test ./smartcrop -run Test_FindBestCrop2_Faces -v
+func Test_FindBestCrop2_Faces(t *testing.T) {
+	crop, err := testAnalyzer(0).FindBestCrop2(loadTestImage(t, "test/face.jpg"), 200, 100)
+
+	assert.Nil(t, err)
+	assert.Len(t, crop.Alternatives, 0)
+	if assert.Len(t, crop.Faces, 1) {
+		// faces are reported in source image pixels.
+		assert.True(t, crop.Faces[0].In(loadTestImage(t, "test/face.jpg").Bounds()))
+	}
+}
+
+//go test ./smartcrop -run Test_FindBestCrop2_Alternatives -v
+func Test_FindBestCrop2_Alternatives(t *testing.T) {
+	crop, err := testAnalyzer(3).FindBestCrop2(loadTestImage(t, "test/noface.png"), 100, 100)
+
+	assert.Nil(t, err)
+	assert.True(t, len(crop.Alternatives) > 0 && len(crop.Alternatives) <= 3)
+
+	picked := append([]Crop{crop}, crop.Alternatives...)
+	for i := 1; i < len(picked); i++ {
+		assert.True(t, picked[i].Score.Total <= picked[i-1].Score.Total)
+		for j := 0; j < i; j++ {
+			assert.True(t, cropOverlap(picked[i], picked[j]) <= alternativeOverlap)
+		}
+	}
+}
+
+//go test ./smartcrop -run Test_CropOverlap -v
+func Test_CropOverlap(t *testing.T) {
+	a := Crop{X: 0, Y: 0, Width: 10, Height: 10}
+
+	assert.Equal(t, 1.0, cropOverlap(a, a))
+	assert.Equal(t, 0.0, cropOverlap(a, Crop{X: 10, Y: 0, Width: 10, Height: 10}))
+	assert.Equal(t, 1.0/3.0, cropOverlap(a, Crop{X: 5, Y: 0, Width: 10, Height: 10}))
+}
+
+//go test ./smartcrop -run Test_FindBestCrop2_Debug -v
+func Test_FindBestCrop2_Debug(t *testing.T) {
+	settings := DefaultCropSettings(testCascade)
+	settings.DebugMode = true
+	img := loadTestImage(t, "test/face.jpg")
+	crop, err := NewAnalyzerWithCropSettings(settings).FindBestCrop2(img, 200, 100)
+
+	assert.Nil(t, err)
+	if assert.NotNil(t, crop.Debug) {
+		assert.Equal(t, img.Bounds().Size(), crop.Debug.Bounds().Size())
+	}
+
+	crop, err = testAnalyzer(0).FindBestCrop2(img, 200, 100)
+	assert.Nil(t, err)
+	assert.Nil(t, crop.Debug)
+}
+
+//go test ./smartcrop -run Test_FindBestCrop2_ExtraCascades -v
+func Test_FindBestCrop2_ExtraCascades(t *testing.T) {
+	settings := DefaultCropSettings(testCascade)
+	settings.ExtraHaarCascadeFilepaths = []string{testCascade}
+
+	crop, err := NewAnalyzerWithCropSettings(settings).FindBestCrop2(loadTestImage(t, "test/face.jpg"), 200, 100)
+	assert.Nil(t, err)
+	// every cascade reports its own detections.
+	assert.Len(t, crop.Faces, 2)
+
+	settings.ExtraHaarCascadeFilepaths = []string{"test/missing.xml"}
+	_, err = NewAnalyzerWithCropSettings(settings).FindBestCrop2(loadTestImage(t, "test/face.jpg"), 200, 100)
+	assert.NotNil(t, err)
+}
+
+//go test ./smartcrop -run Test_FindBestCrop2_Weights -v
+func Test_FindBestCrop2_Weights(t *testing.T) {
+	img := loadTestImage(t, "test/face.jpg")
+
+	// with skin ignored and detail favored, the crop isn't pulled towards the face.
+	settings := DefaultCropSettings(testCascade)
+	settings.FaceDetection = false
+	settings.SkinWeight = 0
+	settings.SaturationWeight = 0
+	detail, err := NewAnalyzerWithCropSettings(settings).FindBestCrop2(img, 100, 100)
+	assert.Nil(t, err)
+	assert.InDelta(t, detail.Score.Detail*settings.DetailWeight/float64(detail.Width*detail.Height), detail.Score.Total, 1e-9)
+
+	settings.ScoreDownSample = 16
+	coarse, err := NewAnalyzerWithCropSettings(settings).FindBestCrop2(img, 100, 100)
+	assert.Nil(t, err)
+	assert.NotEqual(t, detail.Score, coarse.Score)
+}
+
+//go test ./smartcrop -run Test_FindBestCrops -v
+func Test_FindBestCrops(t *testing.T) {
+	img := loadTestImage(t, "test/face.jpg")
+	analyzer := testAnalyzer(0)
+	sizes := []image.Point{{X: 100, Y: 100}, {X: 200, Y: 150}, {X: 160, Y: 90}}
+
+	s, err := analyzer.Saliency(img)
+	assert.Nil(t, err)
+	assert.Equal(t, img.Bounds().Size(), s.Size())
+
+	topCrops, err := analyzer.FindBestCrops(s, sizes)
+	assert.Nil(t, err)
+	if assert.Len(t, topCrops, len(sizes)) {
+		// the saliency is shared, every size gets the crop it would get on its own.
+		for i, size := range sizes {
+			expected, err := analyzer.FindBestCrop2(img, size.X, size.Y)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, topCrops[i])
+		}
+	}
+
+	_, err = analyzer.FindBestCrops(s, []image.Point{{X: 100, Y: 100}, {}})
+	assert.NotNil(t, err)
+
+	_, err = analyzer.Saliency()
+	assert.NotNil(t, err)
+}
+
+//go test ./smartcrop -run Test_CropSettings_Validate -v
+func Test_CropSettings_Validate(t *testing.T) {
+	assert.Nil(t, DefaultCropSettings(testCascade).Validate())
+
+	for _, invalid := range []func(*CropSettings){
+		func(s *CropSettings) { s.Step = 0 },
+		func(s *CropSettings) { s.ScaleStep = 0 },
+		func(s *CropSettings) { s.ScoreDownSample = -1 },
+		func(s *CropSettings) { s.MinScale = s.MaxScale + 0.1 },
+		func(s *CropSettings) { s.FaceDetector = &HaarFaceDetector{ScaleFactor: 1, MinNeighbors: 3} },
+		func(s *CropSettings) { s.FaceDetector = &HaarFaceDetector{ScaleFactor: 1.1, MinNeighbors: -1} },
+	} {
+		settings := DefaultCropSettings(testCascade)
+		invalid(&settings)
+		assert.NotNil(t, settings.Validate())
+	}
+
+	// the zero value fails instead of looping forever.
+	img := loadTestImage(t, "test/noface.png")
+	_, err := NewAnalyzerWithCropSettings(CropSettings{}).FindBestCrop(img, 100, 100)
+	assert.NotNil(t, err)
+	_, err = NewAnalyzerWithCropSettings(CropSettings{}).FindBestCrop2(img, 100, 100)
+	assert.NotNil(t, err)
+}
+
+func testSaliency(b testing.TB) (*CropSettings, image.Image) {
+	settings := DefaultCropSettings(testCascade)
+	settings.FaceDetection = false
+
+	f, err := os.Open("test/face.jpg")
+	if err != nil {
+		b.Fatalf("Error not expected at open %s", err.Error())
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		b.Fatalf("Error not expected at decode %s", err.Error())
+	}
+
+	o, _, err := saliency(settings, img, &analysisStats{})
+	if err != nil {
+		b.Fatalf("Error not expected at saliency %s", err.Error())
+	}
+	return &settings, o
+}
+
+// listCrops returns every candidate crop, in order.
+func listCrops(settings *CropSettings, o image.Image, cropWidth, cropHeight, realMinScale float64) []Crop {
+	cs := newCandidates(settings, o, cropWidth, cropHeight, realMinScale)
+	res := make([]Crop, cs.total)
+	for i := range res {
+		res[i] = cs.crop(settings, i)
+	}
+	return res
+}
+
+//go test ./smartcrop -run Test_Candidates -v
+func Test_Candidates(t *testing.T) {
+	settings := DefaultCropSettings(testCascade)
+	settings.Step = 10
+	settings.MinScale = 0.8
+	o := image.NewRGBA(image.Rect(0, 0, 100, 60))
+
+	var expected []Crop
+	for scale := settings.MaxScale; scale >= settings.MinScale; scale -= settings.ScaleStep {
+		for y := 0; float64(y)+50*scale <= 60; y += settings.Step {
+			for x := 0; float64(x)+80*scale <= 100; x += settings.Step {
+				expected = append(expected, Crop{X: x, Y: y, Width: int(80 * scale), Height: int(50 * scale)})
+			}
+		}
+	}
+
+	assert.Equal(t, expected, listCrops(&settings, o, 80, 50, settings.MinScale))
+	assert.Len(t, listCrops(&settings, o, 200, 50, settings.MinScale), 0)
+}
+
+//go test ./smartcrop -run Test_BestCrop_Exhaustive -v
+func Test_BestCrop_Exhaustive(t *testing.T) {
+	settings, o := testSaliency(t)
+	settings.Alternatives = 5
+	m := newScoreMap(settings, o)
+
+	// scoring every listed crop and sorting them picks the same crops.
+	cs := listCrops(settings, o, 200, 100, 0.9)
+	var expected Crop
+	topScore := -1.0
+	for i := range cs {
+		cs[i].Score = m.score(settings, &cs[i])
+		if cs[i].Score.Total > topScore {
+			expected = cs[i]
+			topScore = cs[i].Score.Total
+		}
+	}
+	sort.SliceStable(cs, func(i, j int) bool {
+		return cs[i].Score.Total > cs[j].Score.Total
+	})
+	picked := []Crop{expected}
+	for _, crop := range cs {
+		distinct := len(picked) <= settings.Alternatives
+		for _, p := range picked {
+			distinct = distinct && cropOverlap(crop, p) <= alternativeOverlap
+		}
+		if distinct {
+			picked = append(picked, crop)
+		}
+	}
+	expected.Alternatives = picked[1:]
+
+	assert.Equal(t, expected, bestCrop(settings, o, m, 200, 100, 0.9))
+}
+
+//go test ./smartcrop -run Test_ScoreMap_Exact -v
+func Test_ScoreMap_Exact(t *testing.T) {
+	settings, o := testSaliency(t)
+	// with a cell per sample, the score map is exactly the reference score.
+	settings.ScoreCells = 1000
+	m := newScoreMap(settings, o)
+
+	for _, crop := range listCrops(settings, o, 200, 100, 0.9)[:50] {
+		expected := score(settings, &o, &crop)
+		actual := m.score(settings, &crop)
+		assert.InDelta(t, expected.Detail, actual.Detail, 1e-6)
+		assert.InDelta(t, expected.Skin, actual.Skin, 1e-6)
+		assert.InDelta(t, expected.Saturation, actual.Saturation, 1e-6)
+		assert.InDelta(t, expected.Total, actual.Total, 1e-9)
+	}
+}
+
+//go test ./smartcrop -run Test_ScoreMap_TopCrop -v
+func Test_ScoreMap_TopCrop(t *testing.T) {
+	settings, o := testSaliency(t)
+
+	var expected Crop
+	topScore := -1.0
+	cs := listCrops(settings, o, 200, 100, 0.9)
+	for i := range cs {
+		cs[i].Score = score(settings, &o, &cs[i])
+		if cs[i].Score.Total > topScore {
+			expected = cs[i]
+			topScore = cs[i].Score.Total
+		}
+	}
+
+	// the default cells approximate importance, the top crop is still about the same.
+	actual := bestCrop(settings, o, newScoreMap(settings, o), 200, 100, 0.9)
+	assert.InDelta(t, expected.X, actual.X, float64(2*settings.Step))
+	assert.InDelta(t, expected.Y, actual.Y, float64(2*settings.Step))
+	assert.Equal(t, expected.Width, actual.Width)
+}
+
+//go test ./smartcrop -run NONE -bench BenchmarkScore -benchmem
+func BenchmarkScore_Reference(b *testing.B) {
+	settings, o := testSaliency(b)
+	cs := listCrops(settings, o, 200, 100, 0.9)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range cs {
+			cs[i].Score = score(settings, &o, &cs[i])
+		}
+	}
+}
+
+func BenchmarkScore_ScoreMap(b *testing.B) {
+	settings, o := testSaliency(b)
+	cs := listCrops(settings, o, 200, 100, 0.9)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		m := newScoreMap(settings, o)
+		for i := range cs {
+			cs[i].Score = m.score(settings, &cs[i])
+		}
+	}
+}
+
+func BenchmarkScore_Parallel(b *testing.B) {
+	settings, o := testSaliency(b)
+	cs := newCandidates(settings, o, 200, 100, 0.9)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		topScoredCrop(settings, newScoreMap(settings, o), cs, nil)
+	}
+}
+
+//go test ./smartcrop -run NONE -bench BenchmarkFindBestCrops -benchmem
+func BenchmarkFindBestCrops_Separate(b *testing.B) {
+	img := loadTestImage(b, "test/face.jpg")
+	analyzer := testAnalyzer(0)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, size := range benchmarkSizes {
+			analyzer.FindBestCrop2(img, size.X, size.Y)
+		}
+	}
+}
+
+func BenchmarkFindBestCrops_Shared(b *testing.B) {
+	img := loadTestImage(b, "test/face.jpg")
+	analyzer := testAnalyzer(0)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		s, _ := analyzer.Saliency(img)
+		analyzer.FindBestCrops(s, benchmarkSizes)
+	}
+}
+
+// benchmarkSizes are the 1:1, 4:3 and 16:9 crops responsive templates ask for.
+var benchmarkSizes = []image.Point{{X: 150, Y: 150}, {X: 200, Y: 150}, {X: 240, Y: 135}}
+
+//go test ./smartcrop -run NONE -bench 'BenchmarkSaliency|BenchmarkBestCrop' -benchmem
+func BenchmarkSaliency(b *testing.B) {
+	settings, _ := testSaliency(b)
+	img := loadTestImage(b, "test/face.jpg")
+	lowimg, _ := prescaleImage(*settings, img)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		saliency(*settings, lowimg, &analysisStats{})
+	}
+}
+
+func BenchmarkBestCrop(b *testing.B) {
+	settings, o := testSaliency(b)
+	m := newScoreMap(settings, o)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		bestCrop(settings, o, m, 200, 100, 0.9)
+	}
+}
+
+func BenchmarkBestCrop_Alternatives(b *testing.B) {
+	settings, o := testSaliency(b)
+	settings.Alternatives = 5
+	m := newScoreMap(settings, o)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		bestCrop(settings, o, m, 200, 100, 0.9)
+	}
+}
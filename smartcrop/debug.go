@@ -32,33 +32,58 @@ package smartcrop
 
 import (
 	"image"
-	"image/jpeg"
-	"image/png"
-	"os"
+	"image/color"
 )
 
-func debugOutput(debug bool, img *image.Image, debugType string) {
-	if debug {
-		writeImageToPng(img, "./smartcrop_"+debugType+".png")
+var (
+	debugFaceColor = color.RGBA{255, 255, 255, 255}
+	debugCropColor = color.RGBA{255, 255, 0, 255}
+)
+
+// debugImage renders the analysis of img: a dimmed grayscale copy of img with the saliency map o on top
+// (skin or faces in red, edges in green, saturation in blue), the crop's importance shaded in,
+// and the faces and the crop outlined.
+func debugImage(settings *CropSettings, img image.Image, o image.Image, crop Crop) image.Image {
+	b := o.Bounds()
+	out := image.Image(image.NewRGBA(b))
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			base := cie(img.At(x, y)) / 4.0
+			r, g, bl, _ := o.At(x, y).RGBA()
+
+			out.(*image.RGBA).Set(x, y, color.RGBA{
+				uint8(bounds(base + float64(r>>8))),
+				uint8(bounds(base + float64(g>>8))),
+				uint8(bounds(base + float64(bl>>8))),
+				255,
+			})
+		}
 	}
-}
 
-func writeImageToJpeg(img *image.Image, name string) {
-	fso, err := os.Create(name)
-	if err != nil {
-		panic(err)
+	drawDebugCrop(settings, &crop, &out)
+
+	for _, face := range crop.Faces {
+		drawDebugRect(out.(*image.RGBA), face, debugFaceColor)
 	}
-	defer fso.Close()
+	drawDebugRect(out.(*image.RGBA), image.Rect(crop.X, crop.Y, crop.X+crop.Width, crop.Y+crop.Height), debugCropColor)
 
-	jpeg.Encode(fso, (*img), &jpeg.Options{Quality: 100})
+	return out
 }
 
-func writeImageToPng(img *image.Image, name string) {
-	fso, err := os.Create(name)
-	if err != nil {
-		panic(err)
+// drawDebugRect outlines r on img.
+func drawDebugRect(img *image.RGBA, r image.Rectangle, c color.Color) {
+	r = r.Intersect(img.Bounds())
+	if r.Empty() {
+		return
 	}
-	defer fso.Close()
 
-	png.Encode(fso, (*img))
+	for x := r.Min.X; x < r.Max.X; x++ {
+		img.Set(x, r.Min.Y, c)
+		img.Set(x, r.Max.Y-1, c)
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		img.Set(r.Min.X, y, c)
+		img.Set(r.Max.X-1, y, c)
+	}
 }
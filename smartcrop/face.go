@@ -0,0 +1,71 @@
+package smartcrop
+
+import (
+	"errors"
+	"image"
+)
+
+// FaceDetector finds faces in an image and returns their bounding rectangles.
+type FaceDetector interface {
+	DetectFaces(img image.Image) ([]image.Rectangle, error)
+}
+
+// newFaceDetector builds the FaceDetector used when CropSettings doesn't provide one.
+// Building with the "opencv" tag replaces it with the OpenCV backend.
+var newFaceDetector = NewHaarFaceDetector
+
+// HaarFaceDetector is a pure Go face detector that evaluates OpenCV haar cascades.
+type HaarFaceDetector struct {
+	Cascade      *HaarCascade
+	ScaleFactor  float64 // ScaleFactor is how much the search window grows on every pass.
+	MinNeighbors int     // MinNeighbors is how many overlapping detections it takes to accept a face.
+	MinSize      int     // MinSize is the smallest face width, in pixels, we look for.
+}
+
+// NewHaarFaceDetector returns a HaarFaceDetector using the cascade file at cascadePath.
+func NewHaarFaceDetector(cascadePath string) (FaceDetector, error) {
+	cascade, err := LoadHaarCascade(cascadePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HaarFaceDetector{
+		Cascade:      cascade,
+		ScaleFactor:  1.1,
+		MinNeighbors: 3,
+	}, nil
+}
+
+// Validate returns an error if d would search forever, or if it can't group detections.
+func (d *HaarFaceDetector) Validate() error {
+	if d.ScaleFactor <= 1 {
+		return errors.New("Expect a scale factor greater than 1")
+	}
+	if d.MinNeighbors < 0 {
+		return errors.New("Expect min neighbors of 0 or more")
+	}
+
+	return nil
+}
+
+// DetectFaces finds faces in img.
+func (d *HaarFaceDetector) DetectFaces(img image.Image) ([]image.Rectangle, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	return d.Cascade.Detect(img, d.ScaleFactor, d.MinNeighbors, d.MinSize), nil
+}
+
+// DetectFaces finds faces in img the way auto crops do, with the same detectors and prescaling,
+// whether settings.FaceDetection is set or not. Faces are returned in img pixels.
+func DetectFaces(settings CropSettings, img image.Image) ([]image.Rectangle, error) {
+	lowimg, prescalefactor := prescaleImage(settings, img)
+
+	faces, err := detectFaces(settings, lowimg)
+	if err != nil {
+		return nil, err
+	}
+
+	return rescaleCrop(Crop{Faces: faces}, prescalefactor).Faces, nil
+}
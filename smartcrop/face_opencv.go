@@ -0,0 +1,41 @@
+// +build opencv
+
+package smartcrop
+
+import (
+	"image"
+	"os"
+
+	"github.com/lazywei/go-opencv/opencv"
+)
+
+// OpenCVFaceDetector detects faces through OpenCV. It's only available when built with the "opencv" tag,
+// in which case it replaces HaarFaceDetector as the default.
+type OpenCVFaceDetector struct {
+	cascade *opencv.HaarCascade
+}
+
+// NewOpenCVFaceDetector returns an OpenCVFaceDetector using the cascade file at cascadePath.
+func NewOpenCVFaceDetector(cascadePath string) (FaceDetector, error) {
+	if _, err := os.Stat(cascadePath); err != nil {
+		return nil, err
+	}
+
+	return &OpenCVFaceDetector{cascade: opencv.LoadHaarClassifierCascade(cascadePath)}, nil
+}
+
+// DetectFaces finds faces in img.
+func (d *OpenCVFaceDetector) DetectFaces(img image.Image) ([]image.Rectangle, error) {
+	faces := []image.Rectangle{}
+	offset := img.Bounds().Min
+
+	for _, face := range d.cascade.DetectObjects(opencv.FromImage(img)) {
+		faces = append(faces, image.Rect(face.X(), face.Y(), face.X()+face.Width(), face.Y()+face.Height()).Add(offset))
+	}
+
+	return faces, nil
+}
+
+func init() {
+	newFaceDetector = NewOpenCVFaceDetector
+}
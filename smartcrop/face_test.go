@@ -0,0 +1,149 @@
+package smartcrop
+
+import (
+	"image"
+	"os"
+	"testing"
+
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCascade = "../data/haarcascades/haarcascade_frontalface_alt.xml"
+
+func loadTestImage(t testing.TB, path string) image.Image {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Error not expected at open %s", err.Error())
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Error not expected at decode %s", err.Error())
+	}
+	return img
+}
+
+//go test ./smartcrop -run Test_HaarFaceDetector_Face -v
+func Test_HaarFaceDetector_Face(t *testing.T) {
+	detector, err := NewHaarFaceDetector(testCascade)
+	assert.Nil(t, err)
+
+	faces, err := detector.DetectFaces(loadTestImage(t, "test/face.jpg"))
+	assert.Nil(t, err)
+	if assert.Len(t, faces, 1) {
+		assert.True(t, faces[0].Overlaps(image.Rect(165, 10, 235, 90)), "face found at %v", faces[0])
+	}
+}
+
+//go test ./smartcrop -run Test_HaarFaceDetector_NoFace -v
+func Test_HaarFaceDetector_NoFace(t *testing.T) {
+	detector, err := NewHaarFaceDetector(testCascade)
+	assert.Nil(t, err)
+
+	faces, err := detector.DetectFaces(loadTestImage(t, "test/noface.png"))
+	assert.Nil(t, err)
+	assert.Len(t, faces, 0)
+}
+
+//go test ./smartcrop -run Test_HaarFaceDetector_Invalid -v
+func Test_HaarFaceDetector_Invalid(t *testing.T) {
+	detector, err := NewHaarFaceDetector(testCascade)
+	assert.Nil(t, err)
+	assert.Nil(t, detector.(*HaarFaceDetector).Validate())
+	img := loadTestImage(t, "test/face.jpg")
+
+	// a scale factor of 1 or less would never grow the window out of the image.
+	for _, scaleFactor := range []float64{1, 0.9, 0} {
+		detector.(*HaarFaceDetector).ScaleFactor = scaleFactor
+		_, err = detector.DetectFaces(img)
+		assert.NotNil(t, err, "%v", scaleFactor)
+		assert.Len(t, detector.(*HaarFaceDetector).Cascade.Detect(img, scaleFactor, 3, 0), 0)
+	}
+
+	detector.(*HaarFaceDetector).ScaleFactor = 1.1
+	detector.(*HaarFaceDetector).MinNeighbors = -1
+	_, err = detector.DetectFaces(img)
+	assert.NotNil(t, err)
+}
+
+//go test ./smartcrop -run Test_HaarFaceDetector_MissingCascade -v
+func Test_HaarFaceDetector_MissingCascade(t *testing.T) {
+	_, err := NewHaarFaceDetector("test/missing.xml")
+	assert.NotNil(t, err)
+}
+
+//go test ./smartcrop -run Test_DetectFaces -v
+func Test_DetectFaces(t *testing.T) {
+	settings := DefaultCropSettings(testCascade)
+	// skipping face detection for auto crops doesn't skip it here.
+	settings.FaceDetection = false
+
+	faces, err := DetectFaces(settings, loadTestImage(t, "test/face.jpg"))
+	assert.Nil(t, err)
+	if assert.Len(t, faces, 1) {
+		// faces are reported in source image pixels.
+		assert.True(t, faces[0].Overlaps(image.Rect(165, 10, 235, 90)), "face found at %v", faces[0])
+	}
+
+	settings.FaceDetectionHaarCascadeFilepath = "test/missing.xml"
+	_, err = DetectFaces(settings, loadTestImage(t, "test/face.jpg"))
+	assert.NotNil(t, err)
+}
+
+//go test ./smartcrop -run Test_IntegralImage_Tilted -v
+func Test_IntegralImage_Tilted(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 12, 12))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7 % 251)
+	}
+	ii := newIntegralImage(img, true)
+
+	// brute force of OpenCV's definition: the sum of every pixel above (X, Y) within the 45 degree cone.
+	bruteForce := func(X, Y int) float64 {
+		sum := 0.0
+		for y := 0; y < Y; y++ {
+			for x := 0; x < 12; x++ {
+				d := x - X + 1
+				if d < 0 {
+					d = -d
+				}
+				if d <= Y-1-y {
+					sum += float64(img.GrayAt(x, y).Y)
+				}
+			}
+		}
+		return sum
+	}
+
+	for y := 0; y <= 12; y++ {
+		for x := -4; x <= 16; x++ {
+			assert.Equal(t, bruteForce(x, y), ii.tilted[y*ii.tiltedStride+x+ii.tiltedPad], "tilted at %d,%d", x, y)
+		}
+	}
+}
+
+//go test ./smartcrop -run Test_IntegralImage_TiltedSum -v
+func Test_IntegralImage_TiltedSum(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 12, 12))
+	for i := range img.Pix {
+		img.Pix[i] = 1
+	}
+	ii := newIntegralImage(img, true)
+
+	// a rotated w x h rectangle covers 2*w*h pixels.
+	for _, r := range [][4]int{{4, 0, 3, 2}, {5, 2, 4, 4}, {6, 1, 2, 5}} {
+		assert.Equal(t, float64(2*r[2]*r[3]), ii.tiltedSum(r[0], r[1], r[2], r[3]), "rect %v", r)
+	}
+}
+
+//go test ./smartcrop -run Test_LoadHaarCascade_Bundled -v
+func Test_LoadHaarCascade_Bundled(t *testing.T) {
+	for _, name := range []string{"haarcascade_profileface.xml", "haarcascade_upperbody.xml"} {
+		_, err := LoadHaarCascade("../data/haarcascades/" + name)
+		assert.Nil(t, err, name)
+	}
+}
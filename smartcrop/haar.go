@@ -0,0 +1,532 @@
+package smartcrop
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// haarCascades caches loaded cascades by path, parsing the xml is far more expensive than detecting.
+	haarCascades   = map[string]*HaarCascade{}
+	haarCascadesMu sync.Mutex
+)
+
+// HaarCascade is a Viola-Jones classifier cascade as trained by OpenCV.
+type HaarCascade struct {
+	width  int
+	height int
+	tilted bool // tilted is true if any feature needs the tilted integral image.
+	stages []haarStage
+}
+
+type haarStage struct {
+	threshold float64
+	trees     []haarTree
+}
+
+type haarTree struct {
+	nodes []haarNode
+}
+
+// haarNode is a single weak classifier. left/right point to the next node in the tree, or are -1
+// when the branch ends in leftVal/rightVal.
+type haarNode struct {
+	rects     []haarRect
+	tilted    bool
+	threshold float64
+	left      int
+	right     int
+	leftVal   float64
+	rightVal  float64
+}
+
+type haarRect struct {
+	x, y, w, h int
+	weight     float64
+}
+
+// xml layout of the (old style) OpenCV haar cascade files found in data/haarcascades.
+type haarCascadeXML struct {
+	Cascade struct {
+		Size   string `xml:"size"`
+		Stages []struct {
+			Trees []struct {
+				Nodes []struct {
+					Rects     []string `xml:"feature>rects>_"`
+					Tilted    int      `xml:"feature>tilted"`
+					Threshold float64  `xml:"threshold"`
+					LeftVal   *float64 `xml:"left_val"`
+					RightVal  *float64 `xml:"right_val"`
+					LeftNode  *int     `xml:"left_node"`
+					RightNode *int     `xml:"right_node"`
+				} `xml:"_"`
+			} `xml:"trees>_"`
+			Threshold float64 `xml:"stage_threshold"`
+		} `xml:"stages>_"`
+	} `xml:",any"`
+}
+
+// LoadHaarCascade loads an OpenCV haar cascade xml file. Cascades are cached, so loading the same path twice is cheap.
+func LoadHaarCascade(path string) (*HaarCascade, error) {
+	haarCascadesMu.Lock()
+	defer haarCascadesMu.Unlock()
+
+	if c, ok := haarCascades[path]; ok {
+		return c, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var doc haarCascadeXML
+	if err := xml.NewDecoder(f).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid haar cascade [%s]: %s", path, err)
+	}
+
+	c := &HaarCascade{}
+	if _, err := fmt.Sscanf(doc.Cascade.Size, "%d %d", &c.width, &c.height); err != nil {
+		return nil, fmt.Errorf("invalid haar cascade size [%s]: %s", doc.Cascade.Size, err)
+	}
+
+	for _, s := range doc.Cascade.Stages {
+		stage := haarStage{threshold: s.Threshold}
+		for _, t := range s.Trees {
+			tree := haarTree{}
+			for _, n := range t.Nodes {
+				node := haarNode{
+					tilted:    n.Tilted == 1,
+					threshold: n.Threshold,
+					left:      -1,
+					right:     -1,
+				}
+				c.tilted = c.tilted || node.tilted
+
+				for _, r := range n.Rects {
+					rect, err := parseHaarRect(r)
+					if err != nil {
+						return nil, err
+					}
+					node.rects = append(node.rects, rect)
+				}
+
+				switch {
+				case n.LeftVal != nil:
+					node.leftVal = *n.LeftVal
+				case n.LeftNode != nil:
+					node.left = *n.LeftNode
+				}
+				switch {
+				case n.RightVal != nil:
+					node.rightVal = *n.RightVal
+				case n.RightNode != nil:
+					node.right = *n.RightNode
+				}
+
+				tree.nodes = append(tree.nodes, node)
+			}
+			stage.trees = append(stage.trees, tree)
+		}
+		c.stages = append(c.stages, stage)
+	}
+
+	if len(c.stages) == 0 {
+		return nil, fmt.Errorf("haar cascade [%s] has no stages", path)
+	}
+
+	haarCascades[path] = c
+	return c, nil
+}
+
+// parseHaarRect parses rectangles like "3 7 14 4 -1.".
+func parseHaarRect(s string) (haarRect, error) {
+	f := strings.Fields(s)
+	if len(f) != 5 {
+		return haarRect{}, fmt.Errorf("invalid haar rect [%s]", s)
+	}
+
+	var v [5]float64
+	for i := range f {
+		n, err := strconv.ParseFloat(f[i], 64)
+		if err != nil {
+			return haarRect{}, fmt.Errorf("invalid haar rect [%s]", s)
+		}
+		v[i] = n
+	}
+
+	return haarRect{x: int(v[0]), y: int(v[1]), w: int(v[2]), h: int(v[3]), weight: v[4]}, nil
+}
+
+// Detect runs the cascade over img and returns the grouped detections.
+// scaleFactor is how much the search window grows every pass (e.g. 1.1), minNeighbors is the number of overlapping
+// raw detections needed to keep a detection, and minSize is the smallest window width in pixels we look at.
+// Nothing is detected when scaleFactor isn't greater than 1, the window would never grow out of img.
+func (c *HaarCascade) Detect(img image.Image, scaleFactor float64, minNeighbors, minSize int) []image.Rectangle {
+	raw := []image.Rectangle{}
+	if scaleFactor <= 1 {
+		return raw
+	}
+	ii := newIntegralImage(img, c.tilted)
+
+	for scale := 1.0; ; scale *= scaleFactor {
+		winWidth := int(round(scale * float64(c.width)))
+		winHeight := int(round(scale * float64(c.height)))
+		if winWidth > ii.width || winHeight > ii.height {
+			break
+		}
+		if winWidth < minSize {
+			continue
+		}
+
+		sc := c.scale(scale, winWidth, winHeight)
+		step := int(round(math.Max(2, scale)))
+
+		for y := 0; y+winHeight <= ii.height; y += step {
+			for x := 0; x+winWidth <= ii.width; x += step {
+				if sc.passes(ii, x, y) {
+					raw = append(raw, image.Rect(x, y, x+winWidth, y+winHeight))
+				}
+			}
+		}
+	}
+
+	offset := img.Bounds().Min
+	faces := groupRectangles(raw, minNeighbors, 0.2)
+	for i := range faces {
+		faces[i] = faces[i].Add(offset)
+	}
+
+	return faces
+}
+
+// scaledCascade is a cascade with features scaled, and weights normalized, for a single window size.
+type scaledCascade struct {
+	*HaarCascade
+	equ         image.Rectangle // equ is the window minus a one pixel border, used for variance normalization.
+	weightScale float64
+	nodes       [][][]haarNode // nodes are per stage, per tree.
+}
+
+func (c *HaarCascade) scale(scale float64, winWidth, winHeight int) *scaledCascade {
+	sc := &scaledCascade{HaarCascade: c}
+
+	sx, sy := int(round(scale)), int(round(scale))
+	sc.equ = image.Rect(sx, sy, sx+int(round(float64(c.width-2)*scale)), sy+int(round(float64(c.height-2)*scale)))
+	sc.weightScale = 1.0 / float64(sc.equ.Dx()*sc.equ.Dy())
+
+	sc.nodes = make([][][]haarNode, len(c.stages))
+	for s, stage := range c.stages {
+		sc.nodes[s] = make([][]haarNode, len(stage.trees))
+		for t, tree := range stage.trees {
+			nodes := make([]haarNode, len(tree.nodes))
+			for n, node := range tree.nodes {
+				scaled := node
+				scaled.rects = make([]haarRect, len(node.rects))
+
+				correction := sc.weightScale
+				if node.tilted {
+					correction *= 0.5
+				}
+
+				// the first rect's weight is rebalanced so that rounding the scaled rects doesn't skew the feature.
+				var area0, sum0 float64
+				for r, rect := range node.rects {
+					tr := haarRect{
+						x:      int(round(float64(rect.x) * scale)),
+						y:      int(round(float64(rect.y) * scale)),
+						w:      int(round(float64(rect.w) * scale)),
+						h:      int(round(float64(rect.h) * scale)),
+						weight: rect.weight * correction,
+					}
+					// rounding must never push an upright rect outside of the window.
+					if !node.tilted {
+						tr.w = minInt(tr.w, winWidth-tr.x)
+						tr.h = minInt(tr.h, winHeight-tr.y)
+					}
+					if r == 0 {
+						area0 = float64(tr.w * tr.h)
+					} else {
+						sum0 += tr.weight * float64(tr.w*tr.h)
+					}
+					scaled.rects[r] = tr
+				}
+				if area0 > 0 {
+					scaled.rects[0].weight = -sum0 / area0
+				}
+
+				nodes[n] = scaled
+			}
+			sc.nodes[s][t] = nodes
+		}
+	}
+
+	return sc
+}
+
+// passes evaluates every stage on the window at (x, y).
+func (sc *scaledCascade) passes(ii *integralImage, x, y int) bool {
+	equ := sc.equ.Add(image.Pt(x, y))
+	mean := ii.sum(equ) * sc.weightScale
+	variance := ii.sqsum(equ)*sc.weightScale - mean*mean
+	norm := 1.0
+	if variance > 0 {
+		norm = math.Sqrt(variance)
+	}
+
+	for s, stage := range sc.stages {
+		stageSum := 0.0
+		for _, tree := range sc.nodes[s] {
+			n := 0
+			for {
+				node := &tree[n]
+				val := 0.0
+				for _, r := range node.rects {
+					if node.tilted {
+						val += r.weight * ii.tiltedSum(x+r.x, y+r.y, r.w, r.h)
+					} else {
+						val += r.weight * ii.sum(image.Rect(x+r.x, y+r.y, x+r.x+r.w, y+r.y+r.h))
+					}
+				}
+
+				if val < node.threshold*norm {
+					if node.left < 0 {
+						stageSum += node.leftVal
+						break
+					}
+					n = node.left
+				} else {
+					if node.right < 0 {
+						stageSum += node.rightVal
+						break
+					}
+					n = node.right
+				}
+			}
+		}
+
+		if stageSum < stage.threshold {
+			return false
+		}
+	}
+
+	return true
+}
+
+// integralImage holds summed area tables of the grayscale image, so any rectangle sum takes constant time.
+type integralImage struct {
+	width  int
+	height int
+	stride int
+	sums   []float64
+	sqsums []float64
+
+	// tilted is the 45 degree rotated summed area table. It's padded by height columns on both sides,
+	// since the triangles it sums reach outside of the image.
+	tilted       []float64
+	tiltedStride int
+	tiltedPad    int
+}
+
+func newIntegralImage(img image.Image, tilted bool) *integralImage {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	ii := &integralImage{
+		width:  w,
+		height: h,
+		stride: w + 1,
+		sums:   make([]float64, (w+1)*(h+1)),
+		sqsums: make([]float64, (w+1)*(h+1)),
+	}
+
+	gray := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			gray[y*w+x] = math.Floor((0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(bl>>8)) + 0.5)
+		}
+	}
+
+	for y := 1; y <= h; y++ {
+		var rowSum, rowSqSum float64
+		for x := 1; x <= w; x++ {
+			p := gray[(y-1)*w+x-1]
+			rowSum += p
+			rowSqSum += p * p
+			ii.sums[y*ii.stride+x] = ii.sums[(y-1)*ii.stride+x] + rowSum
+			ii.sqsums[y*ii.stride+x] = ii.sqsums[(y-1)*ii.stride+x] + rowSqSum
+		}
+	}
+
+	if tilted {
+		ii.buildTilted(gray)
+	}
+
+	return ii
+}
+
+// buildTilted fills in the tilted table, where tilted(X, Y) is the sum of all pixels (x, y)
+// with y < Y and |x - X + 1| <= Y - y - 1, the triangle above and centered on (X-1, Y-1).
+func (ii *integralImage) buildTilted(gray []float64) {
+	w, h := ii.width, ii.height
+	ii.tiltedPad = h + 1
+	ii.tiltedStride = w + 1 + 2*ii.tiltedPad
+	ii.tilted = make([]float64, ii.tiltedStride*(h+1))
+
+	pixel := func(x, y int) float64 {
+		if x < 0 || x >= w || y < 0 || y >= h {
+			return 0
+		}
+		return gray[y*w+x]
+	}
+	at := func(x, y int) float64 {
+		if y < 0 {
+			return 0
+		}
+		x += ii.tiltedPad
+		if x < 0 || x >= ii.tiltedStride {
+			return 0
+		}
+		return ii.tilted[y*ii.tiltedStride+x]
+	}
+
+	for y := 1; y <= h; y++ {
+		for x := -ii.tiltedPad; x < w+1+ii.tiltedPad; x++ {
+			ii.tilted[y*ii.tiltedStride+x+ii.tiltedPad] = at(x-1, y-1) + at(x+1, y-1) - at(x, y-2) +
+				pixel(x-1, y-1) + pixel(x-1, y-2)
+		}
+	}
+}
+
+func (ii *integralImage) sum(r image.Rectangle) float64 {
+	return ii.sums[r.Max.Y*ii.stride+r.Max.X] - ii.sums[r.Min.Y*ii.stride+r.Max.X] -
+		ii.sums[r.Max.Y*ii.stride+r.Min.X] + ii.sums[r.Min.Y*ii.stride+r.Min.X]
+}
+
+func (ii *integralImage) sqsum(r image.Rectangle) float64 {
+	return ii.sqsums[r.Max.Y*ii.stride+r.Max.X] - ii.sqsums[r.Min.Y*ii.stride+r.Max.X] -
+		ii.sqsums[r.Max.Y*ii.stride+r.Min.X] + ii.sqsums[r.Min.Y*ii.stride+r.Min.X]
+}
+
+// tiltedSum sums the 45 degree rotated rectangle whose top corner is (x, y), going w pixels down-right and h pixels down-left.
+func (ii *integralImage) tiltedSum(x, y, w, h int) float64 {
+	t := func(x, y int) float64 {
+		return ii.tilted[y*ii.tiltedStride+x+ii.tiltedPad]
+	}
+
+	return t(x, y) - t(x-h, y+h) - t(x+w, y+w) + t(x+w-h, y+w+h)
+}
+
+// groupRectangles clusters similar raw detections, keeping clusters with more than minNeighbors members,
+// and drops detections nested inside a stronger one. This mirrors OpenCV's groupRectangles.
+func groupRectangles(rects []image.Rectangle, minNeighbors int, eps float64) []image.Rectangle {
+	labels := make([]int, len(rects))
+	for i := range labels {
+		labels[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if labels[i] != i {
+			labels[i] = find(labels[i])
+		}
+		return labels[i]
+	}
+
+	for i := range rects {
+		for j := i + 1; j < len(rects); j++ {
+			if similarRects(rects[i], rects[j], eps) {
+				labels[find(i)] = find(j)
+			}
+		}
+	}
+
+	type cluster struct {
+		x, y, w, h int
+		n          int
+	}
+	clusters := map[int]*cluster{}
+	order := []int{}
+	for i, r := range rects {
+		l := find(i)
+		c, ok := clusters[l]
+		if !ok {
+			c = &cluster{}
+			clusters[l] = c
+			order = append(order, l)
+		}
+		c.x += r.Min.X
+		c.y += r.Min.Y
+		c.w += r.Dx()
+		c.h += r.Dy()
+		c.n++
+	}
+
+	candidates := []image.Rectangle{}
+	neighbors := []int{}
+	for _, l := range order {
+		c := clusters[l]
+		if c.n <= minNeighbors {
+			continue
+		}
+		n := float64(c.n)
+		x, y := int(round(float64(c.x)/n)), int(round(float64(c.y)/n))
+		candidates = append(candidates, image.Rect(x, y, x+int(round(float64(c.w)/n)), y+int(round(float64(c.h)/n))))
+		neighbors = append(neighbors, c.n)
+	}
+
+	grouped := []image.Rectangle{}
+	for i, r1 := range candidates {
+		nested := false
+		for j, r2 := range candidates {
+			if i == j {
+				continue
+			}
+			dx := int(round(float64(r2.Dx()) * eps))
+			dy := int(round(float64(r2.Dy()) * eps))
+			if r1.Min.X >= r2.Min.X-dx && r1.Min.Y >= r2.Min.Y-dy &&
+				r1.Max.X <= r2.Max.X+dx && r1.Max.Y <= r2.Max.Y+dy &&
+				(neighbors[j] > maxInt(3, neighbors[i]) || neighbors[i] < 3) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			grouped = append(grouped, r1)
+		}
+	}
+
+	return grouped
+}
+
+func similarRects(r1, r2 image.Rectangle, eps float64) bool {
+	delta := eps * float64(minInt(r1.Dx(), r2.Dx())+minInt(r1.Dy(), r2.Dy())) * 0.5
+	return math.Abs(float64(r1.Min.X-r2.Min.X)) <= delta &&
+		math.Abs(float64(r1.Min.Y-r2.Min.Y)) <= delta &&
+		math.Abs(float64(r1.Max.X-r2.Max.X)) <= delta &&
+		math.Abs(float64(r1.Max.Y-r2.Max.Y)) <= delta
+}
+
+func round(x float64) float64 {
+	return math.Floor(x + 0.5)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
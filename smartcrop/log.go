@@ -0,0 +1,44 @@
+package smartcrop
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// analysisStats collects how long each step of building a saliency map took, across all frames.
+type analysisStats struct {
+	frames     int
+	faces      int
+	prescale   time.Duration
+	edges      time.Duration
+	faceDetect time.Duration
+	skinDetect time.Duration
+	saturation time.Duration
+}
+
+// since adds the time elapsed since start to d.
+func since(d *time.Duration, start time.Time) {
+	*d += time.Since(start)
+}
+
+func (s *analysisStats) fields() log.Fields {
+	return log.Fields{
+		"frames":          s.frames,
+		"faces":           s.faces,
+		"prescale_time":   s.prescale,
+		"edge_time":       s.edges,
+		"face_time":       s.faceDetect,
+		"skin_time":       s.skinDetect,
+		"saturation_time": s.saturation,
+	}
+}
+
+// logDebug logs msg with fields to settings.Logger, if there is one.
+func (settings *CropSettings) logDebug(msg string, fields log.Fields) {
+	if settings.Logger == nil {
+		return
+	}
+
+	settings.Logger.WithFields(fields).Debug(msg)
+}
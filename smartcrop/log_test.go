@@ -0,0 +1,42 @@
+package smartcrop
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+//go test ./smartcrop -run Test_Logger_Fields -v
+func Test_Logger_Fields(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.New()
+	logger.Out = &out
+	logger.Formatter = &log.JSONFormatter{}
+	logger.Level = log.DebugLevel
+
+	settings := DefaultCropSettings(testCascade)
+	settings.Logger = logger.WithField("pipeline_id", "abc")
+	_, err := NewAnalyzerWithCropSettings(settings).FindBestCrop2(loadTestImage(t, "test/face.jpg"), 200, 100)
+	assert.Nil(t, err)
+
+	for _, field := range []string{`"pipeline_id":"abc"`, `"faces":1`, `"face_time"`, `"prescale_time"`, `"candidates"`, `"score_time"`} {
+		assert.Contains(t, out.String(), field)
+	}
+}
+
+//go test ./smartcrop -run Test_Logger_Quiet -v
+func Test_Logger_Quiet(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+	level := log.GetLevel()
+	log.SetLevel(log.DebugLevel)
+	defer log.SetLevel(level)
+
+	_, err := testAnalyzer(0).FindBestCrop2(loadTestImage(t, "test/face.jpg"), 200, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, "", out.String())
+}
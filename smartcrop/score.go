@@ -0,0 +1,187 @@
+package smartcrop
+
+import (
+	"image"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// scoreMap holds summed area tables of the detail, skin and saturation values of a saliency map,
+// sampled every ScoreDownSample pixels like score does. Any crop is scored with a constant number
+// of lookups, by splitting it into ScoreCells x ScoreCells cells that each use the importance at their center.
+// When a crop has no more samples per side than there are cells, the result is exactly that of score.
+type scoreMap struct {
+	downSample int
+	width      int // samples per row
+	height     int // samples per column
+
+	detail     []float64
+	skin       []float64
+	saturation []float64
+}
+
+func newScoreMap(settings *CropSettings, o image.Image) *scoreMap {
+	ds := settings.ScoreDownSample
+	size := o.Bounds().Size()
+
+	m := &scoreMap{downSample: ds}
+	if size.X >= ds {
+		m.width = (size.X-ds)/ds + 1
+	}
+	if size.Y >= ds {
+		m.height = (size.Y-ds)/ds + 1
+	}
+
+	stride := m.width + 1
+	m.detail = make([]float64, stride*(m.height+1))
+	m.skin = make([]float64, stride*(m.height+1))
+	m.saturation = make([]float64, stride*(m.height+1))
+
+	rgba, isRGBA := o.(*image.RGBA)
+	for sy := 0; sy < m.height; sy++ {
+		for sx := 0; sx < m.width; sx++ {
+			x, y := sx*ds, sy*ds
+
+			var r8, g8, b8 float64
+			if isRGBA {
+				i := rgba.PixOffset(x, y)
+				r8, g8, b8 = float64(rgba.Pix[i]), float64(rgba.Pix[i+1]), float64(rgba.Pix[i+2])
+			} else {
+				r, g, b, _ := o.At(x, y).RGBA()
+				r8, g8, b8 = float64(r>>8), float64(g>>8), float64(b>>8)
+			}
+
+			det := g8 / 255.0
+			i := (sy+1)*stride + sx + 1
+			m.detail[i] = det + m.detail[i-1] + m.detail[i-stride] - m.detail[i-stride-1]
+			m.skin[i] = r8/255.0*(det+settings.SkinBias) + m.skin[i-1] + m.skin[i-stride] - m.skin[i-stride-1]
+			m.saturation[i] = b8/255.0*(det+settings.SaturationBias) + m.saturation[i-1] + m.saturation[i-stride] - m.saturation[i-stride-1]
+		}
+	}
+
+	return m
+}
+
+// sum adds up the samples [x0, x1) x [y0, y1) of table.
+func (m *scoreMap) sum(table []float64, x0, y0, x1, y1 int) float64 {
+	stride := m.width + 1
+	return table[y1*stride+x1] - table[y0*stride+x1] - table[y1*stride+x0] + table[y0*stride+x0]
+}
+
+// samples returns the range of sample indexes covering the pixels [from, to), clamped to n samples.
+func (m *scoreMap) samples(from, to, n int) (int, int) {
+	first := (from + m.downSample - 1) / m.downSample
+	last := (to + m.downSample - 1) / m.downSample
+	if first < 0 {
+		first = 0
+	}
+	if last > n {
+		last = n
+	}
+	if first > last {
+		first = last
+	}
+
+	return first, last
+}
+
+// score scores crop the same way as score, see scoreMap.
+func (m *scoreMap) score(settings *CropSettings, crop *Crop) Score {
+	x0, x1 := m.samples(crop.X, crop.X+crop.Width, m.width)
+	y0, y1 := m.samples(crop.Y, crop.Y+crop.Height, m.height)
+	cells := settings.ScoreCells
+	ds := float64(m.downSample)
+
+	score := Score{}
+	var inDetail, inSkin, inSaturation float64
+	for cy := 0; cy < cells; cy++ {
+		ya, yb := y0+(y1-y0)*cy/cells, y0+(y1-y0)*(cy+1)/cells
+		if ya == yb {
+			continue
+		}
+		fy := float64(ya+yb-1) / 2.0 * ds
+
+		for cx := 0; cx < cells; cx++ {
+			xa, xb := x0+(x1-x0)*cx/cells, x0+(x1-x0)*(cx+1)/cells
+			if xa == xb {
+				continue
+			}
+			fx := float64(xa+xb-1) / 2.0 * ds
+
+			imp := importanceAt(settings, crop, fx, fy)
+			detail := m.sum(m.detail, xa, ya, xb, yb)
+			skin := m.sum(m.skin, xa, ya, xb, yb)
+			saturation := m.sum(m.saturation, xa, ya, xb, yb)
+
+			score.Detail += detail * imp
+			score.Skin += skin * imp
+			score.Saturation += saturation * imp
+			inDetail += detail
+			inSkin += skin
+			inSaturation += saturation
+		}
+	}
+
+	// everything outside of the crop has the same importance.
+	score.Detail += (m.sum(m.detail, 0, 0, m.width, m.height) - inDetail) * settings.OutsideImportance
+	score.Skin += (m.sum(m.skin, 0, 0, m.width, m.height) - inSkin) * settings.OutsideImportance
+	score.Saturation += (m.sum(m.saturation, 0, 0, m.width, m.height) - inSaturation) * settings.OutsideImportance
+
+	score.Total = (score.Detail*settings.DetailWeight + score.Skin*settings.SkinWeight + score.Saturation*settings.SaturationWeight) / float64(crop.Width) / float64(crop.Height)
+	return score
+}
+
+// topScoredCrop scores the candidates as they are generated, fanned out across one goroutine per CPU,
+// and returns the first one with the highest score over -1, along with that score.
+// When scores isn't nil, the total score of every candidate is stored in it.
+func topScoredCrop(settings *CropSettings, m *scoreMap, cs *candidates, scores []float64) (Crop, float64) {
+	var topCrop Crop
+	topScore := -1.0
+	if cs.total == 0 {
+		return topCrop, topScore
+	}
+
+	workers := runtime.NumCPU()
+	chunk := int(math.Ceil(float64(cs.total) / float64(workers)))
+	tops := make([]Crop, 0, workers)
+	for start := 0; start < cs.total; start += chunk {
+		tops = append(tops, Crop{Score: Score{Total: topScore}})
+	}
+
+	var wg sync.WaitGroup
+	for w := range tops {
+		start := w * chunk
+		end := start + chunk
+		if end > cs.total {
+			end = cs.total
+		}
+
+		wg.Add(1)
+		go func(top *Crop, start, end int) {
+			defer wg.Done()
+			for n := start; n < end; n++ {
+				crop := cs.crop(settings, n)
+				score := m.score(settings, &crop)
+				if scores != nil {
+					scores[n] = score.Total
+				}
+				if score.Total > top.Score.Total {
+					crop.Score = score
+					*top = crop
+				}
+			}
+		}(&tops[w], start, end)
+	}
+	wg.Wait()
+
+	// the chunks are in candidate order, so ties still go to the first candidate.
+	for _, top := range tops {
+		if top.Score.Total > topScore {
+			topCrop = top
+			topScore = top.Score.Total
+		}
+	}
+
+	return topCrop, topScore
+}
@@ -0,0 +1,100 @@
+package main
+
+// source.go keeps the source images downloaded from origins around, so the other sizes of an image don't download it again.
+import (
+	"context"
+	"time"
+
+	"github.com/bvchevez/imageprocess/cache"
+	"github.com/bvchevez/imageprocess/origin"
+)
+
+var (
+	sourceCache    cache.Cache   = cache.NewTiered(nil) // sourceCache holds *Source by origin url.
+	sourceCacheTTL time.Duration                        // sourceCacheTTL is how long sources are used before they're revalidated with their origin.
+
+	// sourceFlights coalesces downloads of the same source, by origin url.
+	sourceFlights = cache.Group{Panicked: logPanic}
+)
+
+// Source is a source image as downloaded from its origin.
+type Source struct {
+	Data         []byte
+	ETag         string    // ETag is the origin's ETag for Data, if it sent one.
+	LastModified string    // LastModified is the origin's Last-Modified for Data, if it sent one.
+	Fetched      time.Time // Fetched is when the origin last sent or confirmed Data.
+}
+
+// sourceSize is the size of a *Source in the source cache.
+func sourceSize(value interface{}) int64 {
+	return int64(len(value.(*Source).Data))
+}
+
+// FreshSource returns the source image at path of o if it's in the source cache and fresh, without asking o.
+func FreshSource(o origin.Origin, path string) (*Source, bool) {
+	value, ok := sourceCache.Get(o.URL(path))
+	if !ok || time.Since(value.(*Source).Fetched) >= sourceCacheTTL {
+		return nil, false
+	}
+
+	return value.(*Source), true
+}
+
+// GetSource returns the source image at path of o, from the source cache while it's fresh.
+// Once it expires, it's revalidated with o using its ETag, and only downloaded again if it changed.
+// Concurrent requests for the same source share one download.
+func GetSource(o origin.Origin, path string) (*Source, error) {
+	url := o.URL(path)
+
+	var cached *Source
+	if value, ok := sourceCache.Get(url); ok {
+		cached = value.(*Source)
+		if time.Since(cached.Fetched) < sourceCacheTTL {
+			return cached, nil
+		}
+	}
+
+	value, _, err := sourceFlights.Do(url, func() (interface{}, error) {
+		source, err := FetchSource(o, path, cached)
+		if err != nil {
+			return nil, err
+		}
+
+		sourceCache.Add(url, source, sourceSize(source))
+		return source, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*Source), nil
+}
+
+// FetchSource downloads the source image at path of o. If cached has an ETag, o is asked whether it changed
+// and cached is kept when it didn't.
+func FetchSource(o origin.Origin, path string, cached *Source) (*Source, error) {
+	etag := ""
+	if cached != nil {
+		etag = cached.ETag
+	}
+
+	data, meta, err := o.Fetch(context.Background(), path, etag)
+	if err == origin.ErrNotModified {
+		return &Source{
+			Data:         cached.Data,
+			ETag:         cached.ETag,
+			LastModified: cached.LastModified,
+			Fetched:      time.Now(),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Source{
+		Data:         data,
+		ETag:         meta.ETag,
+		LastModified: meta.LastModified,
+		Fetched:      time.Now(),
+	}, nil
+}
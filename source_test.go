@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bvchevez/imageprocess/cache"
+	"github.com/bvchevez/imageprocess/origin"
+	"github.com/stretchr/testify/assert"
+)
+
+// go test -run Test_GetSource_revalidate -v
+func Test_GetSource_revalidate(t *testing.T) {
+	requests, downloads := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("source"))
+	}))
+	defer server.Close()
+
+	sourceCache, _ = cache.NewMemory(1024)
+	sourceCacheTTL = time.Hour
+	defer func() { sourceCache = cache.NewTiered(nil) }()
+
+	// fresh sources don't touch the origin.
+	for i := 0; i < 3; i++ {
+		source, err := GetSource(origin.NewHTTP(server.URL), "/a.jpg")
+		assert.Nil(t, err)
+		assert.Equal(t, "source", string(source.Data))
+	}
+	assert.Equal(t, 1, requests)
+
+	// expired sources are revalidated, but not downloaded again.
+	sourceCacheTTL = 0
+	source, err := GetSource(origin.NewHTTP(server.URL), "/a.jpg")
+	assert.Nil(t, err)
+	assert.Equal(t, "source", string(source.Data))
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, downloads)
+}
+
+// go test -run Test_GetSource_disabled -v
+func Test_GetSource_disabled(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("source"))
+	}))
+	defer server.Close()
+
+	sourceCache = cache.NewTiered(nil)
+	GetSource(origin.NewHTTP(server.URL), "/a.jpg")
+	GetSource(origin.NewHTTP(server.URL), "/a.jpg")
+	assert.Equal(t, 2, requests)
+}
+
+// go test -run Test_GetSource_coalesce -v
+func Test_GetSource_coalesce(t *testing.T) {
+	var requests int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(started)
+		}
+		<-release
+		w.Write([]byte("source"))
+	}))
+	defer server.Close()
+
+	sourceCache = cache.NewTiered(nil)
+
+	// downloads of a source already being downloaded wait for it.
+	var wg sync.WaitGroup
+	get := func() {
+		defer wg.Done()
+		source, err := GetSource(origin.NewHTTP(server.URL), "/a.jpg")
+		assert.Nil(t, err)
+		assert.Equal(t, "source", string(source.Data))
+	}
+	wg.Add(5)
+	go get()
+	<-started
+	for i := 0; i < 4; i++ {
+		go get()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+// go test -run Test_FetchSource_badStatus -v
+func Test_FetchSource_badStatus(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := FetchSource(origin.NewHTTP(server.URL), "/a.jpg", nil)
+	assert.Equal(t, "Source returned a status code other than 200: 404", err.Error())
+}
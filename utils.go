@@ -3,13 +3,14 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"math"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/bvchevez/imageprocess/helper"
 	"github.com/bvchevez/imageprocess/image"
+	"github.com/bvchevez/imageprocess/origin"
 )
 
 // Response represents a JSON response that a handler would use to output
@@ -18,6 +19,15 @@ type Response struct {
 	Code  int         `json:"code"`
 	Data  interface{} `json:"data"`
 	Image *image.Image
+
+	// OriginStatus is the status the origin answered a failed download with, if it answered.
+	OriginStatus int `json:"-"`
+	// RetryAfter is how long until a failing origin is asked again, if it isn't for now.
+	RetryAfter time.Duration `json:"-"`
+	// Stale is set when Image is an expired processed image, served while it's processed again.
+	Stale bool `json:"-"`
+	// Policy is the policy of the site of Image, its cache headers are the policy's.
+	Policy *Policy `json:"-"`
 }
 
 // CustomWriter writes bytes to http response writer, caller can pass whatever content type they want.
@@ -36,6 +46,19 @@ func JsonWriter(w http.ResponseWriter, res *Response) {
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	// Errors are cached briefly, so Fastly doesn't keep serving a transient failure.
+	if res.Code >= http.StatusBadRequest {
+		w.Header().Set("Surrogate-Control", errorCacheControl)
+		w.Header().Set("Cache-Control", errorCacheControl)
+	}
+	if res.OriginStatus != 0 {
+		w.Header().Set("X-Origin-Status", fmt.Sprintf("%d", res.OriginStatus))
+	}
+	if res.RetryAfter > 0 {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int64(math.Ceil(res.RetryAfter.Seconds()))))
+	}
+
 	w.WriteHeader(res.Code)
 	w.Write(b)
 }
@@ -43,12 +66,17 @@ func JsonWriter(w http.ResponseWriter, res *Response) {
 // ImageHeaderWriter writes the header info for a given image
 func ImageHeaderWriter(w http.ResponseWriter, res *Response) {
 	w.Header().Set("Content-Type", res.Image.Type)
-	w.Header().Set("Surrogate-Control", *config.surrogateControl)
-	w.Header().Set("Cache-Control", *config.cacheControl)
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", res.Image.Size))
 	w.Header().Set("X-Image-Dimensions", fmt.Sprintf("%d:%d", res.Image.Width, res.Image.Height))
 	w.Header().Set("X-Source-Image-Dimensions",
 		fmt.Sprintf("%d:%d", res.Image.SourceWidth, res.Image.SourceHeight))
+	ValidatorsWriter(w, res.Image)
+	CacheHeadersWriter(w, res)
+
+	// Faces blurred for privacy are counted, so it's clear whether any were found.
+	if res.Image.BlurFaces {
+		w.Header().Set("X-Faces-Blurred", fmt.Sprintf("%d", res.Image.FacesBlurred))
+	}
 
 	// If this image is gif, we mark this as animated.
 	// Currently the only test for animation is GIF.
@@ -68,6 +96,51 @@ func ImageWriter(w http.ResponseWriter, res *Response) {
 	w.Write(res.Image.Data)
 }
 
+// NotModifiedWriter answers a conditional request whose image didn't change, without the image.
+func NotModifiedWriter(w http.ResponseWriter, res *Response) {
+	ValidatorsWriter(w, res.Image)
+	CacheHeadersWriter(w, res)
+
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// CacheHeadersWriter sets the cache headers of the image of res, its policy's unless it's a fallback, stale,
+// or a debug image.
+func CacheHeadersWriter(w http.ResponseWriter, res *Response) {
+	surrogateControl, cacheControl := cacheHeaders(res)
+
+	// Fallbacks are served instead of missing images, which may show up soon.
+	if res.Image.Fallback {
+		w.Header().Set("X-Fallback", "1")
+		surrogateControl, cacheControl = errorCacheControl, errorCacheControl
+	}
+
+	// Stale images are served briefly, they're being processed again.
+	if res.Stale {
+		w.Header().Set("X-Cache", "STALE")
+		w.Header().Set("Warning", `110 - "Response is Stale"`)
+		surrogateControl, cacheControl = errorCacheControl, errorCacheControl
+	}
+
+	// Debug images are never stored, their urls carry the debug token.
+	if res.Image.Debug {
+		surrogateControl, cacheControl = "no-store", "no-store"
+	}
+
+	w.Header().Set("Surrogate-Control", surrogateControl)
+	w.Header().Set("Cache-Control", cacheControl)
+}
+
+// ValidatorsWriter sets the ETag and Last-Modified headers of img, the ones it has.
+func ValidatorsWriter(w http.ResponseWriter, img *image.Image) {
+	if img.ETag != "" {
+		w.Header().Set("ETag", img.ETag)
+	}
+	if img.LastModified != "" {
+		w.Header().Set("Last-Modified", img.LastModified)
+	}
+}
+
 // extract site/path info from given path.
 // Always returns a slice of exactly two strings, site/path.
 // return two blank strings on error.
@@ -83,47 +156,45 @@ func ExtractInfoFromPath(path string) ([]string, error) {
 
 }
 
-// getImage takes site and path strings and attempts to return an Image struct (defined in pipeline.go)
-// Will first check for a matching site within the map of S3 configs, and fall back to checking site strings
-func GetImage(site, path, pipelineID string) ([]byte, error) {
+// getImage takes site and path strings and attempts to return the source image, along with its origin's validators.
+// It's downloaded from the site's origin, see SiteOrigin.
+func GetImage(site, path, pipelineID string) (*Source, error) {
 	defer helper.Timer(helper.TimerPayload{
 		Start: time.Now(),
 		Name:  "(" + pipelineID + ") getImage",
 	})
 
-	conifgSite := config.GetSite(site)
-	if len(conifgSite) != 0 {
-		return GetImageFromUrl(conifgSite + path)
-	} else {
-		return nil, fmt.Errorf("A proper source destination was not found. Source was: " + site)
+	o, err := SiteOrigin(site)
+	if err != nil {
+		return nil, err
 	}
+
+	return GetSource(o, path)
 }
 
-// getImageFromUrl takes a URL string to be retrived
-// It will attempt to retrieve a resource (in this case an image) from the URL
-func GetImageFromUrl(url string) ([]byte, error) {
-	// Make request for resource
-	res, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("Error getting image: %v", err)
+// SiteOrigin returns where the images of site are downloaded from: the origin set up for it in the origins file,
+// or else its domain, found in the allowed sites, over http(s).
+func SiteOrigin(site string) (origin.Origin, error) {
+	// Downloads from the site's origin stop for a while when it's failing.
+	if o, ok := origin.ForSite(site); ok {
+		return origin.BreakerFor(site).Guard(o), nil
 	}
 
-	// Close the response body after this function returns
-	defer res.Body.Close()
-
-	// Check for 200 status code
-	// S3 does not always send 404s only
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Source returned a status code other than 200: %d", res.StatusCode)
+	conifgSite := config.GetSite(site)
+	if len(conifgSite) == 0 {
+		return nil, fmt.Errorf("A proper source destination was not found. Source was: " + site)
 	}
 
-	// Read in data from response body
-	data, err := ioutil.ReadAll(res.Body)
+	return origin.BreakerFor(site).Guard(origin.NewHTTP(conifgSite)), nil
+}
 
-	// Check for errors reading response body
+// getImageFromUrl takes a URL string to be retrived
+// It will attempt to retrieve a resource (in this case an image) from the URL
+func GetImageFromUrl(url string) ([]byte, error) {
+	source, err := FetchSource(origin.NewHTTP(url), "", nil)
 	if err != nil {
-		return nil, fmt.Errorf("Error reading response body: %v", err)
+		return nil, err
 	}
 
-	return data, nil
+	return source.Data, nil
 }
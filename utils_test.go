@@ -2,9 +2,12 @@ package main
 
 import (
 	"github.com/bvchevez/imageprocess/image"
+	"github.com/bvchevez/imageprocess/origin"
 	"github.com/stretchr/testify/assert"
 	"net/http"
+	"io/ioutil"
 	"net/http/httptest"
+	"os"
 	"testing"
 )
 
@@ -41,6 +44,31 @@ func Test_GetImageFromUrl_badUrl(t *testing.T) {
 	assert.Equal(t, []byte(nil), b)
 }
 
+// go test -run Test_SiteOrigin -v
+func Test_SiteOrigin(t *testing.T) {
+	resetConfig()
+	f, _ := ioutil.TempFile("", "origins")
+	defer os.Remove(f.Name())
+
+	ioutil.WriteFile(f.Name(), []byte(`{"local-dev": {"type": "local", "dir": "fixtures"}}`), 0644)
+	assert.Nil(t, origin.Load(f.Name()))
+	defer func() {
+		ioutil.WriteFile(f.Name(), []byte(`{}`), 0644)
+		origin.Load(f.Name())
+	}()
+
+	// sites with an origin of their own are supported, and downloaded from it.
+	assert.True(t, IsSupportedSite("local-dev"))
+	o, err := SiteOrigin("local-dev")
+	assert.Nil(t, err)
+	assert.Equal(t, "file://fixtures/a.jpg", o.URL("/a.jpg"))
+
+	// other sites are downloaded from their domain.
+	o, err = SiteOrigin("caranddriver")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://cad.h-cdn.test.co/a.jpg", o.URL("/a.jpg"))
+}
+
 // go test -run Test_JsonWriter__200Response -v
 func Test_JsonWriter__200Response(t *testing.T) {
 	res := &Response{Code: http.StatusOK, Data: "Test Data"}
@@ -63,6 +91,28 @@ func Test_JsonWriter__400Response(t *testing.T) {
 	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
 }
 
+// go test -run Test_JsonWriter__errorHeaders -v
+func Test_JsonWriter__errorHeaders(t *testing.T) {
+	res := &Response{
+		Code:         http.StatusBadGateway,
+		Data:         "Source returned a status code other than 200: 503",
+		OriginStatus: http.StatusServiceUnavailable,
+	}
+
+	w := httptest.NewRecorder()
+	JsonWriter(w, res)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, "503", w.Header().Get("X-Origin-Status"))
+	assert.Equal(t, errorCacheControl, w.Header().Get("Cache-Control"))
+	assert.Equal(t, errorCacheControl, w.Header().Get("Surrogate-Control"))
+
+	// successful responses keep their cache control.
+	w = httptest.NewRecorder()
+	JsonWriter(w, &Response{Code: http.StatusOK, Data: "Test Data"})
+	assert.Equal(t, "", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "", w.Header().Get("X-Origin-Status"))
+}
+
 // go test -run Test_JsonWriter__FailedJsonMarhsal -v
 func Test_JsonWriter__FailedJsonMarhsal(t *testing.T) {
 	res := &Response{
@@ -108,3 +158,39 @@ func Test_ImageWriter(t *testing.T) {
 	assert.Equal(t, "max-age=54321", w.Header().Get("Cache-Control"))
 	assert.Equal(t, "100", w.Header().Get("Content-Length"))
 }
+
+// go test -run Test_ImageWriter_FacesBlurred -v
+func Test_ImageWriter_FacesBlurred(t *testing.T) {
+	if (config.port == nil) {
+		config.Init()
+	}
+
+	res := &Response{
+		Code:  http.StatusOK,
+		Image: &image.Image{Type: "mock/type"},
+	}
+
+	// only images that went through blur-faces say how many faces were blurred.
+	w := httptest.NewRecorder()
+	ImageWriter(w, res)
+	assert.Equal(t, "", w.Header().Get("X-Faces-Blurred"))
+
+	res.Image.BlurFaces = true
+	w = httptest.NewRecorder()
+	ImageWriter(w, res)
+	assert.Equal(t, "0", w.Header().Get("X-Faces-Blurred"))
+
+	res.Image.FacesBlurred = 2
+	w = httptest.NewRecorder()
+	ImageWriter(w, res)
+	assert.Equal(t, "2", w.Header().Get("X-Faces-Blurred"))
+}
+
+// go test -run Test_ImageHeaderWriter_debug -v
+func Test_ImageHeaderWriter_debug(t *testing.T) {
+	w := httptest.NewRecorder()
+	ImageHeaderWriter(w, &Response{Image: &image.Image{Type: image.PNG, Debug: true}})
+
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "no-store", w.Header().Get("Surrogate-Control"))
+}